@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"zano-peer-finder/internal/addrclass"
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/ipinfo"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/zanolog"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	// Configure zerolog
+	zerolog.TimeFieldFormat = time.RFC3339
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		Out:        os.Stdout,
+		TimeFormat: time.RFC3339,
+	})
+}
+
+// endpoint is a node's P2P address
+type endpoint struct {
+	ip   string
+	port int
+}
+
+// sighting is the window in which an endpoint appeared in the replayed logs
+type sighting struct {
+	first, last time.Time
+}
+
+// logFile is an archived log and the time of its first entry
+type logFile struct {
+	path  string
+	start time.Time
+}
+
+// log-replay backfills nodes.db from archived zanod logs. Every endpoint
+// found is stored with the log timestamps of its first and last appearance
+// instead of the time of the replay.
+func main() {
+	dbPath := flag.String("db", "nodes.db", "Database to backfill")
+	networkName := flag.String("network", "mainnet", "Zano network the logs belong to (mainnet or testnet)")
+	timezone := flag.String("timezone", "UTC", "Time zone of the host that wrote the logs, e.g. Europe/Berlin or Local")
+	geo := flag.Bool("geo", true, "Geolocate IPs not yet in the database (nodes without a location aren't stored)")
+	events := flag.Bool("events", false, "Print the peer events parsed from each file instead of backfilling")
+	ignore := flag.String("ignore-cidr", "", "Comma-separated CIDR ranges or IPs whose addresses are not stored")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] zanod.log [zanod.log.1.gz ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *events {
+		for _, path := range flag.Args() {
+			if err := printEvents(path); err != nil {
+				log.Fatal().Err(err).Str("path", path).Msg("Error reading log file")
+			}
+		}
+		return
+	}
+
+	profile, err := network.Lookup(*networkName)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error selecting network")
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error loading time zone")
+	}
+
+	classifier := addrclass.New()
+	for _, cidr := range strings.Split(*ignore, ",") {
+		if strings.TrimSpace(cidr) == "" {
+			continue
+		}
+		if err := classifier.Ignore(cidr); err != nil {
+			log.Fatal().Err(err).Msg("Error parsing ignore list")
+		}
+	}
+
+	files, err := orderFiles(flag.Args(), loc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error reading log files")
+	}
+
+	sightings := make(map[endpoint]*sighting)
+	for _, f := range files {
+		if err := replayFile(f.path, loc, profile.P2PPort, sightings); err != nil {
+			log.Fatal().Err(err).Str("path", f.path).Msg("Error replaying log file")
+		}
+	}
+	log.Info().Int("files", len(files)).Int("endpoints", len(sightings)).Msg("Logs replayed")
+
+	// Drop the addresses peer-finder would reject before they are looked
+	// up or stored
+	for ep := range sightings {
+		if _, ok := classifier.Check(ep.ip); !ok {
+			delete(sightings, ep)
+		}
+	}
+	stats := classifier.Stats()
+	log.Info().Uint64("accepted", stats.Accepted).Interface("rejected", stats.Rejected).Msg("Filtered addresses")
+
+	db, err := database.New(*dbPath, profile.Name)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error initializing database")
+	}
+	defer db.Close()
+
+	// Known nodes only get their seen window widened; the rest need a
+	// location before they can be stored
+	var unknown []endpoint
+	extended := 0
+	for ep, s := range sightings {
+		found, err := db.ExtendNodeSeen(ep.ip, ep.port, s.first, s.last)
+		if err != nil {
+			log.Fatal().Err(err).Str("ip", ep.ip).Int("port", ep.port).Msg("Error updating node")
+		}
+		if found {
+			extended++
+		} else {
+			unknown = append(unknown, ep)
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		if unknown[i].ip != unknown[j].ip {
+			return unknown[i].ip < unknown[j].ip
+		}
+		return unknown[i].port < unknown[j].port
+	})
+	log.Info().Int("extended", extended).Int("new", len(unknown)).Msg("Updated known nodes")
+
+	// New endpoints on an IP that is already located reuse its location;
+	// only the other IPs are looked up, once each
+	geos := make(map[string]*database.Geo)
+	var lookups []string
+	for _, ep := range unknown {
+		if _, ok := geos[ep.ip]; ok {
+			continue
+		}
+		g, err := db.GetGeo(ep.ip)
+		if err != nil {
+			log.Fatal().Err(err).Str("ip", ep.ip).Msg("Error reading IP geolocation")
+		}
+		geos[ep.ip] = g
+		if g == nil {
+			lookups = append(lookups, ep.ip)
+		}
+	}
+
+	if *geo && len(lookups) > 0 {
+		ipService := ipinfo.NewService()
+		failed := 0
+		for start := 0; start < len(lookups); start += ipinfo.MaxBatch {
+			batch := lookups[start:min(start+ipinfo.MaxBatch, len(lookups))]
+			infos := lookupBatch(ipService, batch)
+			for i, info := range infos {
+				if info.Status != "success" {
+					failed++
+					continue
+				}
+				geos[batch[i]] = newGeo(info)
+			}
+			log.Info().Int("done", start+len(batch)).Int("total", len(lookups)).Msg("Geolocated new IPs")
+		}
+		log.Info().Int("ips", len(lookups)).Int("failed", failed).Msg("Geolocation complete")
+	}
+
+	added := 0
+	for _, ep := range unknown {
+		g := geos[ep.ip]
+		if g == nil {
+			continue
+		}
+		if err := db.UpsertNode(newNode(ep, g, sightings[ep])); err != nil {
+			log.Fatal().Err(err).Str("ip", ep.ip).Int("port", ep.port).Msg("Error saving node")
+		}
+		added++
+	}
+	log.Info().Int("added", added).Int("skipped", len(unknown)-added).Msg("Backfill complete")
+}
+
+// orderFiles sorts log files by the time of their first entry, so rotated
+// archives replay oldest first whatever their names
+func orderFiles(paths []string, loc *time.Location) ([]logFile, error) {
+	files := make([]logFile, 0, len(paths))
+	for _, path := range paths {
+		start, err := firstTimestamp(path, loc)
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() {
+			log.Warn().Str("path", path).Msg("No timestamps in log file, skipping it")
+			continue
+		}
+		files = append(files, logFile{path: path, start: start})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].start.Before(files[j].start) })
+	return files, nil
+}
+
+// firstTimestamp returns the time of the first timestamped line in path
+func firstTimestamp(path string, loc *time.Location) (time.Time, error) {
+	r, err := openLog(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer r.Close()
+
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		if t, ok := zanolog.ParseTimestamp(scanner.Text(), loc); ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, scanner.Err()
+}
+
+// replayFile adds the endpoints found in path to sightings. Lines without a
+// timestamp belong to the entry above them. Hosts logged without a port get
+// defaultPort. Inbound connections are skipped, as the log names only the
+// peer's ephemeral port and not the one it listens on, if any.
+func replayFile(path string, loc *time.Location, defaultPort int, sightings map[endpoint]*sighting) error {
+	r, err := openLog(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var current time.Time
+	lines := 0
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines++
+		if t, ok := zanolog.ParseTimestamp(line, loc); ok {
+			current = t
+		}
+		if current.IsZero() {
+			continue
+		}
+
+		ev, ok := zanolog.Parse(line)
+		if !ok {
+			continue
+		}
+		if ev.Direction == zanolog.DirectionInbound {
+			continue
+		}
+		ep := endpoint{ip: ev.IP, port: ev.Port}
+		if ep.port == 0 {
+			ep.port = defaultPort
+		}
+		s, ok := sightings[ep]
+		if !ok {
+			sightings[ep] = &sighting{first: current, last: current}
+			continue
+		}
+		if current.Before(s.first) {
+			s.first = current
+		}
+		if current.After(s.last) {
+			s.last = current
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	log.Info().Str("path", path).Int("lines", lines).Time("lastEntry", current).Msg("Replayed log file")
+	return nil
+}
+
+// printEvents writes the events parsed from path to stdout, one per line
+// prefixed with the line number. This is the format of the parser's
+// golden files.
+func printEvents(path string) error {
+	r, err := openLog(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	lineNo := 0
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		if ev, ok := zanolog.Parse(scanner.Text()); ok {
+			fmt.Printf("%d\t%s\n", lineNo, ev)
+		}
+	}
+	return scanner.Err()
+}
+
+// openLog opens a plain or gzip-compressed log, detected by its header
+func openLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, f}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, f}, nil
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	const maxCapacity = 1024 * 1024 // 1MB
+	scanner.Buffer(make([]byte, maxCapacity), maxCapacity)
+	return scanner
+}
+
+// lookupBatch geolocates one batch, waiting out rate limits. Other errors
+// are retried a few times before giving up.
+func lookupBatch(ipService *ipinfo.Service, batch []string) []*ipinfo.IPAPIResponse {
+	const maxErrors = 5
+	failures := 0
+	for {
+		infos, err := ipService.GetIPInfoBatch(batch)
+		if err == nil {
+			return infos
+		}
+		if err.Error() == "rate limit exceeded" {
+			log.Warn().Msg("Rate limit exceeded, waiting...")
+		} else if failures++; failures >= maxErrors {
+			log.Fatal().Err(err).Msg("Error geolocating batch")
+		} else {
+			log.Error().Err(err).Msg("Error geolocating batch, retrying")
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// newGeo converts an ip-api result into its database form
+func newGeo(info *ipinfo.IPAPIResponse) *database.Geo {
+	return &database.Geo{
+		Country:     info.Country,
+		City:        info.City,
+		Lat:         info.Lat,
+		Lon:         info.Lon,
+		ISP:         info.ISP,
+		Region:      info.Region,
+		RegionName:  info.RegionName,
+		Timezone:    info.Timezone,
+		Zip:         info.Zip,
+		AS:          info.AS,
+		Org:         info.Org,
+		Query:       info.Query,
+		Status:      info.Status,
+		CountryCode: info.CountryCode,
+		District:    info.District,
+		Continent:   info.Continent,
+		Currency:    info.Currency,
+		Mobile:      info.Mobile,
+		Proxy:       info.Proxy,
+		Hosting:     info.Hosting,
+	}
+}
+
+// newNode builds the stored node for an endpoint first found in the logs
+func newNode(ep endpoint, geo *database.Geo, s *sighting) *database.Node {
+	return &database.Node{
+		IP:        ep.ip,
+		Port:      ep.port,
+		Geo:       *geo,
+		LastSeen:  s.last,
+		FirstSeen: s.first,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"zano-peer-finder/internal/addrclass"
+	"zano-peer-finder/internal/ipinfo"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Function to build the address classifier from the -ignore-cidr,
+// -public-ip and -allow-address-class flags. Values may be comma-separated.
+func newAddressFilter(ignore, publicIPs []string, allow string) (*addrclass.Classifier, error) {
+	c := addrclass.New()
+	for _, v := range ignore {
+		for _, cidr := range strings.Split(v, ",") {
+			if strings.TrimSpace(cidr) == "" {
+				continue
+			}
+			if err := c.Ignore(cidr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, v := range publicIPs {
+		for _, ip := range strings.Split(v, ",") {
+			c.AddSelf(strings.TrimSpace(ip))
+		}
+	}
+	for _, name := range strings.Split(allow, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		class, err := addrclass.ParseAllowable(name)
+		if err != nil {
+			return nil, err
+		}
+		c.Allow(class)
+	}
+
+	// Our interfaces' addresses are ours too. Loopback is left out so a
+	// simulated network on 127.0.0.1 can still be allowed.
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Warn().Err(err).Msg("Error listing interface addresses")
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && addrclass.Classify(ipNet.IP) != addrclass.Loopback {
+			c.AddSelf(ipNet.IP.String())
+		}
+	}
+	return c, nil
+}
+
+// Function to ask ip-api for this host's public address, which behind NAT
+// is not on any interface, and reject it as our own. Gives up after a few
+// attempts.
+func detectPublicIP(ctx context.Context, c *addrclass.Classifier, ipService *ipinfo.Service, rateLimiter *RateLimiter) {
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
+		}
+
+		rateLimiter.Wait()
+		info, err := ipService.GetIPInfo("")
+		if err != nil || info.Status != "success" {
+			log.Warn().Err(err).Int("attempt", attempt+1).Msg("Error detecting public IP")
+			continue
+		}
+		c.AddSelf(info.Query)
+		log.Info().Str("ip", info.Query).Msg("Detected public IP")
+		return
+	}
+}
+
+// Function to name the class of a non-public address for the UI, or return
+// "" for a public one
+func addressClassTag(ip string) string {
+	if class := addrclass.Classify(net.ParseIP(ip)); class != addrclass.Public {
+		return string(class)
+	}
+	return ""
+}
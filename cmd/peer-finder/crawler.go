@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"zano-peer-finder/internal/crawler"
+	"zano-peer-finder/internal/database"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How often the crawl frontier is written to the database
+const frontierSaveInterval = 5 * time.Minute
+
+// Function to start the P2P crawler and feed reachable nodes to the recorder.
+// Returns once ctx is cancelled and the frontier has been saved.
+func startCrawler(ctx context.Context, db *database.DB, record func(*discoveredNode), savedPeers []database.SavedPeer, cfg crawler.Config, timeout time.Duration) {
+	crawlConfig := *p2pConfig
+	if timeout > 0 {
+		crawlConfig.Timeout = timeout
+	}
+
+	c := crawler.New(&crawlConfig, cfg, func(res *crawler.Result) {
+		if res.Err != nil {
+			return
+		}
+		recordAdvertisements(res.Address, res.Peerlist, db)
+		record(&discoveredNode{ip: res.IP, port: res.Port, source: sourceCrawler, handshake: true, nodeData: res.NodeData, syncData: res.SyncData})
+	})
+
+	// Resume the previous run's frontier so backoff state survives restarts
+	if entries, err := db.LoadFrontier(); err != nil {
+		log.Error().Err(err).Msg("Error loading crawl frontier")
+	} else {
+		endpoints := make([]crawler.Endpoint, 0, len(entries))
+		for _, e := range entries {
+			endpoints = append(endpoints, crawler.Endpoint{
+				Address:     e.Address,
+				AdvertBy:    e.AdvertBy,
+				Attempts:    e.Attempts,
+				Failures:    e.Failures,
+				LastAttempt: e.LastAttempt,
+				LastSuccess: e.LastSuccess,
+				NextAttempt: e.NextAttempt,
+			})
+		}
+		c.Restore(endpoints)
+		log.Info().Int("endpoints", len(endpoints)).Msg("Restored crawl frontier")
+	}
+
+	// Seed from the shipped seed nodes, saved peers and known nodes. Known
+	// endpoints keep their schedule, so reseeding only picks up new ones.
+	seed := func() {
+		for _, addr := range activeNetwork.Seeds {
+			c.Add(addr)
+		}
+		for _, peer := range savedPeers {
+			c.Add(nodeEndpoint(peer.IP, peer.Port))
+		}
+		nodes, err := db.GetAllNodes()
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting nodes for crawler seeding")
+			return
+		}
+		for _, node := range nodes {
+			c.Add(nodeEndpoint(node.IP, node.Port))
+		}
+	}
+	seed()
+
+	save := func() {
+		snapshot := c.Snapshot()
+		entries := make([]*database.FrontierEntry, 0, len(snapshot))
+		for _, e := range snapshot {
+			entries = append(entries, &database.FrontierEntry{
+				Address:     e.Address,
+				AdvertBy:    e.AdvertBy,
+				Attempts:    e.Attempts,
+				Failures:    e.Failures,
+				LastAttempt: e.LastAttempt,
+				LastSuccess: e.LastSuccess,
+				NextAttempt: e.NextAttempt,
+			})
+		}
+		if err := db.SaveFrontier(entries); err != nil {
+			log.Error().Err(err).Msg("Error saving crawl frontier")
+			return
+		}
+		known, queued, active := c.Stats()
+		log.Debug().Int("known", known).Int("queued", queued).Int("active", active).Msg("Saved crawl frontier")
+	}
+
+	go func() {
+		saveTicker := time.NewTicker(frontierSaveInterval)
+		defer saveTicker.Stop()
+		seedTicker := time.NewTicker(30 * time.Minute)
+		defer seedTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-saveTicker.C:
+				save()
+			case <-seedTicker.C:
+				seed()
+				if err := db.PruneAdvertisements(time.Now().Add(-7 * 24 * time.Hour)); err != nil {
+					log.Error().Err(err).Msg("Error pruning peer advertisements")
+				}
+			}
+		}
+	}()
+
+	c.Run(ctx)
+	save()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/zanorpc"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How often the local daemon's connections and peer lists are polled
+const daemonPeerPollInterval = time.Minute
+
+// daemonDiscovery feeds peers from the local zanod's RPC into the recorder.
+// Unlike log scraping it works at any log level.
+type daemonDiscovery struct {
+	db     *database.DB
+	record func(*discoveredNode)
+
+	// Set once the daemon says it doesn't expose the method
+	noConnections bool
+	noPeerList    bool
+
+	// Endpoints queued for enrichment recently, to avoid requeueing every poll
+	recent map[string]time.Time
+}
+
+// Function to periodically discover peers from the local daemon
+func startDaemonDiscovery(ctx context.Context, db *database.DB, record func(*discoveredNode)) {
+	d := &daemonDiscovery{
+		db:     db,
+		record: record,
+		recent: make(map[string]time.Time),
+	}
+
+	ticker := time.NewTicker(daemonPeerPollInterval)
+	defer ticker.Stop()
+
+	log.Info().Str("rpc", localRPC.URL()).Msg("Starting local daemon peer discovery...")
+	for {
+		d.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Local daemon peer discovery stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Function to run one poll of the daemon's connection table and peer lists
+func (d *daemonDiscovery) poll(ctx context.Context) {
+	var peers []*database.DaemonPeer
+	now := time.Now()
+
+	if !d.noConnections {
+		resp, err := localRPC.GetConnections(ctx)
+		switch {
+		case zanorpc.IsMethodNotFound(err):
+			log.Warn().Msg("Local daemon doesn't expose get_connections, skipping its connection table")
+			d.noConnections = true
+		case err != nil:
+			log.Debug().Err(err).Msg("Error getting local daemon connections")
+		default:
+			for _, c := range resp.Connections {
+				host, portStr, _ := net.SplitHostPort(c.Endpoint())
+				port, _ := strconv.Atoi(portStr)
+				direction := "outbound"
+				if c.Incoming {
+					direction = "inbound"
+				}
+				peers = append(peers, &database.DaemonPeer{
+					IP:             host,
+					Port:           port,
+					Source:         database.DaemonPeerConnection,
+					PeerID:         string(c.PeerID),
+					Direction:      direction,
+					ConnectedSince: now.Add(-time.Duration(c.LiveTime) * time.Second),
+				})
+			}
+		}
+	}
+
+	if !d.noPeerList {
+		resp, err := localRPC.GetPeerList(ctx)
+		switch {
+		case zanorpc.IsMethodNotFound(err):
+			log.Warn().Msg("Local daemon doesn't expose get_peer_list, skipping its peer lists")
+			d.noPeerList = true
+		case err != nil:
+			log.Debug().Err(err).Msg("Error getting local daemon peer list")
+		default:
+			peers = append(peers, daemonPeerEntries(resp.WhiteList, database.DaemonPeerWhite)...)
+			peers = append(peers, daemonPeerEntries(resp.GrayList, database.DaemonPeerGray)...)
+		}
+	}
+
+	// Drop entries the log scraper would skip too, and store the rest in
+	// canonical form
+	valid := peers[:0]
+	for _, p := range peers {
+		ip := net.ParseIP(p.IP)
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+			continue
+		}
+		p.IP = ip.String()
+		valid = append(valid, p)
+	}
+	peers = valid
+	if len(peers) == 0 {
+		return
+	}
+
+	if err := d.db.RecordDaemonPeers(peers); err != nil {
+		log.Error().Err(err).Msg("Error saving local daemon peers")
+	}
+	if err := d.db.PruneDaemonPeers(now.Add(-7 * 24 * time.Hour)); err != nil {
+		log.Error().Err(err).Msg("Error pruning local daemon peers")
+	}
+
+	d.enqueue(peers, now)
+}
+
+// Function to queue new endpoints for enrichment. Live connections are
+// requeued so their last seen time stays current; peer list entries only
+// when we have never recorded the endpoint.
+func (d *daemonDiscovery) enqueue(peers []*database.DaemonPeer, now time.Time) {
+	nodes, err := d.db.GetAllNodes()
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting nodes for local daemon discovery")
+		return
+	}
+	known := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		known[nodeEndpoint(node.IP, node.Port)] = true
+	}
+
+	for endpoint, t := range d.recent {
+		if now.Sub(t) > 5*time.Minute {
+			delete(d.recent, endpoint)
+		}
+	}
+
+	queued := 0
+	for _, p := range peers {
+		// An inbound connection comes from the peer's ephemeral port, and
+		// the daemon doesn't report the one it listens on, if any
+		if p.Direction == "inbound" {
+			continue
+		}
+		port := p.Port
+		endpoint := nodeEndpoint(p.IP, port)
+		if _, ok := d.recent[endpoint]; ok {
+			continue
+		}
+		if known[endpoint] && p.Source != database.DaemonPeerConnection {
+			continue
+		}
+		d.recent[endpoint] = now
+		d.record(&discoveredNode{ip: p.IP, port: port, source: sourceDaemonRPC})
+		queued++
+	}
+
+	log.Debug().
+		Int("entries", len(peers)).
+		Int("queued", queued).
+		Msg("Polled local daemon peers")
+}
+
+// Function to convert a daemon peer list into its database form
+func daemonPeerEntries(entries []zanorpc.PeerEntry, source string) []*database.DaemonPeer {
+	peers := make([]*database.DaemonPeer, 0, len(entries))
+	for _, e := range entries {
+		var lastSeen time.Time
+		if e.LastSeen > 0 {
+			lastSeen = time.Unix(e.LastSeen, 0)
+		}
+		peers = append(peers, &database.DaemonPeer{
+			IP:               e.Address(),
+			Port:             int(e.Port),
+			Source:           source,
+			PeerID:           fmt.Sprintf("%016x", e.ID),
+			ReportedLastSeen: lastSeen,
+		})
+	}
+	return peers
+}
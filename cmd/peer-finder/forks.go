@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"zano-peer-finder/internal/database"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// How often the fork analysis runs
+	forkCheckInterval = 10 * time.Minute
+
+	// How far back chain observations are considered
+	forkWindow = 2 * time.Hour
+
+	// Blocks behind the median after which a node on a minority block is
+	// considered stuck rather than racing
+	forkStuckLag = 20
+
+	// Blocks after a hard fork in which a split is attributed to it
+	hardForkWindow = 720
+)
+
+// chainObservation is one report of a node's chain tip
+type chainObservation struct {
+	endpoint string
+	height   uint64
+	blockID  string
+	at       time.Time
+}
+
+// ForkAlertMessage is the websocket payload for a newly detected fork alert
+type ForkAlertMessage struct {
+	Type  string              `json:"type"` // Always "fork_alert"
+	Alert *database.ForkAlert `json:"alert"`
+}
+
+// Function to periodically look for chain splits among observed nodes
+func startForkDetector(ctx context.Context, db *database.DB) {
+	ticker := time.NewTicker(forkCheckInterval)
+	defer ticker.Stop()
+
+	log.Info().Msg("Starting fork detector...")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Fork detector stopped")
+			return
+		case <-ticker.C:
+			detectForks(db)
+		}
+	}
+}
+
+// Function to run one fork analysis, store its alerts and push new ones
+func detectForks(db *database.DB) {
+	obs, err := collectChainObservations(db, time.Now().Add(-forkWindow))
+	if err != nil {
+		log.Error().Err(err).Msg("Error collecting chain observations")
+		return
+	}
+
+	alerts := analyzeForks(obs, networkHeight.Load(), activeNetwork.HardForks)
+	for _, a := range alerts {
+		isNew, err := db.RecordForkAlert(a)
+		if err != nil {
+			log.Error().Err(err).Str("kind", a.Kind).Uint64("height", a.Height).Msg("Error saving fork alert")
+			continue
+		}
+		if !isNew {
+			continue
+		}
+		log.Warn().
+			Str("kind", a.Kind).
+			Uint64("height", a.Height).
+			Str("blockId", a.BlockID).
+			Int("nodes", len(a.Nodes)).
+			Msg(a.Detail)
+		broadcastMessage(&ForkAlertMessage{Type: "fork_alert", Alert: a})
+	}
+
+	if err := db.PruneForkAlerts(time.Now().Add(-30 * 24 * time.Hour)); err != nil {
+		log.Error().Err(err).Msg("Error pruning fork alerts")
+	}
+
+	log.Info().
+		Int("observations", len(obs)).
+		Int("alerts", len(alerts)).
+		Msg("Fork analysis completed")
+}
+
+// Function to gather chain tips from timed sync samples, handshakes and
+// public RPC probes
+func collectChainObservations(db *database.DB, since time.Time) ([]chainObservation, error) {
+	samples, err := db.GetAllHeightSamples(since)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := db.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var obs []chainObservation
+	add := func(endpoint string, height uint64, blockID string, at time.Time) {
+		if height == 0 || blockID == "" || strings.Trim(blockID, "0") == "" || at.Before(since) {
+			return
+		}
+		obs = append(obs, chainObservation{endpoint: endpoint, height: height, blockID: blockID, at: at})
+	}
+	for _, s := range samples {
+		add(nodeEndpoint(s.IP, s.Port), s.Height, s.TopBlockID, s.SampledAt)
+	}
+	rpcSeen := make(map[string]bool)
+	for _, n := range nodes {
+		endpoint := nodeEndpoint(n.IP, n.Port)
+		add(endpoint, n.TopHeight, n.TopBlockID, n.LastHandshake)
+		// Every endpoint on an IP shares its RPC result; count it once.
+		// Rows whose last probe failed may still hold an older answer.
+		if n.PublicRPC && !rpcSeen[n.IP] {
+			rpcSeen[n.IP] = true
+			add(endpoint, n.RPCHeight, n.RPCTopBlockID, n.LastRPCCheck)
+		}
+	}
+	return obs, nil
+}
+
+// Function to group observations by (height, block id) and flag minority
+// chains, orphaned tips and divergence around hard forks
+func analyzeForks(obs []chainObservation, median uint64, hardForks []uint64) []*database.ForkAlert {
+	// Which nodes reported which block at each height, and each node's
+	// most recent tip
+	blocks := make(map[uint64]map[string]map[string]bool)
+	latest := make(map[string]chainObservation)
+	for _, o := range obs {
+		if blocks[o.height] == nil {
+			blocks[o.height] = make(map[string]map[string]bool)
+		}
+		if blocks[o.height][o.blockID] == nil {
+			blocks[o.height][o.blockID] = make(map[string]bool)
+		}
+		blocks[o.height][o.blockID][o.endpoint] = true
+		if l, ok := latest[o.endpoint]; !ok || o.at.After(l.at) {
+			latest[o.endpoint] = o
+		}
+	}
+
+	// majority returns the block most nodes reported at height
+	majority := func(height uint64) (string, int) {
+		var best string
+		var count int
+		for id, endpoints := range blocks[height] {
+			if len(endpoints) > count || (len(endpoints) == count && id < best) {
+				best, count = id, len(endpoints)
+			}
+		}
+		return best, count
+	}
+
+	behind := func(height uint64) bool {
+		return median > height && median-height > forkStuckLag
+	}
+
+	afterHardFork := func(height uint64) (uint64, bool) {
+		for _, hf := range hardForks {
+			if height >= hf && height < hf+hardForkWindow {
+				return hf, true
+			}
+		}
+		return 0, false
+	}
+
+	alerts := make(map[string]*database.ForkAlert)
+	add := func(a *database.ForkAlert) {
+		key := fmt.Sprintf("%s/%d/%s", a.Kind, a.Height, a.BlockID)
+		if _, ok := alerts[key]; !ok {
+			sort.Strings(a.Nodes)
+			alerts[key] = a
+		}
+	}
+
+	for height, ids := range blocks {
+		if len(ids) < 2 {
+			continue
+		}
+		majorityID, majorityCount := majority(height)
+
+		for id, endpoints := range ids {
+			if id == majorityID {
+				continue
+			}
+
+			// A node that raced on a competing block but has since reported
+			// the majority chain at a later height has rejoined
+			var nodes []string
+			stuck := true
+			for endpoint := range endpoints {
+				l := latest[endpoint]
+				if l.height > height {
+					if m, _ := majority(l.height); m == l.blockID {
+						continue
+					}
+				}
+				nodes = append(nodes, endpoint)
+				if l.height != height || l.blockID != id || !behind(height) {
+					stuck = false
+				}
+			}
+			if len(nodes) == 0 {
+				continue
+			}
+
+			a := &database.ForkAlert{
+				Height:          height,
+				BlockID:         id,
+				MajorityBlockID: majorityID,
+				MajorityNodes:   majorityCount,
+				Nodes:           nodes,
+			}
+			if hf, ok := afterHardFork(height); ok {
+				a.Kind = database.ForkHardForkDivergence
+				a.Detail = fmt.Sprintf("%d node(s) split from %d others %d blocks after the hard fork at %d",
+					len(nodes), majorityCount, height-hf, hf)
+			} else if stuck {
+				a.Kind = database.ForkOrphanedTip
+				a.Detail = fmt.Sprintf("%d node(s) stuck on an orphaned block at %d, %d blocks behind the network",
+					len(nodes), height, median-height)
+			} else {
+				a.Kind = database.ForkMinorityChain
+				a.Detail = fmt.Sprintf("%d node(s) report a different block than %d others at %d",
+					len(nodes), majorityCount, height)
+			}
+			add(a)
+		}
+	}
+
+	// Nodes that stopped right at a hard fork the network has passed are
+	// usually running a release that doesn't know the new rules
+	for _, hf := range hardForks {
+		if !behind(hf) {
+			continue
+		}
+		type tip struct {
+			height  uint64
+			blockID string
+		}
+		stalled := make(map[tip][]string)
+		for endpoint, l := range latest {
+			if l.height+2 >= hf && l.height <= hf+1 && behind(l.height) {
+				t := tip{l.height, l.blockID}
+				stalled[t] = append(stalled[t], endpoint)
+			}
+		}
+		for t, nodes := range stalled {
+			majorityID, majorityCount := majority(t.height)
+			add(&database.ForkAlert{
+				Kind:            database.ForkHardForkDivergence,
+				Height:          t.height,
+				BlockID:         t.blockID,
+				MajorityBlockID: majorityID,
+				MajorityNodes:   majorityCount,
+				Nodes:           nodes,
+				Detail: fmt.Sprintf("%d node(s) stalled at the hard fork at %d while the network is at %d",
+					len(nodes), hf, median),
+			})
+		}
+	}
+
+	result := make([]*database.ForkAlert, 0, len(alerts))
+	for _, a := range alerts {
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Height > result[j].Height })
+	return result
+}
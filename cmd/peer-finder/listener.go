@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Function to advertise the listener's port in our handshakes so remote
+// nodes add us to their peer lists and connect back. Must run before any
+// goroutine uses p2pConfig.
+func advertiseListenPort(addr string) {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		log.Warn().Err(err).Str("addr", addr).Msg("Cannot parse P2P listen address")
+		return
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		log.Warn().Err(err).Str("addr", addr).Msg("Cannot parse P2P listen port")
+		return
+	}
+	p2pConfig.MyPort = uint32(port)
+}
+
+// Function to accept inbound Levin handshakes and record who connects to us
+func startP2PListener(ctx context.Context, addr string, record func(*discoveredNode)) {
+	server := p2p.NewServer(p2pConfig, 5*time.Minute, func(remote *net.TCPAddr, req *p2p.HandshakeRequest) {
+		ip := remote.IP.String()
+		log.Info().
+			Str("ip", ip).
+			Uint64("peerId", req.NodeData.PeerID).
+			Uint32("myPort", req.NodeData.MyPort).
+			Str("version", req.PayloadData.ClientVersion).
+			Msg("Inbound handshake")
+
+		// The remote port is ephemeral; the node listens on the one it
+		// announces, and announces 0 when it accepts no connections. There
+		// is no endpoint to record for such a node.
+		if req.NodeData.MyPort == 0 {
+			return
+		}
+		record(&discoveredNode{ip: ip, port: int(req.NodeData.MyPort), source: sourceInbound, handshake: true, nodeData: req.NodeData, syncData: req.PayloadData})
+	})
+
+	if err := server.ListenAndServe(ctx, addr); err != nil {
+		log.Error().Err(err).Str("addr", addr).Msg("P2P listener failed")
+	}
+}
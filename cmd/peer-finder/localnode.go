@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/zanorpc"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How often the local daemon's RPC is polled
+const localNodePollInterval = 15 * time.Second
+
+// LocalNodeStatus is the websocket payload describing the zanod we run
+type LocalNodeStatus struct {
+	Type             string    `json:"type"` // Always "local_node", to tell it apart from node updates
+	RPC              string    `json:"rpc"`
+	Reachable        bool      `json:"reachable"`
+	Error            string    `json:"error,omitempty"`
+	Version          string    `json:"version,omitempty"`
+	State            string    `json:"state"`
+	Synchronized     bool      `json:"synchronized"`
+	Height           uint64    `json:"height"`
+	MaxNetSeenHeight uint64    `json:"maxNetSeenHeight"`
+	Outgoing         uint64    `json:"outgoingConnections"`
+	Incoming         uint64    `json:"incomingConnections"`
+	WhitePeers       uint64    `json:"whitePeerlistSize"`
+	GreyPeers        uint64    `json:"greyPeerlistSize"`
+	Hashrate         uint64    `json:"networkHashrate"`
+	LastBlockTime    time.Time `json:"lastBlockTime"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+var (
+	// localRPC is the RPC client for the zanod we run
+	localRPC *zanorpc.Client
+
+	localStatusMux sync.RWMutex
+	localStatus    *LocalNodeStatus
+)
+
+// Function to get the most recent local daemon status, nil before the first poll
+func currentLocalStatus() *LocalNodeStatus {
+	localStatusMux.RLock()
+	defer localStatusMux.RUnlock()
+	return localStatus
+}
+
+// Function to periodically poll the local daemon and broadcast its status.
+// p2pAddr is the daemon's P2P endpoint, handshaken with for its version.
+func startLocalNodeMonitor(ctx context.Context, p2pAddr string) {
+	ticker := time.NewTicker(localNodePollInterval)
+	defer ticker.Stop()
+
+	log.Info().Str("rpc", localRPC.URL()).Str("p2p", p2pAddr).Msg("Starting local node monitor...")
+	var version string
+	for {
+		status := pollLocalNode(ctx)
+
+		// getinfo doesn't carry the daemon's version, but its handshake does.
+		// Ask once per daemon lifetime.
+		if !status.Reachable {
+			version = ""
+		} else if version == "" {
+			version = localNodeVersion(ctx, p2pAddr)
+		}
+		status.Version = version
+
+		localStatusMux.Lock()
+		localStatus = status
+		localStatusMux.Unlock()
+		broadcastMessage(status)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Local node monitor stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Function to fetch getinfo from the local daemon
+func pollLocalNode(ctx context.Context) *LocalNodeStatus {
+	status := &LocalNodeStatus{
+		Type:      "local_node",
+		RPC:       localRPC.URL(),
+		UpdatedAt: time.Now(),
+	}
+
+	info, err := localRPC.GetInfo(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Local node RPC unavailable")
+		status.Error = err.Error()
+		status.State = "unreachable"
+		return status
+	}
+
+	status.Reachable = true
+	status.State = info.DaemonNetworkState.String()
+	status.Synchronized = info.Synchronized()
+	status.Height = info.Height
+	status.MaxNetSeenHeight = info.MaxNetSeenHeight
+	status.Outgoing = info.OutgoingConnectionsCount
+	status.Incoming = info.IncomingConnectionsCount
+	status.WhitePeers = info.WhitePeerlistSize
+	status.GreyPeers = info.GreyPeerlistSize
+	status.Hashrate = info.NetworkHashrate50
+	status.LastBlockTime = info.LastBlockTime()
+	return status
+}
+
+// Function to build the local daemon's P2P endpoint from the host of its
+// RPC address and the port it listens on for peers
+func localNodeP2PAddr(rpcURL string, port int) string {
+	host := "127.0.0.1"
+	if u, err := url.Parse(rpcURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Function to read the local daemon's version from a P2P handshake
+func localNodeVersion(ctx context.Context, addr string) string {
+	peer, err := p2p.Connect(ctx, addr, p2pConfig)
+	if err != nil {
+		log.Debug().Err(err).Str("addr", addr).Msg("Could not handshake with local node")
+		return ""
+	}
+	peer.Close()
+	return peer.Handshake.PayloadData.ClientVersion
+}
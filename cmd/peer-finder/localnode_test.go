@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"zano-peer-finder/internal/network"
+)
+
+func TestLocalNodeP2PAddr(t *testing.T) {
+	activeNetwork = &network.Mainnet
+
+	tests := []struct {
+		args []string
+		rpc  string
+		want string
+	}{
+		{nil, "http://127.0.0.1:11211", "127.0.0.1:11121"},
+		{[]string{"--p2p-bind-port=11131"}, "http://127.0.0.1:11211", "127.0.0.1:11131"},
+		{[]string{"--p2p-bind-port", "11141"}, "http://10.0.0.5:11211", "10.0.0.5:11141"},
+		{[]string{"--p2p-bind-port", "bogus"}, "http://[::1]:11211", "[::1]:11121"},
+	}
+	for _, tc := range tests {
+		cfg := zanodConfig{Args: tc.args}
+		if got := localNodeP2PAddr(tc.rpc, cfg.p2pPort()); got != tc.want {
+			t.Errorf("args %v and RPC %s gave %s, want %s", tc.args, tc.rpc, got, tc.want)
+		}
+	}
+}
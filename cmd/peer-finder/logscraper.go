@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/discovery"
+	"zano-peer-finder/internal/zanolog"
+
+	"github.com/rs/zerolog/log"
+)
+
+// logScraper is the discovery source that finds peer IPs in zanod output,
+// from the supervised process's pipes or a followed log file. One scraper
+// outlives every zanod restart so its saved peers carry over.
+type logScraper struct {
+	db *database.DB
+
+	mu              sync.Mutex
+	emit            discovery.Emit // Set by Start; lines read before it are dropped
+	discoveredPeers map[database.SavedPeer]bool
+	stop            context.CancelFunc
+	done            chan struct{}
+}
+
+// Function to create a log scraper seeded with the saved peers
+func newLogScraper(db *database.DB, savedPeers []database.SavedPeer) *logScraper {
+	s := &logScraper{
+		db:              db,
+		discoveredPeers: make(map[database.SavedPeer]bool),
+	}
+	for _, peer := range savedPeers {
+		s.discoveredPeers[peer] = true
+	}
+	return s
+}
+
+// Name implements discovery.Source
+func (s *logScraper) Name() string { return "log" }
+
+// Start implements discovery.Source. Output is read by the supervisor or
+// the log tailer; Start only routes what they find to emit and saves the
+// discovered peers every minute.
+func (s *logScraper) Start(ctx context.Context, emit discovery.Emit) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.emit = emit
+	s.stop = cancel
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.savePeers()
+				return
+			case <-ticker.C:
+				s.savePeers()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop implements discovery.Source
+func (s *logScraper) Stop() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.emit = nil
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// Function to save discovered peers to the database
+func (s *logScraper) savePeers() {
+	s.mu.Lock()
+	peers := make([]database.SavedPeer, 0, len(s.discoveredPeers))
+	for peer := range s.discoveredPeers {
+		peers = append(peers, peer)
+	}
+	s.mu.Unlock()
+
+	if err := s.db.SavePeers(peers); err != nil {
+		log.Error().Err(err).Msg("Error saving peers to database")
+	} else {
+		log.Debug().Int("peerCount", len(peers)).Msg("Saved peers to database")
+	}
+}
+
+// Function to process output until reader is exhausted or ctx is cancelled
+func (s *logScraper) processOutput(ctx context.Context, reader io.Reader, prefix string) {
+	scanner := bufio.NewScanner(reader)
+	// Set a larger buffer size for the scanner
+	const maxCapacity = 1024 * 1024 // 1MB
+	buf := make([]byte, maxCapacity)
+	scanner.Buffer(buf, maxCapacity)
+	scanner.Split(customSplit)
+
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			// Log the line for debugging
+			log.Debug().Str("prefix", prefix).Str("line", line).Msg("Node output")
+			s.processLine(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Str("prefix", prefix).Msg("Error reading output")
+	}
+}
+
+// Function to report the peer event in a line, if there is one
+func (s *logScraper) processLine(line string) {
+	ev, ok := zanolog.Parse(line)
+	if !ok {
+		return
+	}
+
+	// An inbound connection's port is the peer's ephemeral one and the log
+	// never names the port it listens on, if any
+	if ev.Direction == zanolog.DirectionInbound {
+		return
+	}
+	port := ev.Port
+	if port == 0 {
+		port = activeNetwork.P2PPort
+	}
+
+	s.mu.Lock()
+	s.discoveredPeers[database.SavedPeer{IP: ev.IP, Port: port}] = true
+	emit := s.emit
+	s.mu.Unlock()
+
+	if emit != nil {
+		emit(discovery.Sighting{
+			IP:         ev.IP,
+			Port:       port,
+			Source:     s.Name(),
+			ObservedAt: time.Now(),
+			Event:      string(ev.Type),
+		})
+	}
+}
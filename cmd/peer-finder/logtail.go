@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How often the tailer checks a quiet log file for new data, rotation
+// and truncation
+const logTailPoll = 500 * time.Millisecond
+
+// logTailer follows a log file like tail -F. It implements io.Reader so
+// it can be fed to the same scraper as zanod's pipes. Reads block until
+// data arrives and return io.EOF once ctx is cancelled.
+//
+// A rotated file (renamed or removed and recreated) is drained to its end
+// before the new file is opened and read from the start. A file that
+// shrinks below the read offset was truncated and is read again from the
+// start.
+type logTailer struct {
+	ctx  context.Context
+	path string
+
+	file   *os.File
+	info   os.FileInfo // Identity of the open file
+	offset int64
+}
+
+// Function to create a tailer for path. Reading starts at the current end
+// of the file so old entries aren't replayed on every start; a file that
+// doesn't exist yet is read from the start once it appears.
+func newLogTailer(ctx context.Context, path string) *logTailer {
+	t := &logTailer{ctx: ctx, path: path}
+	if err := t.open(true); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("Zanod log file not available yet, waiting for it")
+	}
+	return t
+}
+
+// open opens the file at path, seeking to its end if atEnd is set
+func (t *logTailer) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var offset int64
+	if atEnd {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	t.file, t.info, t.offset = f, info, offset
+	log.Info().Str("path", t.path).Int64("offset", offset).Msg("Following zanod log file")
+	return nil
+}
+
+// Close releases the open file
+func (t *logTailer) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// Read implements io.Reader
+func (t *logTailer) Read(p []byte) (int, error) {
+	for {
+		if t.ctx.Err() != nil {
+			return 0, io.EOF
+		}
+
+		if t.file == nil {
+			if err := t.open(false); err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					log.Error().Err(err).Str("path", t.path).Msg("Error opening zanod log file")
+				}
+				if !t.wait() {
+					return 0, io.EOF
+				}
+				continue
+			}
+		}
+
+		n, err := t.file.Read(p)
+		t.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		// At the end of the open file: see whether the path still refers
+		// to it and whether it shrank
+		current, err := os.Stat(t.path)
+		switch {
+		case err != nil && errors.Is(err, os.ErrNotExist):
+			// Rotated away and not recreated yet. Keep the old file open,
+			// a writer may still append to it.
+		case err != nil:
+			log.Error().Err(err).Str("path", t.path).Msg("Error checking zanod log file")
+		case !os.SameFile(t.info, current):
+			log.Info().Str("path", t.path).Msg("Zanod log file rotated, reopening")
+			t.Close()
+			continue
+		case current.Size() < t.offset:
+			log.Info().Str("path", t.path).Msg("Zanod log file truncated, reading from the start")
+			if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+				log.Error().Err(err).Str("path", t.path).Msg("Error rewinding zanod log file")
+				t.Close()
+			}
+			t.offset = 0
+			continue
+		}
+
+		if !t.wait() {
+			return 0, io.EOF
+		}
+	}
+}
+
+// wait sleeps for one poll interval, returning false if ctx was cancelled
+func (t *logTailer) wait() bool {
+	select {
+	case <-t.ctx.Done():
+		return false
+	case <-time.After(logTailPoll):
+		return true
+	}
+}
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
@@ -20,8 +19,14 @@ import (
 	"syscall"
 	"time"
 
+	"zano-peer-finder/internal/addrclass"
+	"zano-peer-finder/internal/crawler"
 	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/discovery"
 	"zano-peer-finder/internal/ipinfo"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/zanorpc"
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
@@ -94,7 +99,10 @@ func init() {
 }
 
 type NodeInfo struct {
+	Network     string    `json:"network"`
 	IP          string    `json:"ip"`
+	Port        int       `json:"port"`
+	Endpoint    string    `json:"endpoint"` // ip:port, the node's identity
 	Country     string    `json:"country"`
 	City        string    `json:"city"`
 	Lat         float64   `json:"lat"`
@@ -119,6 +127,81 @@ type NodeInfo struct {
 	Hosting     bool      `json:"hosting"`
 	IsOnline    bool      `json:"isOnline"`
 	LastPing    time.Time `json:"lastPing"`
+
+	PeerID        string    `json:"peerId,omitempty"`
+	MyPort        int       `json:"myPort,omitempty"`
+	NetworkID     string    `json:"networkId,omitempty"`
+	ClientVersion string    `json:"clientVersion,omitempty"`
+	TopHeight     uint64    `json:"topHeight,omitempty"`
+	TopBlockID    string    `json:"topBlockId,omitempty"`
+	LocalTime     int64     `json:"localTime,omitempty"`
+	LastHandshake time.Time `json:"lastHandshake"`
+	SyncLag       int64     `json:"syncLag"` // Blocks behind the network median
+
+	PublicRPC       bool      `json:"publicRpc"`
+	RPCPort         int       `json:"rpcPort,omitempty"`
+	RPCHeight       uint64    `json:"rpcHeight,omitempty"`
+	RPCSynchronized bool      `json:"rpcSynchronized"`
+	RPCLatency      int64     `json:"rpcLatency,omitempty"` // Milliseconds
+	LastRPCCheck    time.Time `json:"lastRpcCheck"`
+
+	LogEvent   string    `json:"logEvent,omitempty"`
+	LogEventAt time.Time `json:"logEventAt"`
+
+	AddressClass string `json:"addressClass,omitempty"` // Set for allowed non-public addresses
+}
+
+// Function to build the websocket payload for a node
+func newNodeInfo(node *database.Node) *NodeInfo {
+	return &NodeInfo{
+		Network:       node.Network,
+		IP:            node.IP,
+		Port:          node.Port,
+		Endpoint:      nodeEndpoint(node.IP, node.Port),
+		Country:       node.Country,
+		City:          node.City,
+		Lat:           node.Lat,
+		Lon:           node.Lon,
+		ISP:           node.ISP,
+		LastSeen:      node.LastSeen,
+		IsNew:         false,
+		Region:        node.Region,
+		RegionName:    node.RegionName,
+		Timezone:      node.Timezone,
+		Zip:           node.Zip,
+		AS:            node.AS,
+		Org:           node.Org,
+		Query:         node.Query,
+		Status:        node.Status,
+		CountryCode:   node.CountryCode,
+		District:      node.District,
+		Continent:     node.Continent,
+		Currency:      node.Currency,
+		Mobile:        node.Mobile,
+		Proxy:         node.Proxy,
+		Hosting:       node.Hosting,
+		IsOnline:      node.IsOnline,
+		LastPing:      node.LastPing,
+		PeerID:        node.PeerID,
+		MyPort:        node.MyPort,
+		NetworkID:     node.NetworkID,
+		ClientVersion: node.ClientVersion,
+		TopHeight:     node.TopHeight,
+		TopBlockID:    node.TopBlockID,
+		LocalTime:     node.LocalTime,
+		LastHandshake: node.LastHandshake,
+		SyncLag:       syncLag(node.TopHeight),
+
+		PublicRPC:       node.PublicRPC,
+		RPCPort:         node.RPCPort,
+		RPCHeight:       node.RPCHeight,
+		RPCSynchronized: node.RPCSynchronized,
+		RPCLatency:      node.RPCLatency,
+		LastRPCCheck:    node.LastRPCCheck,
+		LogEvent:        node.LogEvent,
+		LogEventAt:      node.LogEventAt,
+		AddressClass:    addressClassTag(node.IP),
+	}
 }
 
 var (
@@ -154,16 +237,21 @@ func customSplit(data []byte, atEOF bool) (advance int, token []byte, err error)
 
 // Function to broadcast node updates to all connected clients
 func broadcastNodeUpdate(node *NodeInfo) {
-	clientsMux.RLock()
-	defer clientsMux.RUnlock()
-
 	log.Debug().
-		Str("ip", node.IP).
-		Int("clientCount", len(clients)).
+		Str("endpoint", node.Endpoint).
 		Msg("Broadcasting node update")
 
+	broadcastMessage(node)
+}
+
+// Function to send a message to all connected clients. The exclusive lock
+// keeps writers from interleaving on a connection and guards the deletes.
+func broadcastMessage(v interface{}) {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+
 	for client := range clients {
-		err := client.WriteJSON(node)
+		err := client.WriteJSON(v)
 		if err != nil {
 			log.Error().Err(err).Msg("Error broadcasting to client")
 			client.Close()
@@ -204,42 +292,31 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, db *database.DB) {
 			Time("lastSeen", node.LastSeen).
 			Msg("Converting node to NodeInfo")
 
-		nodeInfos[i] = &NodeInfo{
-			IP:          node.IP,
-			Country:     node.Country,
-			City:        node.City,
-			Lat:         node.Lat,
-			Lon:         node.Lon,
-			ISP:         node.ISP,
-			LastSeen:    node.LastSeen,
-			IsNew:       false,
-			Region:      node.Region,
-			RegionName:  node.RegionName,
-			Timezone:    node.Timezone,
-			Zip:         node.Zip,
-			AS:          node.AS,
-			Org:         node.Org,
-			Query:       node.Query,
-			Status:      node.Status,
-			CountryCode: node.CountryCode,
-			District:    node.District,
-			Continent:   node.Continent,
-			Currency:    node.Currency,
-			Mobile:      node.Mobile,
-			Proxy:       node.Proxy,
-			Hosting:     node.Hosting,
-			IsOnline:    node.IsOnline,
-			LastPing:    node.LastPing,
-		}
-	}
-
-	// Send the array as a single message
-	if err := conn.WriteJSON(nodeInfos); err != nil {
+		nodeInfos[i] = newNodeInfo(node)
+	}
+
+	// Send the array as a single message. The conn is already registered,
+	// so broadcasts may write to it concurrently; the lock keeps writes apart.
+	clientsMux.Lock()
+	err = conn.WriteJSON(nodeInfos)
+	clientsMux.Unlock()
+	if err != nil {
 		log.Error().Err(err).Msg("Error sending initial node list to client")
 		return
 	}
 	log.Info().Int("nodeCount", len(nodeInfos)).Msg("Sent initial node list to client")
 
+	// Send the local node status so the panel fills in before the next poll
+	if status := currentLocalStatus(); status != nil {
+		clientsMux.Lock()
+		err := conn.WriteJSON(status)
+		clientsMux.Unlock()
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending local node status to client")
+			return
+		}
+	}
+
 	// Handle incoming messages
 	for {
 		_, message, err := conn.ReadMessage()
@@ -257,6 +334,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, db *database.DB) {
 			Type string `json:"type"`
 			Data struct {
 				IP       string    `json:"ip"`
+				Port     int       `json:"port"`
 				IsOnline bool      `json:"isOnline"`
 				LastPing time.Time `json:"lastPing"`
 				Latency  int64     `json:"latency"`
@@ -272,211 +350,188 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, db *database.DB) {
 		if msg.Type == "status_update" {
 			log.Info().
 				Str("ip", msg.Data.IP).
+				Int("port", msg.Data.Port).
 				Bool("isOnline", msg.Data.IsOnline).
 				Time("lastPing", msg.Data.LastPing).
 				Int64("latency", msg.Data.Latency).
 				Msg("Received status update from client")
 
 			// Update the node status in the database
-			if err := db.UpdateNodeStatus(msg.Data.IP, msg.Data.IsOnline); err != nil {
+			if err := db.UpdateNodeStatus(msg.Data.IP, msg.Data.Port, msg.Data.IsOnline); err != nil {
 				log.Error().Err(err).Str("ip", msg.Data.IP).Msg("Error updating node status")
 				continue
 			}
 
 			// Get the full node information from the database
-			node, err := db.GetNode(msg.Data.IP)
-			if err != nil {
-				log.Error().Err(err).Str("ip", msg.Data.IP).Msg("Error getting node information for broadcast")
+			node, err := db.GetNode(msg.Data.IP, msg.Data.Port)
+			if err != nil || node == nil {
+				log.Error().Err(err).Str("ip", msg.Data.IP).Int("port", msg.Data.Port).Msg("Error getting node information for broadcast")
 				continue
 			}
 
 			// Broadcast the update to all clients
-			nodeInfo := &NodeInfo{
-				IP:          node.IP,
-				Country:     node.Country,
-				City:        node.City,
-				Lat:         node.Lat,
-				Lon:         node.Lon,
-				ISP:         node.ISP,
-				LastSeen:    node.LastSeen,
-				IsNew:       false,
-				Region:      node.Region,
-				RegionName:  node.RegionName,
-				Timezone:    node.Timezone,
-				Zip:         node.Zip,
-				AS:          node.AS,
-				Org:         node.Org,
-				Query:       node.Query,
-				Status:      node.Status,
-				CountryCode: node.CountryCode,
-				District:    node.District,
-				Continent:   node.Continent,
-				Currency:    node.Currency,
-				Mobile:      node.Mobile,
-				Proxy:       node.Proxy,
-				Hosting:     node.Hosting,
-				IsOnline:    node.IsOnline,
-				LastPing:    node.LastPing,
-			}
+			nodeInfo := newNodeInfo(node)
 			broadcastNodeUpdate(nodeInfo)
 		}
 	}
 }
 
-// Function to start the Zano node
-func startZanoNode(ctx context.Context, wd string) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
-	// Get absolute path to the zanod binary
-	zanodPath := filepath.Join(wd, "zano", "zanod")
-	zanodPath, err := filepath.Abs(zanodPath)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error getting absolute path: %v", err)
+// Function to ping a node with the given probes and update its status. A
+// probe cut short by shutdown leaves the status as it was.
+func pingNodeWith(ctx context.Context, ip string, port int, db *database.DB, probes []string) bool {
+	log.Info().Str("ip", ip).Int("port", port).Strs("probes", probes).Msg("Pinging node")
+
+	isOnline, probe := probeNode(ctx, ip, port, probes)
+	if !isOnline && ctx.Err() != nil {
+		return false
 	}
-	log.Info().Str("path", zanodPath).Msg("Zanod binary path")
 
-	// Check if the binary exists and is executable
-	if info, err := os.Stat(zanodPath); err != nil {
-		return nil, nil, nil, fmt.Errorf("error checking zanod binary: %v", err)
-	} else {
-		log.Info().Str("mode", info.Mode().String()).Msg("Zanod binary permissions")
+	// Update node status in database
+	if err := db.UpdateNodeStatus(ip, port, isOnline); err != nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error updating node status")
+		return false
+	}
+	if probe == probeLevin {
+		if err := db.UpdateNodeLevinPing(ip, port, time.Now().UTC()); err != nil {
+			log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error saving Levin ping")
+		}
 	}
 
-	// Command to start the Zano node directly
-	log.Info().Msg("Starting Zano node...")
-	cmd := exec.CommandContext(ctx, zanodPath, "--log-level", "2", "--rpc-bind-ip", "127.0.0.1", "--rpc-bind-port", "11211", "--no-console")
-	cmd.Dir = wd // Set the working directory
+	if isOnline {
+		log.Info().Str("ip", ip).Int("port", port).Str("probe", probe).Msg("Node is ONLINE")
+	} else {
+		log.Info().Str("ip", ip).Int("port", port).Msg("Node is OFFLINE")
+	}
 
-	// Create pipes to capture both stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	// Get the full node information from the database
+	node, err := db.GetNode(ip, port)
+	if err != nil || node == nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error getting node information for broadcast")
+		return false
 	}
 
-	stderr, err := cmd.StderrPipe()
+	// Broadcast status update with full node information
+	nodeInfo := newNodeInfo(node)
+	nodeInfo.IsOnline = isOnline
+	nodeInfo.LastPing = time.Now()
+	broadcastNodeUpdate(nodeInfo)
+
+	return isOnline
+}
+
+// Function to enrich a discovered endpoint with its IP's geolocation, save
+// it and broadcast it. An IP already geolocated for another endpoint isn't
+// looked up again. observedAt is when the source saw the endpoint.
+func recordDiscoveredIP(ctx context.Context, ip string, port int, observedAt time.Time, db *database.DB, ipService *ipinfo.Service, rateLimiter *RateLimiter) {
+	log.Info().Str("ip", ip).Int("port", port).Msg("Found new endpoint")
+	// Check if we already have this endpoint in the database
+	existingNode, err := db.GetNode(ip, port)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error creating stderr pipe: %v", err)
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error checking node in database")
+		return
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return nil, nil, nil, fmt.Errorf("error starting command: %v", err)
+	// If node exists and was updated recently, skip
+	if existingNode != nil && time.Since(existingNode.LastSeen) < 5*time.Minute {
+		log.Debug().Str("ip", ip).Int("port", port).Time("lastSeen", existingNode.LastSeen).Msg("Skipping recently updated node")
+		return
 	}
 
-	// Monitor the context cancellation
-	go func() {
-		<-ctx.Done()
-		if cmd.Process != nil {
-			log.Info().Msg("Context cancelled, terminating Zano node...")
-			// First try SIGTERM
-			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
-				log.Error().Err(err).Msg("Error sending SIGTERM to Zano node")
-				// If SIGTERM fails, try SIGKILL
-				if err := cmd.Process.Kill(); err != nil {
-					log.Error().Err(err).Msg("Error force killing Zano node")
-				}
-			}
-		}
-	}()
-
-	// Monitor process exit
-	go func() {
-		err := cmd.Wait()
+	geo, err := db.GetGeo(ip)
+	if err != nil {
+		log.Error().Err(err).Str("ip", ip).Msg("Error checking IP geolocation in database")
+		return
+	}
+	if class := addrclass.Classify(net.ParseIP(ip)); class != addrclass.Public {
+		// Allowed non-public addresses have no location to look up
+		log.Debug().Str("ip", ip).Str("class", string(class)).Msg("Saving non-public address without geolocation")
+		geo = &database.Geo{}
+	} else if geo == nil {
+		// Wait for rate limiter before making API call
+		rateLimiter.Wait()
+
+		// Get IP information
+		log.Info().Str("ip", ip).Msg("Getting IP info")
+		ipInfo, err := ipService.GetIPInfo(ip)
 		if err != nil {
-			// Read stderr to get error details
-			stderrBytes, _ := io.ReadAll(stderr)
-			if len(stderrBytes) > 0 {
-				log.Error().
-					Err(err).
-					Str("stderr", string(stderrBytes)).
-					Msg("Zano node process failed")
-			} else {
-				log.Error().Err(err).Msg("Zano node process failed")
+			if err.Error() == "rate limit exceeded" {
+				log.Warn().Msg("Rate limit exceeded, waiting...")
+				time.Sleep(time.Minute)
+				return
 			}
+			log.Error().Err(err).Str("ip", ip).Msg("Error getting IP info")
+			return
 		}
-	}()
-
-	log.Info().Int("pid", cmd.Process.Pid).Msg("Started zanod process")
-	return cmd, stdout, stderr, nil
-}
-
-// Function to ping a node and update its status
-func pingNode(ip string, db *database.DB) bool {
-	log.Info().Str("ip", ip).Msg("Pinging node")
-
-	// Try TCP connection to Zano RPC port
-	isOnline := false
-	rpcPort := "11211" // Zano RPC port
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%s", ip, rpcPort), 5*time.Second)
-	if err == nil {
-		conn.Close()
-		isOnline = true
-		log.Info().Str("ip", ip).Str("port", rpcPort).Msg("TCP connection successful")
-	} else {
-		log.Debug().Str("ip", ip).Str("port", rpcPort).Err(err).Msg("TCP connection failed")
-
-		// If TCP fails, try ICMP ping
-		cmd := exec.Command("ping", "-c", "1", "-W", "5", ip)
-		if err := cmd.Run(); err == nil {
-			isOnline = true
-			log.Info().Str("ip", ip).Msg("ICMP ping successful")
-		} else {
-			log.Debug().Str("ip", ip).Msg("Both TCP and ICMP ping failed")
+		if ipInfo.Status != "success" {
+			return
+		}
+		log.Info().Str("ip", ip).Msg("Successfully got IP info")
+		geo = &database.Geo{
+			Country:     ipInfo.Country,
+			City:        ipInfo.City,
+			Lat:         ipInfo.Lat,
+			Lon:         ipInfo.Lon,
+			ISP:         ipInfo.ISP,
+			Region:      ipInfo.Region,
+			RegionName:  ipInfo.RegionName,
+			Timezone:    ipInfo.Timezone,
+			Zip:         ipInfo.Zip,
+			AS:          ipInfo.AS,
+			Org:         ipInfo.Org,
+			Query:       ipInfo.Query,
+			Status:      ipInfo.Status,
+			CountryCode: ipInfo.CountryCode,
+			District:    ipInfo.District,
+			Continent:   ipInfo.Continent,
+			Currency:    ipInfo.Currency,
+			Mobile:      ipInfo.Mobile,
+			Proxy:       ipInfo.Proxy,
+			Hosting:     ipInfo.Hosting,
 		}
 	}
 
-	// Update node status in database
-	if err := db.UpdateNodeStatus(ip, isOnline); err != nil {
-		log.Error().Err(err).Str("ip", ip).Msg("Error updating node status")
-		return false
+	// A late report, such as a replayed log line, doesn't move LastSeen back
+	lastSeen := observedAt
+	if existingNode != nil && existingNode.LastSeen.After(lastSeen) {
+		lastSeen = existingNode.LastSeen
 	}
 
-	if isOnline {
-		log.Info().Str("ip", ip).Msg("Node is ONLINE")
-	} else {
-		log.Info().Str("ip", ip).Msg("Node is OFFLINE")
-	}
-
-	// Get the full node information from the database
-	node, err := db.GetNode(ip)
-	if err != nil {
-		log.Error().Err(err).Str("ip", ip).Msg("Error getting node information for broadcast")
-		return false
+	// Create node info
+	node := &database.Node{
+		IP:       ip,
+		Port:     port,
+		Geo:      *geo,
+		LastSeen: lastSeen,
+		IsOnline: false,
+		LastPing: time.Time{},
 	}
 
-	// Broadcast status update with full node information
-	nodeInfo := &NodeInfo{
-		IP:          node.IP,
-		Country:     node.Country,
-		City:        node.City,
-		Lat:         node.Lat,
-		Lon:         node.Lon,
-		ISP:         node.ISP,
-		LastSeen:    node.LastSeen,
-		IsNew:       false,
-		Region:      node.Region,
-		RegionName:  node.RegionName,
-		Timezone:    node.Timezone,
-		Zip:         node.Zip,
-		AS:          node.AS,
-		Org:         node.Org,
-		Query:       node.Query,
-		Status:      node.Status,
-		CountryCode: node.CountryCode,
-		District:    node.District,
-		Continent:   node.Continent,
-		Currency:    node.Currency,
-		Mobile:      node.Mobile,
-		Proxy:       node.Proxy,
-		Hosting:     node.Hosting,
-		IsOnline:    isOnline,
-		LastPing:    time.Now(),
+	// Save to database
+	if err := db.UpsertNode(node); err != nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error saving node to database")
+		return
 	}
+	log.Info().
+		Str("ip", ip).
+		Int("port", port).
+		Str("country", node.Country).
+		Str("city", node.City).
+		Str("isp", node.ISP).
+		Msg("Saved new node to database")
+
+	// Ping the node immediately
+	isOnline := pingNode(ctx, ip, port, db)
+
+	// Broadcast to all clients
+	nodeInfo := newNodeInfo(node)
+	nodeInfo.IsNew = existingNode == nil // Only true for newly discovered nodes
+	nodeInfo.IsOnline = isOnline
+	nodeInfo.LastPing = time.Now()
 	broadcastNodeUpdate(nodeInfo)
-
-	return isOnline
 }
 
 // Add ping worker function
-func startPingWorker(ctx context.Context, db *database.DB) {
+func startPingWorker(ctx context.Context, db *database.DB, classifier *addrclass.Classifier) {
 	// Perform initial ping on all nodes
 	log.Info().Msg("Performing initial ping on all nodes...")
 	nodes, err := db.GetAllNodes()
@@ -484,7 +539,9 @@ func startPingWorker(ctx context.Context, db *database.DB) {
 		log.Error().Err(err).Msg("Error getting nodes for initial ping")
 	} else {
 		for _, node := range nodes {
-			pingNode(node.IP, db)
+			if classifier.Accepts(node.IP) {
+				pingNode(ctx, node.IP, node.Port, db)
+			}
 		}
 	}
 
@@ -512,6 +569,12 @@ func startPingWorker(ctx context.Context, db *database.DB) {
 			skippedCount := 0
 
 			for _, node := range nodes {
+				// Skip nodes saved before their address was ignored
+				if !classifier.Accepts(node.IP) {
+					skippedCount++
+					continue
+				}
+
 				// Skip nodes that were pinged recently
 				if time.Since(node.LastPing) < 1*time.Minute {
 					log.Debug().
@@ -522,7 +585,7 @@ func startPingWorker(ctx context.Context, db *database.DB) {
 					continue
 				}
 
-				if pingNode(node.IP, db) {
+				if pingNode(ctx, node.IP, node.Port, db) {
 					onlineCount++
 				} else {
 					offlineCount++
@@ -555,11 +618,15 @@ func performNmapScan(ip string, ports string) (*NmapScanResult, error) {
 
 	// Default to common ports if none specified
 	if ports == "" {
-		ports = "20-25,80,443,11211"
+		ports = fmt.Sprintf("20-25,80,443,%d,%d", activeNetwork.P2PPort, activeNetwork.RPCPort)
 	}
 
 	// Construct nmap command
-	cmd := exec.Command("nmap", "-p", ports, "-sV", "-O", ip)
+	args := []string{"-p", ports, "-sV", "-O", ip}
+	if isIPv6(ip) {
+		args = append([]string{"-6"}, args...)
+	}
+	cmd := exec.Command("nmap", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Error().Err(err).Str("ip", ip).Msg("Nmap scan failed")
@@ -606,8 +673,66 @@ func performNmapScan(ip string, ports string) (*NmapScanResult, error) {
 }
 
 func main() {
+	networkName := flag.String("network", "mainnet", "Zano network to monitor (mainnet or testnet)")
+	networkID := flag.String("network-id", "", "Override the network's P2P network id (32 hex characters)")
+	seeds := flag.String("seeds", "", "Comma-separated host:port seed nodes, replacing the network's defaults")
+	p2pListen := flag.String("p2p-listen", "", "Address to accept inbound Levin connections on, e.g. :11121 (disabled if empty)")
+	crawlConcurrency := flag.Int("crawl-concurrency", 16, "Maximum simultaneous crawler connections")
+	crawlPerHost := flag.Int("crawl-per-host", 1, "Maximum simultaneous crawler connections to a single IP")
+	crawlTimeout := flag.Duration("crawl-timeout", 10*time.Second, "Timeout for each crawler connection and handshake")
+	crawlRevisit := flag.Duration("crawl-revisit", 30*time.Minute, "Wait before re-crawling a reachable endpoint")
+	zanodRPC := flag.String("zanod-rpc", "", "RPC address of the local zanod (default 127.0.0.1 on the network's RPC port)")
+	zanodLog := flag.String("zanod-log", "", "Follow this zanod log file instead of spawning zanod (attach mode)")
+	zanodBin := flag.String("zanod-bin", filepath.Join("zano", "zanod"), "Path to the zanod binary, relative to the working directory if not absolute")
+	zanodDataDir := flag.String("zanod-data-dir", "", "Data directory passed to zanod (zanod's default if empty)")
+	zanodLogLevel := flag.Int("zanod-log-level", 2, "Log level passed to zanod, 0 to 4")
+	var zanodArgs, zanodEnv stringList
+	flag.Var(&zanodArgs, "zanod-arg", "Extra zanod flag, e.g. --add-priority-node=1.2.3.4:11121 (repeatable)")
+	flag.Var(&zanodEnv, "zanod-env", "KEY=VALUE added to zanod's environment (repeatable)")
+	seedFile := flag.String("seed-file", "", "Text file of ip or ip:port endpoints to import, re-read when it changes")
+	dnsSeeds := flag.String("dns-seeds", "", "Comma-separated host names whose addresses are resolved as seed nodes")
+	zanodStopGrace := flag.Duration("zanod-stop-grace", 10*time.Second, "Time zanod gets to exit after SIGTERM before it is killed")
+	crawlMaxBackoff := flag.Duration("crawl-max-backoff", 12*time.Hour, "Longest wait before retrying an unresponsive endpoint")
+	crawlMaxEndpoints := flag.Int("crawl-max-endpoints", 50000, "Maximum endpoints the crawler tracks before ignoring newly advertised ones")
+	var ignoreCIDRs, publicIPs stringList
+	flag.Var(&ignoreCIDRs, "ignore-cidr", "CIDR range or IP whose addresses are never recorded, comma-separated (repeatable)")
+	flag.Var(&publicIPs, "public-ip", "This host's public IP, never recorded as a peer (repeatable, detected if not set)")
+	allowClasses := flag.String("allow-address-class", "", "Comma-separated non-public address classes to record without geolocation, e.g. private,loopback")
+	flag.Parse()
+
 	log.Info().Msg("Starting Zano peer finder...")
 
+	// Select the network profile
+	var err error
+	activeNetwork, err = network.Lookup(*networkName)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error selecting network")
+	}
+	if *networkID != "" {
+		if activeNetwork.NetworkID, err = network.ParseNetworkID(*networkID); err != nil {
+			log.Fatal().Err(err).Msg("Error parsing network id")
+		}
+	}
+	if *seeds != "" {
+		activeNetwork.Seeds = strings.Split(*seeds, ",")
+	}
+	p2pConfig = p2p.NewConfig(activeNetwork.NetworkID)
+	log.Info().
+		Str("network", activeNetwork.Name).
+		Int("p2pPort", activeNetwork.P2PPort).
+		Int("rpcPort", activeNetwork.RPCPort).
+		Int("seeds", len(activeNetwork.Seeds)).
+		Msg("Network selected")
+
+	if *p2pListen != "" {
+		advertiseListenPort(*p2pListen)
+	}
+
+	if *zanodRPC == "" {
+		*zanodRPC = net.JoinHostPort("127.0.0.1", strconv.Itoa(activeNetwork.RPCPort))
+	}
+	localRPC = zanorpc.New(*zanodRPC, 10*time.Second)
+
 	// Get the current working directory
 	wd, err := os.Getwd()
 	if err != nil {
@@ -615,12 +740,32 @@ func main() {
 	}
 	log.Info().Str("workingDir", wd).Msg("Working directory")
 
+	// Check the zanod launch configuration before anything is started
+	zanodCfg := zanodConfig{
+		Binary:   *zanodBin,
+		DataDir:  *zanodDataDir,
+		LogLevel: *zanodLogLevel,
+		Args:     splitZanodArgs(zanodArgs),
+		Env:      zanodEnv,
+	}
+	if *zanodLog == "" {
+		if err := zanodCfg.validate(wd); err != nil {
+			log.Fatal().Err(err).Msg("Invalid zanod configuration")
+		}
+	}
+
+	// Set up the address classifier that filters discovered IPs
+	classifier, err := newAddressFilter(ignoreCIDRs, publicIPs, *allowClasses)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid address filter")
+	}
+
 	// Initialize rate limiter (45 requests per minute = 0.75 requests per second)
 	rateLimiter := NewRateLimiter(0.75, 45)
 
 	// Initialize database
 	log.Info().Msg("Initializing database...")
-	db, err := database.New("nodes.db")
+	db, err := database.New("nodes.db", activeNetwork.Name)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error initializing database")
 	}
@@ -654,6 +799,19 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Learn our own public address unless it was given
+	if len(publicIPs) == 0 {
+		go detectPublicIP(ctx, classifier, ipService, rateLimiter)
+	}
+
+	// Create the Zano node supervisor; it is started after the web server.
+	// In attach mode zanod is managed elsewhere and only its log is read.
+	scraper := newLogScraper(db, savedPeers)
+	var supervisor *zanodSupervisor
+	if *zanodLog == "" {
+		supervisor = newZanodSupervisor(zanodCfg, *zanodStopGrace, scraper)
+	}
+
 	// Create HTTP server with timeout settings
 	server := &http.Server{
 		Addr:         ":8080",
@@ -698,269 +856,289 @@ func main() {
 		json.NewEncoder(w).Encode(result)
 	})
 
-	// Start web server in a goroutine
-	serverErr := make(chan error, 1)
-	go func() {
-		log.Info().Msg("Web server listening on :8080")
-		serverErr <- server.ListenAndServe()
-	}()
+	// Add height history endpoint. Without ?port= every endpoint on the IP
+	// is included.
+	http.HandleFunc("/api/nodes/heights", func(w http.ResponseWriter, r *http.Request) {
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			http.Error(w, "Missing ip parameter", http.StatusBadRequest)
+			return
+		}
+		port := 0
+		if p := r.URL.Query().Get("port"); p != "" {
+			var err error
+			if port, err = strconv.Atoi(p); err != nil {
+				http.Error(w, "Invalid port parameter", http.StatusBadRequest)
+				return
+			}
+		}
 
-	// Start Zano node in a separate goroutine
-	nodeStarted := make(chan error, 1)
-	go func() {
-		cmd, stdout, stderr, err := startZanoNode(ctx, wd)
+		samples, err := db.GetHeightSamples(ip, port, time.Now().Add(-24*time.Hour))
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to start Zano node")
-			nodeStarted <- err
+			log.Error().Err(err).Str("ip", ip).Msg("Error getting height samples")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Regular expression to match IP addresses with optional ports
-		ipRegex := regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(samples)
+	})
 
-		// WaitGroup to ensure all goroutines complete
-		var wg sync.WaitGroup
-		wg.Add(2)
+	// Add peer advertisement graph endpoint
+	http.HandleFunc("/api/graph", func(w http.ResponseWriter, r *http.Request) {
+		since := time.Now().Add(-24 * time.Hour)
+
+		var result interface{}
+		var err error
+		switch r.URL.Query().Get("view") {
+		case "", "edges":
+			result, err = db.GetAdvertisements(since)
+		case "unreachable":
+			result, err = db.GetUnreachableAdvertised(since)
+		case "staleness":
+			result, err = db.GetPeerlistStaleness(since)
+		default:
+			http.Error(w, "Unknown view", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Error querying peer graph")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-		// Function to process output
-		processOutput := func(reader io.Reader, prefix string, db *database.DB, ipService *ipinfo.Service) {
-			defer wg.Done()
-			scanner := bufio.NewScanner(reader)
-			// Set a larger buffer size for the scanner
-			const maxCapacity = 1024 * 1024 // 1MB
-			buf := make([]byte, maxCapacity)
-			scanner.Buffer(buf, maxCapacity)
-			scanner.Split(customSplit)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
 
-			// Keep track of recently processed IPs to avoid duplicates
-			recentIPs := make(map[string]time.Time)
-			recentIPsMutex := &sync.Mutex{}
+	// Add local node status endpoint
+	http.HandleFunc("/api/local-node", func(w http.ResponseWriter, r *http.Request) {
+		status := currentLocalStatus()
+		if status == nil {
+			http.Error(w, "Local node not polled yet", http.StatusServiceUnavailable)
+			return
+		}
 
-			// Keep track of discovered peers
-			discoveredPeers := make(map[string]bool)
-			for _, peer := range savedPeers {
-				discoveredPeers[peer] = true
-			}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
 
-			// Cleanup old entries every minute
-			go func() {
-				ticker := time.NewTicker(1 * time.Minute)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case <-ticker.C:
-						recentIPsMutex.Lock()
-						now := time.Now()
-						for ip, timestamp := range recentIPs {
-							if now.Sub(timestamp) > 5*time.Minute {
-								delete(recentIPs, ip)
-							}
-						}
-						recentIPsMutex.Unlock()
-
-						// Save discovered peers to database
-						peers := make([]string, 0, len(discoveredPeers))
-						for peer := range discoveredPeers {
-							peers = append(peers, peer)
-						}
-						if err := db.SavePeers(peers); err != nil {
-							log.Error().Err(err).Msg("Error saving peers to database")
-						} else {
-							log.Debug().Int("peerCount", len(peers)).Msg("Saved peers to database")
-						}
-					}
-				}
-			}()
+	// Add local daemon peers endpoint
+	http.HandleFunc("/api/local-node/peers", func(w http.ResponseWriter, r *http.Request) {
+		peers, err := db.GetDaemonPeers(time.Now().Add(-time.Hour))
+		if err != nil {
+			log.Error().Err(err).Msg("Error querying local daemon peers")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peers)
+	})
+
+	// Add public RPC node list, healthy nodes checked within the last hour
+	http.HandleFunc("/api/rpc-nodes", func(w http.ResponseWriter, r *http.Request) {
+		nodes, err := db.GetPublicRPCNodes(time.Now().Add(-time.Hour))
+		if err != nil {
+			log.Error().Err(err).Msg("Error querying public RPC nodes")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		nodeInfos := make([]*NodeInfo, len(nodes))
+		for i, node := range nodes {
+			nodeInfos[i] = newNodeInfo(node)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nodeInfos)
+	})
+
+	// Add fork alerts endpoint, alerts detected within the last day
+	http.HandleFunc("/api/forks", func(w http.ResponseWriter, r *http.Request) {
+		alerts, err := db.GetForkAlerts(time.Now().Add(-24 * time.Hour))
+		if err != nil {
+			log.Error().Err(err).Msg("Error querying fork alerts")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alerts)
+	})
+
+	// Add block propagation endpoint covering the last day. With ?ip= only
+	// that node's delays are returned; &port= picks one of several
+	// endpoints on the IP.
+	http.HandleFunc("/api/propagation", func(w http.ResponseWriter, r *http.Request) {
+		report, err := db.GetPropagation(time.Now().Add(-24 * time.Hour))
+		if err != nil {
+			log.Error().Err(err).Msg("Error computing block propagation")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-			for scanner.Scan() {
-				select {
-				case <-ctx.Done():
+		var result interface{} = report
+		if ip := r.URL.Query().Get("ip"); ip != "" {
+			port := 0
+			if p := r.URL.Query().Get("port"); p != "" {
+				if port, err = strconv.Atoi(p); err != nil {
+					http.Error(w, "Invalid port parameter", http.StatusBadRequest)
 					return
-				default:
-					line := strings.TrimSpace(scanner.Text())
-					if line == "" {
-						continue
-					}
-
-					// Log the line for debugging
-					log.Debug().Str("prefix", prefix).Str("line", line).Msg("Node output")
-
-					// Find all IP addresses in the line
-					ipMatches := ipRegex.FindAllString(line, -1)
-					for _, ipMatch := range ipMatches {
-						// Split IP and port if present
-						ip := ipMatch
-						if strings.Contains(ipMatch, ":") {
-							ip = strings.Split(ipMatch, ":")[0]
-						}
-
-						// Skip localhost IPs
-						if !strings.HasPrefix(ip, "127.") && !strings.HasPrefix(ip, "0.") {
-							// Add to discovered peers
-							discoveredPeers[ip] = true
-
-							// Check if we've processed this IP recently
-							recentIPsMutex.Lock()
-							if _, exists := recentIPs[ip]; exists {
-								recentIPsMutex.Unlock()
-								continue
-							}
-							recentIPs[ip] = time.Now()
-							recentIPsMutex.Unlock()
-
-							log.Info().Str("ip", ip).Msg("Found new IP")
-							// Check if we already have this IP in the database
-							existingNode, err := db.GetNode(ip)
-							if err != nil {
-								log.Error().Err(err).Str("ip", ip).Msg("Error checking node in database")
-								continue
-							}
-
-							// If node exists and was updated recently, skip
-							if existingNode != nil && time.Since(existingNode.LastSeen) < 5*time.Minute {
-								log.Debug().Str("ip", ip).Time("lastSeen", existingNode.LastSeen).Msg("Skipping recently updated node")
-								continue
-							}
-
-							// Wait for rate limiter before making API call
-							rateLimiter.Wait()
-
-							// Get IP information
-							log.Info().Str("ip", ip).Msg("Getting IP info")
-							ipInfo, err := ipService.GetIPInfo(ip)
-							if err != nil {
-								if err.Error() == "rate limit exceeded" {
-									log.Warn().Msg("Rate limit exceeded, waiting...")
-									time.Sleep(time.Minute)
-									continue
-								}
-								log.Error().Err(err).Str("ip", ip).Msg("Error getting IP info")
-								continue
-							}
-
-							if ipInfo.Status == "success" {
-								log.Info().Str("ip", ip).Msg("Successfully got IP info")
-								// Create node info
-								node := &database.Node{
-									IP:          ip,
-									Country:     ipInfo.Country,
-									City:        ipInfo.City,
-									Lat:         ipInfo.Lat,
-									Lon:         ipInfo.Lon,
-									ISP:         ipInfo.ISP,
-									LastSeen:    time.Now(),
-									Region:      ipInfo.Region,
-									RegionName:  ipInfo.RegionName,
-									Timezone:    ipInfo.Timezone,
-									Zip:         ipInfo.Zip,
-									AS:          ipInfo.AS,
-									Org:         ipInfo.Org,
-									Query:       ipInfo.Query,
-									Status:      ipInfo.Status,
-									CountryCode: ipInfo.CountryCode,
-									District:    ipInfo.District,
-									Continent:   ipInfo.Continent,
-									Currency:    ipInfo.Currency,
-									Mobile:      ipInfo.Mobile,
-									Proxy:       ipInfo.Proxy,
-									Hosting:     ipInfo.Hosting,
-									IsOnline:    false,
-									LastPing:    time.Time{},
-								}
-
-								// Save to database
-								if err := db.UpsertNode(node); err != nil {
-									log.Error().Err(err).Str("ip", ip).Msg("Error saving node to database")
-									continue
-								}
-								log.Info().
-									Str("ip", ip).
-									Str("country", node.Country).
-									Str("city", node.City).
-									Str("isp", node.ISP).
-									Msg("Saved new node to database")
-
-								// Ping the node immediately
-								isOnline := pingNode(ip, db)
-
-								// Broadcast to all clients
-								nodeInfo := &NodeInfo{
-									IP:          node.IP,
-									Country:     node.Country,
-									City:        node.City,
-									Lat:         node.Lat,
-									Lon:         node.Lon,
-									ISP:         node.ISP,
-									LastSeen:    node.LastSeen,
-									IsNew:       existingNode == nil, // Only true for newly discovered nodes
-									Region:      node.Region,
-									RegionName:  node.RegionName,
-									Timezone:    node.Timezone,
-									Zip:         node.Zip,
-									AS:          node.AS,
-									Org:         node.Org,
-									Query:       node.Query,
-									Status:      node.Status,
-									CountryCode: node.CountryCode,
-									District:    node.District,
-									Continent:   node.Continent,
-									Currency:    node.Currency,
-									Mobile:      node.Mobile,
-									Proxy:       node.Proxy,
-									Hosting:     node.Hosting,
-									IsOnline:    isOnline,
-									LastPing:    time.Now(),
-								}
-								broadcastNodeUpdate(nodeInfo)
-							}
-						}
-					}
 				}
 			}
+			var matches []*database.NodePropagation
+			for _, n := range report.Nodes {
+				if n.IP == ip && (port == 0 || n.Port == port) {
+					matches = append(matches, n)
+				}
+			}
+			switch len(matches) {
+			case 0:
+				http.Error(w, "No announcements from this node", http.StatusNotFound)
+				return
+			case 1:
+				result = matches[0]
+			default:
+				http.Error(w, "Several endpoints on this IP announced blocks, select one with the port parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
 
-			if err := scanner.Err(); err != nil {
-				log.Error().Err(err).Str("prefix", prefix).Msg("Error reading output")
+	// Add discovery source endpoint with each source's contribution. With
+	// ?ip= the sources that found that node are returned instead, for one
+	// endpoint with &port=.
+	http.HandleFunc("/api/sources", func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		var err error
+		if ip := r.URL.Query().Get("ip"); ip != "" {
+			port := 0
+			if p := r.URL.Query().Get("port"); p != "" {
+				if port, err = strconv.Atoi(p); err != nil {
+					http.Error(w, "Invalid port parameter", http.StatusBadRequest)
+					return
+				}
 			}
+			result, err = db.GetNodeSources(ip, port)
+		} else {
+			result, err = db.GetSourceSummaries(time.Now().Add(-24 * time.Hour))
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Error querying discovery sources")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
 
-		// Start processing stdout and stderr in separate goroutines
-		go processOutput(stdout, "STDOUT", db, ipService)
-		go processOutput(stderr, "STDERR", db, ipService)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
 
-		// Wait a moment to ensure the node starts properly
-		time.Sleep(2 * time.Second)
+	// Add address filter endpoint with the classifier's counts
+	http.HandleFunc("/api/address-filter", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(classifier.Stats())
+	})
 
-		// Check if the process is still running
-		if cmd.Process == nil || cmd.ProcessState != nil {
-			log.Error().Msg("Zano node failed to start properly")
-			nodeStarted <- fmt.Errorf("node failed to start")
+	// Add zanod process state endpoint
+	http.HandleFunc("/api/zanod", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if supervisor == nil {
+			json.NewEncoder(w).Encode(ZanodStatus{State: zanodAttached})
 			return
 		}
+		json.NewEncoder(w).Encode(supervisor.Status())
+	})
 
-		// Signal that the node has started successfully
-		nodeStarted <- nil
+	// Start web server in a goroutine
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info().Msg("Web server listening on :8080")
+		serverErr <- server.ListenAndServe()
+	}()
 
-		// Wait for the command to finish
-		if err := cmd.Wait(); err != nil {
-			log.Error().Err(err).Msg("Zano node process finished with error")
-		} else {
-			log.Info().Msg("Zano node process completed successfully")
-		}
+	// Start the recorder that every discovery source feeds
+	recordNode := startRecorder(ctx, db, ipService, rateLimiter, classifier)
+
+	// Start the discovery sources
+	sources := discovery.NewManager(
+		scraper,
+		&discovery.Static{Endpoints: activeNetwork.Seeds, DefaultPort: activeNetwork.P2PPort},
+	)
+	if *seedFile != "" {
+		sources.Add(&discovery.File{Path: *seedFile, DefaultPort: activeNetwork.P2PPort, Interval: time.Minute})
+	}
+	if *dnsSeeds != "" {
+		sources.Add(&discovery.DNS{Hosts: strings.Split(*dnsSeeds, ","), DefaultPort: activeNetwork.P2PPort, Interval: time.Hour})
+	}
+	sources.Start(ctx, func(s discovery.Sighting) {
+		recordNode(&discoveredNode{ip: s.IP, port: s.Port, source: s.Source, observedAt: s.ObservedAt, event: s.Event})
+	})
 
-		// Wait for all output processing to complete
-		wg.Wait()
+	// Start the supervised Zano node, or follow the log of one that's
+	// already running
+	supervisorDone := make(chan struct{})
+	go func() {
+		defer close(supervisorDone)
+		if supervisor == nil {
+			log.Info().Str("path", *zanodLog).Msg("Attach mode, not starting zanod")
+			tailer := newLogTailer(ctx, *zanodLog)
+			defer tailer.Close()
+			scraper.processOutput(ctx, tailer, "LOG")
+			return
+		}
+		supervisor.Run(ctx)
 	}()
 
 	// Start ping worker
-	go startPingWorker(ctx, db)
+	go startPingWorker(ctx, db, classifier)
+
+	// Start inbound P2P listener if enabled
+	if *p2pListen != "" {
+		go startP2PListener(ctx, *p2pListen, recordNode)
+	}
+
+	// Start P2P crawler
+	crawlCfg := crawler.DefaultConfig(activeNetwork.P2PPort)
+	crawlCfg.Concurrency = *crawlConcurrency
+	crawlCfg.PerHostLimit = *crawlPerHost
+	crawlCfg.Revisit = *crawlRevisit
+	crawlCfg.MaxBackoff = *crawlMaxBackoff
+	crawlCfg.MaxEndpoints = *crawlMaxEndpoints
+	crawlCfg.Allow = classifier.Accepts
+	crawlerDone := make(chan struct{})
+	go func() {
+		startCrawler(ctx, db, recordNode, savedPeers, crawlCfg, *crawlTimeout)
+		close(crawlerDone)
+	}()
+
+	// Start height sampler
+	go startHeightSampler(ctx, db)
+
+	// Start local node monitor
+	go startLocalNodeMonitor(ctx, localNodeP2PAddr(localRPC.URL(), zanodCfg.p2pPort()))
+
+	// Start block propagation monitor
+	go startPropagationMonitor(ctx, db)
+
+	// Start fork detector
+	go startForkDetector(ctx, db)
+
+	// Start public RPC prober
+	go startRPCProber(ctx, db, classifier)
+
+	// Start peer discovery from the local daemon's connection table
+	go startDaemonDiscovery(ctx, db, recordNode)
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Wait for either interrupt signal, server error, or node startup error
+	// Wait for either interrupt signal or server error. The supervisor
+	// handles zanod failures itself, so they don't stop the program.
 	select {
 	case <-sigChan:
 		log.Info().Msg("Received interrupt signal. Shutting down...")
@@ -968,19 +1146,6 @@ func main() {
 	case err := <-serverErr:
 		log.Error().Err(err).Msg("Web server error")
 		cancel()
-	case err := <-nodeStarted:
-		if err != nil {
-			log.Error().Err(err).Msg("Error starting Zano node")
-			// Give the node a moment to output any error messages
-			time.Sleep(2 * time.Second)
-			cancel()
-		} else {
-			log.Info().Msg("Zano node started successfully")
-			// Wait for interrupt signal
-			<-sigChan
-			log.Info().Msg("Received interrupt signal. Shutting down...")
-			cancel()
-		}
 	}
 
 	// Create shutdown context with timeout
@@ -999,8 +1164,14 @@ func main() {
 		// Wait for context cancellation to complete
 		<-ctx.Done()
 
-		// Give the Zano node a moment to shut down gracefully
-		time.Sleep(2 * time.Second)
+		// Let the crawler finish in-flight handshakes and save its frontier
+		<-crawlerDone
+
+		// Wait for the Zano node to shut down, killed after the grace period
+		<-supervisorDone
+
+		// Stop the discovery sources; the log scraper saves its peers
+		sources.Stop()
 
 		close(done)
 	}()
@@ -1008,7 +1179,7 @@ func main() {
 	select {
 	case <-done:
 		log.Info().Msg("Shutdown complete")
-	case <-time.After(5 * time.Second):
+	case <-time.After(*zanodStopGrace + 5*time.Second):
 		log.Warn().Msg("Shutdown timed out, forcing exit")
 		os.Exit(1)
 	}
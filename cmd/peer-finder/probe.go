@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Probe methods the ping worker can use to decide whether a node is online
+const (
+	probeLevin = "levin" // COMMAND_PING to the P2P port
+	probeTCP   = "tcp"   // TCP connect to the RPC port
+	probeICMP  = "icmp"  // system ping binary
+)
+
+var (
+	// activeNetwork is the network selected at startup
+	activeNetwork *network.Profile
+
+	// p2pConfig is the identity used for all Levin connections
+	p2pConfig *p2p.Config
+
+	// defaultProbes is tried in order until one succeeds
+	defaultProbes = []string{probeLevin, probeTCP, probeICMP}
+)
+
+// Function to choose the probes for a node. Once a node has answered a
+// Levin ping only the daemon itself counts as proof of life, so a dead
+// zanod on a host that still answers ICMP is reported offline.
+func probesForNode(node *database.Node) []string {
+	if node != nil && !node.LastLevinPing.IsZero() {
+		return []string{probeLevin}
+	}
+	return defaultProbes
+}
+
+// Function to run probes in order, returning whether one succeeded and which
+func probeNode(ctx context.Context, ip string, port int, probes []string) (bool, string) {
+	for _, probe := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		var err error
+		switch probe {
+		case probeLevin:
+			err = probeLevinPing(ctx, ip, port)
+		case probeTCP:
+			err = probeTCPConnect(ctx, ip)
+		case probeICMP:
+			err = probeICMPPing(ctx, ip)
+		default:
+			err = fmt.Errorf("unknown probe %q", probe)
+		}
+		if err == nil {
+			return true, probe
+		}
+		log.Debug().Str("ip", ip).Int("port", port).Str("probe", probe).Err(err).Msg("Probe failed")
+	}
+	return false, ""
+}
+
+// Function to send a Levin COMMAND_PING to the node's P2P port
+func probeLevinPing(ctx context.Context, ip string, port int) error {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	resp, latency, err := p2p.Ping(ctx, addr, p2pConfig)
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Str("endpoint", addr).
+		Uint64("peerId", resp.PeerID).
+		Dur("latency", latency).
+		Msg("Levin ping successful")
+	return nil
+}
+
+// Function to try a TCP connection to the Zano RPC port
+func probeTCPConnect(ctx context.Context, ip string) error {
+	rpcPort := strconv.Itoa(activeNetwork.RPCPort)
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, rpcPort))
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	log.Info().Str("ip", ip).Str("port", rpcPort).Msg("TCP connection successful")
+	return nil
+}
+
+// Function to try an ICMP ping
+func probeICMPPing(ctx context.Context, ip string) error {
+	args := []string{"-c", "1", "-W", "5", ip}
+	if isIPv6(ip) {
+		args = append([]string{"-6"}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "ping", args...)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	log.Info().Str("ip", ip).Msg("ICMP ping successful")
+	return nil
+}
+
+// Function to tell whether ip is an IPv6 address. IPv4-mapped addresses
+// count as IPv4.
+func isIPv6(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() == nil
+}
+
+// Function to ping a node with the probes chosen for it
+func pingNode(ctx context.Context, ip string, port int, db *database.DB) bool {
+	node, err := db.GetNode(ip, port)
+	if err != nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error getting node for ping")
+	}
+	return pingNodeWith(ctx, ip, port, db, probesForNode(node))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/simnet"
+)
+
+func TestPingNodeLevin(t *testing.T) {
+	activeNetwork = &network.Mainnet
+	p2pConfig = p2p.NewConfig(activeNetwork.NetworkID)
+	p2pConfig.Timeout = 500 * time.Millisecond
+
+	sim, err := simnet.New(activeNetwork.NetworkID, []simnet.NodeSpec{{Height: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "nodes.db"), activeNetwork.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	host, portStr, _ := net.SplitHostPort(sim.Nodes[0].Addr)
+	port, _ := strconv.Atoi(portStr)
+	if err := db.UpsertNode(&database.Node{IP: host, Port: port, LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pingNode(context.Background(), host, port, db) {
+		t.Fatal("live node reported offline")
+	}
+	if sim.Nodes[0].Pings.Load() != 1 {
+		t.Errorf("node saw %d pings, want 1", sim.Nodes[0].Pings.Load())
+	}
+	node, err := db.GetNode(host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.IsOnline || node.LastLevinPing.IsZero() {
+		t.Fatalf("node saved as online %v, last Levin ping %s", node.IsOnline, node.LastLevinPing)
+	}
+	if probes := probesForNode(node); len(probes) != 1 || probes[0] != probeLevin {
+		t.Fatalf("a node that answered a Levin ping is probed with %v", probes)
+	}
+
+	// A hung daemon is offline even though the host still accepts
+	// connections
+	sim.Nodes[0].SetBehavior(simnet.BehaviorTimeout)
+	start := time.Now()
+	if pingNode(context.Background(), host, port, db) {
+		t.Fatal("hung node reported online")
+	}
+	if elapsed := time.Since(start); elapsed > 2*p2pConfig.Timeout {
+		t.Errorf("probe took %s with a %s timeout", elapsed, p2pConfig.Timeout)
+	}
+	if node, err = db.GetNode(host, port); err != nil || node.IsOnline {
+		t.Fatalf("node saved as online %v (%v)", node.IsOnline, err)
+	}
+
+	// A probe cut short by shutdown returns at once and leaves the status
+	// as it was
+	sim.Nodes[0].SetBehavior(simnet.BehaviorNormal)
+	if !pingNode(context.Background(), host, port, db) {
+		t.Fatal("recovered node reported offline")
+	}
+	sim.Nodes[0].SetBehavior(simnet.BehaviorTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if pingNode(ctx, host, port, db) {
+		t.Fatal("hung node reported online")
+	}
+	if elapsed := time.Since(start); elapsed >= p2pConfig.Timeout {
+		t.Errorf("cancelled probe took %s", elapsed)
+	}
+	if node, err = db.GetNode(host, port); err != nil || !node.IsOnline {
+		t.Fatalf("cancelled probe saved node as online %v (%v)", node.IsOnline, err)
+	}
+}
+
+func TestProbesForNode(t *testing.T) {
+	if probes := probesForNode(nil); len(probes) != len(defaultProbes) {
+		t.Errorf("unknown node probed with %v", probes)
+	}
+	if probes := probesForNode(&database.Node{}); len(probes) != len(defaultProbes) {
+		t.Errorf("node never pinged over Levin probed with %v", probes)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/levin"
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Outbound connections held open to watch for new blocks
+	propagationPeers = 24
+
+	// How often we ask watched peers for their height. Peers that don't
+	// relay blocks to us are only measured to this precision.
+	propagationSyncInterval = 30 * time.Second
+
+	// How often closed watch connections are replaced
+	propagationRefillInterval = time.Minute
+
+	// The most heights a peer may jump at once for the ones it skipped to be
+	// recorded. A peer further behind was syncing, not relaying blocks.
+	propagationMaxGap = 10
+)
+
+// blockWatcher keeps Levin connections open to a set of peers and records
+// when each one first tells us about a new block
+type blockWatcher struct {
+	db      *database.DB
+	anns    chan *database.BlockAnnouncement
+	mu      sync.Mutex
+	watched map[string]struct{} // Endpoints with an open watch connection
+}
+
+// Function to start watching peers for block announcements
+func startPropagationMonitor(ctx context.Context, db *database.DB) {
+	w := &blockWatcher{
+		db:      db,
+		anns:    make(chan *database.BlockAnnouncement, 1000),
+		watched: make(map[string]struct{}),
+	}
+	go w.recordLoop(ctx)
+
+	refill := time.NewTicker(propagationRefillInterval)
+	defer refill.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	log.Info().Int("peers", propagationPeers).Msg("Starting block propagation monitor...")
+	for {
+		w.refill(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Block propagation monitor stopped")
+			return
+		case <-refill.C:
+		case <-prune.C:
+			if err := db.PruneBlockAnnouncements(time.Now().Add(-7 * 24 * time.Hour)); err != nil {
+				log.Error().Err(err).Msg("Error pruning block announcements")
+			}
+		}
+	}
+}
+
+// Function to open watch connections until propagationPeers are held
+func (w *blockWatcher) refill(ctx context.Context) {
+	nodes, err := w.db.GetAllNodes()
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting nodes for block propagation monitor")
+		return
+	}
+	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, node := range nodes {
+		if len(w.watched) >= propagationPeers {
+			return
+		}
+		if !node.IsOnline || node.LastHandshake.IsZero() {
+			continue
+		}
+		addr := nodeEndpoint(node.IP, node.Port)
+		if _, ok := w.watched[addr]; ok {
+			continue
+		}
+		w.watched[addr] = struct{}{}
+		go w.watch(ctx, node.IP, node.Port, addr, node.TopHeight)
+	}
+}
+
+// Function to hold a connection to the endpoint addr, ip and port, open and
+// record its announcements. knownHeight is the height last stored for the
+// node, so announcements that race the handshake aren't taken for new blocks.
+func (w *blockWatcher) watch(ctx context.Context, ip string, port int, addr string, knownHeight uint64) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.watched, addr)
+		w.mu.Unlock()
+	}()
+
+	// Highest height this peer has reported, so only new blocks are
+	// recorded, and whether its announcement was stored without a block id
+	var (
+		mu     sync.Mutex
+		last   = knownHeight
+		needID bool
+	)
+	announce := func(height uint64, blockID, source string) {
+		now := time.Now()
+		var anns []*database.BlockAnnouncement
+		mu.Lock()
+		switch {
+		case height > last:
+			// The heights a peer skipped reached it no later than this one
+			if last > 0 && height-last <= propagationMaxGap {
+				for h := last + 1; h < height; h++ {
+					anns = append(anns, &database.BlockAnnouncement{Height: h, IP: ip, Port: port, Source: database.AnnounceTimedSync, AnnouncedAt: now})
+				}
+			}
+			anns = append(anns, &database.BlockAnnouncement{Height: height, IP: ip, Port: port, Source: source, BlockID: blockID, AnnouncedAt: now})
+			last, needID = height, blockID == ""
+		case height == last && needID && blockID != "":
+			// A timed sync names the block a notification announced; the
+			// stored announcement keeps its time and source
+			anns = append(anns, &database.BlockAnnouncement{Height: height, IP: ip, Port: port, Source: source, BlockID: blockID, AnnouncedAt: now})
+			needID = false
+		}
+		mu.Unlock()
+
+		for _, a := range anns {
+			select {
+			case w.anns <- a:
+			default:
+				log.Warn().Str("addr", addr).Msg("Block announcement queue full, dropping announcement")
+			}
+		}
+	}
+
+	observe := func(p *levin.Packet) {
+		switch p.Header.Command {
+		case p2p.NotifyNewBlock, p2p.NotifyNewFluffyBlock:
+			req, err := p2p.DecodeNewBlock(p)
+			if err != nil {
+				return
+			}
+			source := database.AnnounceFluffyBlock
+			if p.Header.Command == p2p.NotifyNewBlock {
+				source = database.AnnounceNewBlock
+			}
+			announce(req.CurrentBlockchainHeight, "", source)
+		case p2p.CommandTimedSync:
+			req, err := p2p.DecodeTimedSync(p)
+			if err != nil {
+				return
+			}
+			announce(req.PayloadData.CurrentHeight, hex.EncodeToString(req.PayloadData.TopID[:]), database.AnnounceTimedSync)
+		}
+	}
+
+	peer, err := p2p.ConnectObserved(ctx, addr, p2pConfig, observe)
+	if err != nil {
+		log.Debug().Err(err).Str("addr", addr).Msg("Could not open watch connection")
+		return
+	}
+	defer peer.Close()
+
+	// The peer already had its handshake height, which isn't an announcement
+	mu.Lock()
+	if h := peer.Handshake.PayloadData.CurrentHeight; h > last {
+		last, needID = h, false
+	}
+	mu.Unlock()
+	log.Debug().Str("addr", addr).Msg("Watching peer for block announcements")
+
+	ticker := time.NewTicker(propagationSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-peer.Conn.Done():
+			log.Debug().Err(peer.Conn.Err()).Str("addr", addr).Msg("Watch connection closed")
+			return
+		case <-ticker.C:
+			resp, err := peer.TimedSync(ctx, p2pConfig)
+			if err != nil {
+				log.Debug().Err(err).Str("addr", addr).Msg("Watch connection timed sync failed")
+				return
+			}
+			sd := resp.PayloadData
+			announce(sd.CurrentHeight, hex.EncodeToString(sd.TopID[:]), database.AnnounceTimedSync)
+		}
+	}
+}
+
+// Function to write announcements to the database off the connections'
+// dispatch goroutines
+func (w *blockWatcher) recordLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-w.anns:
+			if err := w.db.RecordBlockAnnouncement(a); err != nil {
+				log.Error().Err(err).Str("ip", a.IP).Int("port", a.Port).Uint64("height", a.Height).Msg("Error saving block announcement")
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/simnet"
+)
+
+// nextAnnouncement returns the watcher's next announcement, or fails the test
+func nextAnnouncement(t *testing.T, w *blockWatcher) *database.BlockAnnouncement {
+	t.Helper()
+	select {
+	case a := <-w.anns:
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announcement")
+		return nil
+	}
+}
+
+func TestWatchAnnouncements(t *testing.T) {
+	activeNetwork = &network.Mainnet
+	p2pConfig = p2p.NewConfig(activeNetwork.NetworkID)
+	p2pConfig.Timeout = 2 * time.Second
+
+	sim, err := simnet.New(activeNetwork.NetworkID, []simnet.NodeSpec{{Height: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "nodes.db"), activeNetwork.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w := &blockWatcher{db: db, anns: make(chan *database.BlockAnnouncement, 100), watched: make(map[string]struct{})}
+	node := sim.Nodes[0]
+	host, portStr, _ := net.SplitHostPort(node.Addr)
+	port, _ := strconv.Atoi(portStr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.watch(ctx, host, port, node.Addr, 90)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for node.Handshakes.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher never connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The handshake height was already known, so only the next block is new
+	node.AnnounceBlock(100)
+	node.AnnounceBlock(101)
+	if a := nextAnnouncement(t, w); a.Height != 101 || a.Source != database.AnnounceFluffyBlock || a.Port != port {
+		t.Fatalf("got announcement %+v, want height 101 relayed", a)
+	}
+
+	// Heights the peer skipped are recorded as reaching it by the same time
+	node.AnnounceBlock(104)
+	for _, want := range []struct {
+		height uint64
+		source string
+	}{{102, database.AnnounceTimedSync}, {103, database.AnnounceTimedSync}, {104, database.AnnounceFluffyBlock}} {
+		if a := nextAnnouncement(t, w); a.Height != want.height || a.Source != want.source {
+			t.Fatalf("got announcement %+v, want height %d from %s", a, want.height, want.source)
+		}
+	}
+
+	// A peer that jumps far was syncing, and only its new top is recorded
+	node.AnnounceBlock(104 + propagationMaxGap + 1)
+	if a := nextAnnouncement(t, w); a.Height != 104+propagationMaxGap+1 {
+		t.Fatalf("got announcement %+v after a long jump", a)
+	}
+	select {
+	case a := <-w.anns:
+		t.Fatalf("unexpected announcement %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/addrclass"
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/ipinfo"
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Discovery sources the recorder hears from besides the discovery.Source
+// implementations
+const (
+	sourceCrawler   = "crawler"    // Handshaked by the crawler
+	sourceInbound   = "inbound"    // Connected to our P2P listener
+	sourceDaemonRPC = "daemon-rpc" // Reported by the local zanod's RPC
+)
+
+// A source reporting the same endpoint again within this window is
+// ignored, unless the report carries handshake data or a new log event
+const recorderDedupWindow = 5 * time.Minute
+
+// Reported nodes are enriched and probed by this many workers, each with a
+// queue of its own
+const (
+	recorderWorkers   = 8
+	recorderQueueSize = 128
+)
+
+// recentReport is the last report of an endpoint by one source
+type recentReport struct {
+	at    time.Time
+	event string
+}
+
+// discoveredNode is a node reported by a discovery source. Only nodes that
+// completed a Levin handshake with us carry handshake data.
+type discoveredNode struct {
+	ip         string
+	port       int // P2P port; the network's default if the source named the host alone
+	source     string
+	observedAt time.Time // When the source saw the node; now if zero
+	event      string    // Peer event parsed from zanod's log, if any
+	handshake  bool      // nodeData and syncData are set
+	nodeData   p2p.BasicNodeData
+	syncData   p2p.CoreSyncData
+}
+
+// Function to start the recorder, the single pipeline every discovery
+// source feeds. It drops addresses the classifier rejects and repeated
+// reports, notes which source found each node's IP and when, and then
+// enriches, saves and pings the node's endpoint. A slow probe or
+// geolocation lookup holds up only one worker. Every report of an IP goes
+// to the same worker, so its endpoints are handled in order and the IP is
+// geolocated once.
+func startRecorder(ctx context.Context, db *database.DB, ipService *ipinfo.Service, rateLimiter *RateLimiter, classifier *addrclass.Classifier) func(*discoveredNode) {
+	var mu sync.Mutex
+	recent := make(map[string]recentReport) // Last report per source and endpoint
+	// Endpoints the classifier has counted. Like the nodes table, it grows
+	// with the distinct endpoints reported.
+	counted := make(map[string]bool)
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				for key, r := range recent {
+					if time.Since(r.at) > recorderDedupWindow {
+						delete(recent, key)
+					}
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	queues := make([]chan *discoveredNode, recorderWorkers)
+	for i := range queues {
+		queue := make(chan *discoveredNode, recorderQueueSize)
+		queues[i] = queue
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-queue:
+					recordDiscoveredIP(ctx, n.ip, n.port, n.observedAt, db, ipService, rateLimiter)
+					if n.handshake {
+						recordHandshake(n.ip, n.port, n.nodeData, n.syncData, db)
+					}
+					if n.event != "" {
+						recordLogEvent(n.ip, n.port, n.event, n.observedAt, db)
+					}
+				}
+			}
+		}()
+	}
+
+	return func(n *discoveredNode) {
+		// Store addresses in one form so an IPv6 peer reported differently
+		// by two sources is still one node
+		ip := net.ParseIP(n.ip)
+		if ip == nil {
+			log.Debug().Str("ip", n.ip).Str("source", n.source).Msg("Ignoring invalid address")
+			return
+		}
+		n.ip = ip.String()
+		if n.observedAt.IsZero() {
+			n.observedAt = time.Now()
+		}
+		if n.port == 0 {
+			n.port = activeNetwork.P2PPort
+		}
+		endpoint := nodeEndpoint(n.ip, n.port)
+
+		// Drop addresses no remote node can be reached at before they cost
+		// a geolocation lookup or a probe. Each endpoint is counted once,
+		// however often it is reported, as log-replay counts them.
+		mu.Lock()
+		first := !counted[endpoint]
+		counted[endpoint] = true
+		mu.Unlock()
+		if first {
+			if class, ok := classifier.Check(n.ip); !ok {
+				log.Debug().Str("ip", n.ip).Str("class", string(class)).Str("source", n.source).Msg("Rejected address")
+				return
+			}
+		} else if !classifier.Accepts(n.ip) {
+			return
+		}
+
+		key := n.source + " " + endpoint
+		mu.Lock()
+		last, repeated := recent[key]
+		newEvent := n.event != "" && n.event != last.event
+		if !repeated {
+			recent[key] = recentReport{at: time.Now(), event: n.event}
+		} else if newEvent {
+			last.event = n.event
+			recent[key] = last
+		}
+		mu.Unlock()
+
+		switch {
+		case !repeated:
+			if err := db.RecordNodeSource(n.ip, n.port, n.source, n.observedAt); err != nil {
+				log.Error().Err(err).Str("ip", n.ip).Int("port", n.port).Str("source", n.source).Msg("Error recording discovery source")
+			}
+		case n.handshake:
+		case newEvent:
+			// The node is already queued or stored, only the event is new
+			recordLogEvent(n.ip, n.port, n.event, n.observedAt, db)
+			return
+		default:
+			return
+		}
+
+		h := fnv.New32a()
+		h.Write([]byte(n.ip))
+		select {
+		case queues[h.Sum32()%recorderWorkers] <- n:
+		default:
+			log.Warn().Str("ip", n.ip).Int("port", n.port).Msg("Discovery queue full, dropping node")
+		}
+	}
+}
+
+// Function to format a node's P2P endpoint, using the network's default
+// port when the port is unknown
+func nodeEndpoint(ip string, port int) string {
+	if port == 0 {
+		port = activeNetwork.P2PPort
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// Function to save the last log event of a node and broadcast the update
+func recordLogEvent(ip string, port int, event string, at time.Time, db *database.DB) {
+	if err := db.UpdateNodeLogEvent(ip, port, event, at); err != nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error saving log event")
+		return
+	}
+
+	node, err := db.GetNode(ip, port)
+	if err != nil || node == nil {
+		return
+	}
+	broadcastNodeUpdate(newNodeInfo(node))
+}
+
+// Function to store the peer list an endpoint advertised to us
+func recordAdvertisements(advertiser string, entries []p2p.PeerlistEntry, db *database.DB) {
+	if len(entries) == 0 {
+		return
+	}
+
+	ads := make([]*database.Advertisement, len(entries))
+	for i, e := range entries {
+		ads[i] = &database.Advertisement{
+			IP:               e.IP.String(),
+			Port:             int(e.Port),
+			PeerID:           fmt.Sprintf("%016x", e.PeerID),
+			ReportedLastSeen: e.LastSeen,
+		}
+	}
+	if err := db.RecordAdvertisements(advertiser, ads); err != nil {
+		log.Error().Err(err).Str("advertiser", advertiser).Msg("Error saving peer advertisements")
+	}
+}
+
+// Function to convert handshake data into its database form
+func newHandshakeRecord(nd p2p.BasicNodeData, sd p2p.CoreSyncData) *database.Handshake {
+	return &database.Handshake{
+		PeerID:        fmt.Sprintf("%016x", nd.PeerID),
+		MyPort:        int(nd.MyPort),
+		NetworkID:     hex.EncodeToString(nd.NetworkID[:]),
+		ClientVersion: sd.ClientVersion,
+		TopHeight:     sd.CurrentHeight,
+		TopBlockID:    hex.EncodeToString(sd.TopID[:]),
+		LocalTime:     nd.LocalTime,
+	}
+}
+
+// Function to save handshake metadata for a node and broadcast the update
+func recordHandshake(ip string, port int, nd p2p.BasicNodeData, sd p2p.CoreSyncData, db *database.DB) {
+	if err := db.UpdateNodeHandshake(ip, port, newHandshakeRecord(nd, sd)); err != nil {
+		return
+	}
+
+	node, err := db.GetNode(ip, port)
+	if err != nil || node == nil {
+		return
+	}
+	broadcastNodeUpdate(newNodeInfo(node))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/addrclass"
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/zanorpc"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// How often every known node's RPC port is probed
+	rpcProbeInterval = 15 * time.Minute
+
+	// Timeout for one getinfo call
+	rpcProbeTimeout = 5 * time.Second
+
+	// Blocks a public RPC node may trail the network median and still be
+	// offered to wallets as synchronized
+	rpcMaxLag = 10
+
+	// Height difference from the median beyond which the daemon is assumed
+	// to be on another network
+	rpcWrongNetworkLag = 5000
+)
+
+// Function to periodically probe known nodes for a public daemon RPC,
+// skipping the ones the classifier now rejects
+func startRPCProber(ctx context.Context, db *database.DB, classifier *addrclass.Classifier) {
+	ticker := time.NewTicker(rpcProbeInterval)
+	defer ticker.Stop()
+
+	log.Info().Msg("Starting public RPC prober...")
+	for {
+		probeRPCNodes(ctx, db, classifier)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Public RPC prober stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Function to run one getinfo round against every known node
+func probeRPCNodes(ctx context.Context, db *database.DB, classifier *addrclass.Classifier) {
+	nodes, err := db.GetAllNodes()
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting nodes for RPC probing")
+		return
+	}
+
+	var (
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, 16)
+		mu     sync.Mutex
+		public int
+		probed = make(map[string]bool)
+	)
+	for _, node := range nodes {
+		// The RPC port belongs to the host, so probe each IP once however
+		// many endpoints it has
+		if probed[node.IP] || !classifier.Accepts(node.IP) {
+			continue
+		}
+		probed[node.IP] = true
+
+		wg.Add(1)
+		go func(node *database.Node) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			status := probeRPC(ctx, node)
+			if err := db.UpdateNodeRPC(node.IP, status); err != nil {
+				log.Error().Err(err).Str("ip", node.IP).Msg("Error updating node RPC status")
+				return
+			}
+			if status.Public {
+				mu.Lock()
+				public++
+				mu.Unlock()
+			}
+
+			// Only broadcast when the classification changes, not on every round
+			if status.Public == node.PublicRPC && status.Synchronized == node.RPCSynchronized {
+				return
+			}
+			updated, err := db.GetNodesByIP(node.IP)
+			if err != nil {
+				return
+			}
+			for _, n := range updated {
+				broadcastNodeUpdate(newNodeInfo(n))
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	log.Info().
+		Int("ips", len(probed)).
+		Int("publicRpc", public).
+		Msg("Public RPC probing round completed")
+}
+
+// Function to call getinfo on a node's RPC port and check it is a Zano
+// daemon on our network
+func probeRPC(ctx context.Context, node *database.Node) *database.RPCStatus {
+	port := activeNetwork.RPCPort
+	addr := net.JoinHostPort(node.IP, strconv.Itoa(port))
+	status := &database.RPCStatus{Port: port}
+
+	ctx, cancel := context.WithTimeout(ctx, rpcProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	info, err := zanorpc.New(addr, rpcProbeTimeout).GetInfo(ctx)
+	if err == nil {
+		err = info.Validate()
+	}
+	if err == nil {
+		err = checkRPCNetwork(info.Height)
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("addr", addr).Msg("No public RPC")
+		return status
+	}
+
+	lag := syncLag(info.Height)
+	status.Public = true
+	status.Height = info.Height
+	status.TopBlockID = info.LastBlockHash
+	status.Latency = time.Since(start)
+	status.Synchronized = info.Synchronized() && lag <= rpcMaxLag && lag >= -rpcMaxLag
+
+	log.Debug().
+		Str("addr", addr).
+		Uint64("height", info.Height).
+		Bool("synchronized", status.Synchronized).
+		Dur("latency", status.Latency).
+		Msg("Found public RPC")
+	return status
+}
+
+// Function to reject daemons whose height puts them on another network
+func checkRPCNetwork(height uint64) error {
+	lag := syncLag(height)
+	if lag > rpcWrongNetworkLag || lag < -rpcWrongNetworkLag {
+		return fmt.Errorf("height %d is %d blocks from the network median", height, lag)
+	}
+	return nil
+}
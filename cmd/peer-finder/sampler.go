@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zano-peer-finder/internal/database"
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+// networkHeight is the median height reported in the last sampling round
+var networkHeight atomic.Uint64
+
+// Function to compute a node's lag behind the network median
+func syncLag(height uint64) int64 {
+	median := networkHeight.Load()
+	if median == 0 || height == 0 {
+		return 0
+	}
+	return int64(median) - int64(height)
+}
+
+// Function to periodically sample chain heights of reachable peers
+func startHeightSampler(ctx context.Context, db *database.DB) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	log.Info().Msg("Starting height sampler...")
+	for {
+		sampleHeights(ctx, db)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Height sampler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Function to run one timed sync round against every node that has handshaken with us
+func sampleHeights(ctx context.Context, db *database.DB) {
+	nodes, err := db.GetAllNodes()
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting nodes for height sampling")
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		samples []*database.HeightSample
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, 8)
+	)
+	for _, node := range nodes {
+		if node.LastHandshake.IsZero() || !node.IsOnline {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ip string, port int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			sample, err := sampleHeight(ctx, ip, port, db)
+			if err != nil {
+				log.Debug().Err(err).Str("ip", ip).Int("port", port).Msg("Height sample failed")
+				return
+			}
+			mu.Lock()
+			samples = append(samples, sample)
+			mu.Unlock()
+		}(node.IP, node.Port)
+	}
+	wg.Wait()
+
+	if len(samples) == 0 {
+		return
+	}
+
+	heights := make([]uint64, len(samples))
+	for i, s := range samples {
+		heights[i] = s.Height
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	median := heights[len(heights)/2]
+	networkHeight.Store(median)
+
+	for _, s := range samples {
+		s.MedianHeight = median
+		if err := db.UpdateNodeHeight(s.IP, s.Port, s.Height, s.TopBlockID); err != nil {
+			log.Error().Err(err).Str("ip", s.IP).Int("port", s.Port).Msg("Error updating node height")
+		}
+	}
+	if err := db.AddHeightSamples(samples); err != nil {
+		log.Error().Err(err).Msg("Error saving height samples")
+	}
+	if err := db.PruneHeightSamples(time.Now().Add(-30 * 24 * time.Hour)); err != nil {
+		log.Error().Err(err).Msg("Error pruning height samples")
+	}
+
+	log.Info().
+		Int("samples", len(samples)).
+		Uint64("medianHeight", median).
+		Msg("Height sampling round completed")
+}
+
+// Function to handshake with a node and request its chain tip via timed sync
+func sampleHeight(ctx context.Context, ip string, port int, db *database.DB) (*database.HeightSample, error) {
+	addr := nodeEndpoint(ip, port)
+	peer, err := p2p.Connect(ctx, addr, p2pConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+
+	resp, err := peer.TimedSync(ctx, p2pConfig)
+	if err != nil {
+		return nil, err
+	}
+	if entries, err := p2p.DecodePeerlist(resp.LocalPeerlist); err == nil {
+		recordAdvertisements(addr, entries, db)
+	}
+
+	return &database.HeightSample{
+		IP:         ip,
+		Port:       port,
+		SampledAt:  time.Now(),
+		Height:     resp.PayloadData.CurrentHeight,
+		TopBlockID: hex.EncodeToString(resp.PayloadData.TopID[:]),
+	}, nil
+}
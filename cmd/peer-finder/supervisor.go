@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// States of the supervised zanod process
+const (
+	zanodStarting   = "starting"
+	zanodRunning    = "running"
+	zanodRestarting = "restarting"
+	zanodFailed     = "failed"   // Gave up after too many quick failures
+	zanodStopped    = "stopped"  // Shut down with the program
+	zanodAttached   = "attached" // Not spawned, following an existing log file
+)
+
+const (
+	// Restart delays double from the minimum after every quick failure
+	zanodMinBackoff = time.Second
+	zanodMaxBackoff = 5 * time.Minute
+
+	// A process that stays up this long resets the backoff and failure count
+	zanodStableAfter = 10 * time.Minute
+
+	// Consecutive quick failures after which the supervisor gives up
+	zanodMaxFailures = 10
+)
+
+// ZanodStatus describes the supervised process for the API
+type ZanodStatus struct {
+	State        string    `json:"state"`
+	PID          int       `json:"pid,omitempty"`
+	StartedAt    time.Time `json:"startedAt"`
+	RestartCount int       `json:"restartCount"`
+	LastExit     string    `json:"lastExit,omitempty"` // Why the previous process ended
+	LastExitAt   time.Time `json:"lastExitAt"`
+	NextRestart  time.Time `json:"nextRestart"`
+}
+
+// zanodSupervisor owns the zanod process: it starts it, feeds its output
+// to the log scraper, restarts it with backoff when it exits and stops it
+// on shutdown
+type zanodSupervisor struct {
+	cfg     zanodConfig
+	grace   time.Duration // Wait between SIGTERM and SIGKILL on shutdown
+	scraper *logScraper
+
+	mu     sync.Mutex
+	status ZanodStatus
+}
+
+// Function to create a supervisor for a validated zanod configuration
+func newZanodSupervisor(cfg zanodConfig, grace time.Duration, scraper *logScraper) *zanodSupervisor {
+	return &zanodSupervisor{
+		cfg:     cfg,
+		grace:   grace,
+		scraper: scraper,
+		status:  ZanodStatus{State: zanodStarting},
+	}
+}
+
+// Status returns a snapshot of the process state
+func (s *zanodSupervisor) Status() ZanodStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *zanodSupervisor) update(fn func(st *ZanodStatus)) {
+	s.mu.Lock()
+	fn(&s.status)
+	s.mu.Unlock()
+}
+
+// Run keeps zanod running until ctx is cancelled or it fails too often
+func (s *zanodSupervisor) Run(ctx context.Context) {
+	backoff := zanodMinBackoff
+	failures := 0
+
+	for {
+		s.update(func(st *ZanodStatus) { st.State = zanodStarting })
+		started := time.Now()
+		reason := s.runOnce(ctx)
+
+		if ctx.Err() != nil {
+			s.update(func(st *ZanodStatus) {
+				st.State = zanodStopped
+				st.PID = 0
+				st.LastExit = reason
+				st.LastExitAt = time.Now()
+			})
+			log.Info().Str("reason", reason).Msg("Zano node stopped")
+			return
+		}
+
+		if time.Since(started) >= zanodStableAfter {
+			backoff = zanodMinBackoff
+			failures = 0
+		}
+		failures++
+
+		if failures >= zanodMaxFailures {
+			s.update(func(st *ZanodStatus) {
+				st.State = zanodFailed
+				st.PID = 0
+				st.LastExit = reason
+				st.LastExitAt = time.Now()
+			})
+			log.Error().Str("reason", reason).Int("failures", failures).Msg("Zano node keeps failing, giving up")
+			return
+		}
+
+		next := time.Now().Add(backoff)
+		s.update(func(st *ZanodStatus) {
+			st.State = zanodRestarting
+			st.PID = 0
+			st.LastExit = reason
+			st.LastExitAt = time.Now()
+			st.NextRestart = next
+		})
+		log.Warn().Str("reason", reason).Dur("backoff", backoff).Msg("Zano node exited, restarting")
+
+		select {
+		case <-ctx.Done():
+			s.update(func(st *ZanodStatus) { st.State = zanodStopped })
+			return
+		case <-time.After(backoff):
+		}
+
+		s.update(func(st *ZanodStatus) { st.RestartCount++ })
+		if backoff *= 2; backoff > zanodMaxBackoff {
+			backoff = zanodMaxBackoff
+		}
+	}
+}
+
+// runOnce starts zanod and blocks until it exits, returning why
+func (s *zanodSupervisor) runOnce(ctx context.Context) string {
+	cmd, stdout, stderr, err := startZanoNode(s.cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start Zano node")
+		return err.Error()
+	}
+	s.update(func(st *ZanodStatus) {
+		st.State = zanodRunning
+		st.PID = cmd.Process.Pid
+		st.StartedAt = time.Now()
+	})
+
+	// Attach the parsers. They end at EOF once the process exits.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for _, pipe := range []struct {
+		r      io.Reader
+		prefix string
+	}{{stdout, "STDOUT"}, {stderr, "STDERR"}} {
+		go func(r io.Reader, prefix string) {
+			defer wg.Done()
+			s.scraper.processOutput(ctx, r, prefix)
+			// Keep draining after a shutdown so zanod never blocks on a
+			// full pipe while it exits
+			io.Copy(io.Discard, r)
+		}(pipe.r, pipe.prefix)
+	}
+
+	// Stop the process on shutdown, escalating if it ignores SIGTERM
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		log.Info().Msg("Context cancelled, terminating Zano node...")
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			log.Error().Err(err).Msg("Error sending SIGTERM to Zano node")
+		}
+		select {
+		case <-exited:
+		case <-time.After(s.grace):
+			log.Warn().Dur("grace", s.grace).Msg("Zano node ignored SIGTERM, killing it")
+			if err := cmd.Process.Kill(); err != nil {
+				log.Error().Err(err).Msg("Error force killing Zano node")
+			}
+		}
+	}()
+
+	// The pipes must be drained before Wait, which is the only Wait call
+	wg.Wait()
+	err = cmd.Wait()
+	close(exited)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "exited with status 0"
+	case errors.As(err, &exitErr):
+		return exitErr.Error()
+	default:
+		return err.Error()
+	}
+}
+
+// Function to start the Zano node. The caller owns the process and must
+// drain both pipes before calling Wait.
+func startZanoNode(cfg zanodConfig) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+	// The binary was checked at startup, but it may have been replaced since
+	if _, err := os.Stat(cfg.Binary); err != nil {
+		return nil, nil, nil, fmt.Errorf("error checking zanod binary: %v", err)
+	}
+
+	// Command to start the Zano node directly
+	args := cfg.args()
+	log.Info().Str("path", cfg.Binary).Strs("args", args).Msg("Starting Zano node...")
+	cmd := exec.Command(cfg.Binary, args...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+
+	// Create pipes to capture both stdout and stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error creating stderr pipe: %v", err)
+	}
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, fmt.Errorf("error starting command: %v", err)
+	}
+
+	log.Info().Int("pid", cmd.Process.Pid).Msg("Started zanod process")
+	return cmd, stdout, stderr, nil
+}
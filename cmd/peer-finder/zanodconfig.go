@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// stringList is a flag that can be repeated, collecting every value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Flags that zanodConfig sets itself and must not be repeated in Args
+var managedZanodFlags = []string{"--log-level", "--data-dir", "--no-console"}
+
+// zanodConfig describes how the supervised zanod is launched
+type zanodConfig struct {
+	Binary   string   // Path to zanod, relative to the working directory if not absolute
+	DataDir  string   // Passed as --data-dir; zanod's default if empty
+	LogLevel int      // Passed as --log-level, 0 to 4
+	Args     []string // Extra flags, appended after the network's own
+	Env      []string // KEY=VALUE entries added to the inherited environment
+}
+
+// Function to check the configuration before anything is started, making
+// Binary and DataDir absolute
+func (c *zanodConfig) validate(wd string) error {
+	if c.Binary == "" {
+		return fmt.Errorf("zanod binary path is empty")
+	}
+	if !filepath.IsAbs(c.Binary) {
+		c.Binary = filepath.Join(wd, c.Binary)
+	}
+	info, err := os.Stat(c.Binary)
+	if err != nil {
+		return fmt.Errorf("zanod binary: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("zanod binary %s is not a regular file", c.Binary)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("zanod binary %s is not executable (try chmod +x)", c.Binary)
+	}
+
+	if c.DataDir != "" {
+		if !filepath.IsAbs(c.DataDir) {
+			c.DataDir = filepath.Join(wd, c.DataDir)
+		}
+		// zanod creates a missing data directory itself
+		if info, err := os.Stat(c.DataDir); err == nil && !info.IsDir() {
+			return fmt.Errorf("zanod data dir %s is not a directory", c.DataDir)
+		} else if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("zanod data dir: %v", err)
+		}
+	}
+
+	if c.LogLevel < 0 || c.LogLevel > 4 {
+		return fmt.Errorf("zanod log level %d is out of range 0-4", c.LogLevel)
+	}
+
+	for _, arg := range c.Args {
+		name, _, _ := strings.Cut(arg, "=")
+		if !strings.HasPrefix(name, "-") {
+			continue // A flag's value
+		}
+		for _, managed := range managedZanodFlags {
+			if name == managed {
+				return fmt.Errorf("zanod flag %s is set by peer-finder, use its own option instead", managed)
+			}
+		}
+	}
+
+	for _, kv := range c.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("zanod environment entry %q is not KEY=VALUE", kv)
+		}
+	}
+	return nil
+}
+
+// Function to build zanod's command line arguments
+func (c *zanodConfig) args() []string {
+	args := []string{"--log-level", fmt.Sprint(c.LogLevel)}
+	if c.DataDir != "" {
+		args = append(args, "--data-dir", c.DataDir)
+	}
+	args = append(args, withoutFlags(activeNetwork.ZanodArgs, c.Args)...)
+	args = append(args, c.Args...)
+	return append(args, "--no-console")
+}
+
+// Function to find the P2P port zanod listens on: a --p2p-bind-port in its
+// arguments, or the network's default
+func (c *zanodConfig) p2pPort() int {
+	args := c.args()
+	for i, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if name != "--p2p-bind-port" {
+			continue
+		}
+		if !ok && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if port, err := strconv.Atoi(value); err == nil && port > 0 && port <= 65535 {
+			return port
+		}
+	}
+	return activeNetwork.P2PPort
+}
+
+// Function to drop the flags set in overrides from defaults, so an extra
+// argument such as --rpc-bind-port replaces the network's value instead
+// of repeating it. defaults holds "--flag value" pairs.
+func withoutFlags(defaults, overrides []string) []string {
+	set := make(map[string]bool)
+	for _, arg := range overrides {
+		if name, _, _ := strings.Cut(arg, "="); strings.HasPrefix(name, "-") {
+			set[name] = true
+		}
+	}
+
+	var kept []string
+	for i := 0; i < len(defaults); i++ {
+		if set[defaults[i]] {
+			// Skip the flag and its value
+			if i+1 < len(defaults) && !strings.HasPrefix(defaults[i+1], "-") {
+				i++
+			}
+			continue
+		}
+		kept = append(kept, defaults[i])
+	}
+	return kept
+}
+
+// Function to split -zanod-arg values into separate arguments, so both
+// "-zanod-arg --add-peer=1.2.3.4:11121" and "-zanod-arg '--add-peer 1.2.3.4:11121'"
+// work
+func splitZanodArgs(values []string) []string {
+	var args []string
+	for _, v := range values {
+		args = append(args, strings.Fields(v)...)
+	}
+	return args
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/simnet"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	// Configure zerolog
+	zerolog.TimeFieldFormat = time.RFC3339
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		Out:        os.Stdout,
+		TimeFormat: time.RFC3339,
+	})
+}
+
+// simnet runs a simulated Zano P2P network on loopback so discovery can be
+// exercised offline. Point peer-finder at the printed seed addresses.
+func main() {
+	nodes := flag.Int("nodes", 20, "Number of simulated nodes")
+	fanout := flag.Int("fanout", 4, "Peers advertised by each node")
+	height := flag.Uint64("height", 2500000, "Median chain height")
+	spread := flag.Int("spread", 5, "Maximum blocks a node lags behind the median height")
+	refuse := flag.Float64("refuse", 0.05, "Fraction of nodes that refuse connections")
+	timeout := flag.Float64("timeout", 0.05, "Fraction of nodes that never answer")
+	malformed := flag.Float64("malformed", 0.05, "Fraction of nodes that send malformed packets")
+	seed := flag.Int64("seed", 1, "Random seed for topology and failures")
+	advance := flag.Duration("block-time", time.Minute, "Interval between simulated blocks (0 to disable)")
+	propagation := flag.Duration("propagation", 2*time.Second, "Maximum random delay before a node announces a new block")
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	specs := make([]simnet.NodeSpec, *nodes)
+	for i := range specs {
+		spec := simnet.NodeSpec{Height: *height - uint64(rng.Intn(*spread+1))}
+		for len(spec.Peers) < *fanout && len(spec.Peers) < *nodes-1 {
+			if p := rng.Intn(*nodes); p != i {
+				spec.Peers = append(spec.Peers, p)
+			}
+		}
+
+		// Node 0 is the seed and always behaves
+		switch r := rng.Float64(); {
+		case i == 0:
+		case r < *refuse:
+			spec.Behavior = simnet.BehaviorRefuse
+		case r < *refuse+*timeout:
+			spec.Behavior = simnet.BehaviorTimeout
+		case r < *refuse+*timeout+*malformed:
+			spec.Behavior = simnet.BehaviorMalformed
+		}
+		specs[i] = spec
+	}
+
+	sim, err := simnet.New(network.Mainnet.NetworkID, specs)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error starting simulated network")
+	}
+	defer sim.Close()
+
+	for _, node := range sim.Nodes {
+		log.Info().
+			Int("index", node.Index).
+			Str("addr", node.Addr).
+			Int("behavior", int(specs[node.Index].Behavior)).
+			Uint64("height", specs[node.Index].Height).
+			Msg("Simulated node listening")
+	}
+	fmt.Println(sim.Nodes[0].Addr)
+
+	var ticker <-chan time.Time
+	if *advance > 0 {
+		t := time.NewTicker(*advance)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case <-sigChan:
+			log.Info().Msg("Shutting down simulated network")
+			return
+		case <-ticker:
+			*height++
+			for i, node := range sim.Nodes {
+				specs[i].Height++
+				// Each node learns of the block after its own delay and
+				// announces it to whoever is connected
+				var delay time.Duration
+				if *propagation > 0 {
+					delay = time.Duration(rng.Int63n(int64(*propagation)))
+				}
+				node, h := node, specs[i].Height
+				time.AfterFunc(delay, func() { node.AnnounceBlock(h) })
+			}
+			log.Info().Uint64("height", *height).Msg("Simulated new block")
+		}
+	}
+}
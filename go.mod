@@ -7,12 +7,12 @@ toolchain go1.24.3
 require (
 	github.com/gorilla/websocket v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/rs/zerolog v1.34.0
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/rs/zerolog v1.34.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
 )
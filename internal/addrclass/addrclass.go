@@ -0,0 +1,259 @@
+// Package addrclass sorts peer addresses into the ones worth geolocating
+// and probing and the ones no remote node can be reached at, such as
+// private, documentation and multicast ranges or our own address.
+package addrclass
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Class is the kind of address an IP is
+type Class string
+
+const (
+	Public        Class = "public"
+	Invalid       Class = "invalid" // Not an IP address
+	Unspecified   Class = "unspecified"
+	Loopback      Class = "loopback"
+	Private       Class = "private" // RFC 1918 and IPv6 unique local
+	CGNAT         Class = "cgnat"   // RFC 6598 shared address space
+	LinkLocal     Class = "link-local"
+	Multicast     Class = "multicast"
+	Documentation Class = "documentation" // RFC 5737 and RFC 3849
+	Reserved      Class = "reserved"      // This network, IETF, benchmarking, class E and broadcast
+	Self          Class = "self"          // One of this host's own addresses
+	Ignored       Class = "ignored"       // In a configured ignore range
+)
+
+// Classes that can be let through by Allow. The others are either always
+// accepted or never worth keeping.
+var allowable = []Class{Loopback, Private, CGNAT, LinkLocal, Documentation, Reserved}
+
+// ParseAllowable returns the class named s if Allow accepts it
+func ParseAllowable(s string) (Class, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, c := range allowable {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	names := make([]string, len(allowable))
+	for i, c := range allowable {
+		names[i] = string(c)
+	}
+	return "", fmt.Errorf("unknown address class %q (want one of %s)", s, strings.Join(names, ", "))
+}
+
+// Special-purpose ranges, from the IANA registries. Unspecified addresses
+// are checked separately.
+var ranges = []struct {
+	class Class
+	cidr  *net.IPNet
+}{
+	{Reserved, mustCIDR("0.0.0.0/8")},
+	{Private, mustCIDR("10.0.0.0/8")},
+	{CGNAT, mustCIDR("100.64.0.0/10")},
+	{Loopback, mustCIDR("127.0.0.0/8")},
+	{LinkLocal, mustCIDR("169.254.0.0/16")},
+	{Private, mustCIDR("172.16.0.0/12")},
+	{Reserved, mustCIDR("192.0.0.0/24")},
+	{Documentation, mustCIDR("192.0.2.0/24")},
+	{Private, mustCIDR("192.168.0.0/16")},
+	{Reserved, mustCIDR("198.18.0.0/15")},
+	{Documentation, mustCIDR("198.51.100.0/24")},
+	{Documentation, mustCIDR("203.0.113.0/24")},
+	{Multicast, mustCIDR("224.0.0.0/4")},
+	{Reserved, mustCIDR("240.0.0.0/4")},
+	{Loopback, mustCIDR("::1/128")},
+	{Reserved, mustCIDR("100::/64")},
+	{Documentation, mustCIDR("2001:db8::/32")},
+	{Private, mustCIDR("fc00::/7")},
+	{LinkLocal, mustCIDR("fe80::/10")},
+	{Multicast, mustCIDR("ff00::/8")},
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Classify returns the class of ip from the special-purpose ranges alone.
+// It never returns Self or Ignored.
+func Classify(ip net.IP) Class {
+	if ip == nil {
+		return Invalid
+	}
+	if ip.IsUnspecified() {
+		return Unspecified
+	}
+	for _, r := range ranges {
+		if r.cidr.Contains(ip) {
+			return r.class
+		}
+	}
+	return Public
+}
+
+// Stats counts the addresses a Classifier has checked. Callers check each
+// endpoint once, so the counts are of distinct endpoints.
+type Stats struct {
+	Accepted uint64           `json:"accepted"` // Public addresses
+	Allowed  map[Class]uint64 `json:"allowed"`  // Non-public addresses let through by Allow
+	Rejected map[Class]uint64 `json:"rejected"`
+	Ignore   []string         `json:"ignore"` // Configured ignore ranges
+	Self     []string         `json:"self"`   // Known addresses of this host
+}
+
+// Classifier classifies addresses with this host's own addresses and a
+// configurable ignore list on top of the special-purpose ranges, and
+// counts what it checked. It is safe for concurrent use.
+type Classifier struct {
+	mu       sync.RWMutex
+	ignore   []*net.IPNet
+	self     map[string]bool
+	allow    map[Class]bool
+	accepted uint64
+	allowed  map[Class]uint64
+	rejected map[Class]uint64
+}
+
+// New returns a classifier that accepts public addresses only
+func New() *Classifier {
+	return &Classifier{
+		self:     make(map[string]bool),
+		allow:    make(map[Class]bool),
+		allowed:  make(map[Class]uint64),
+		rejected: make(map[Class]uint64),
+	}
+}
+
+// Ignore adds a CIDR range, or a single address, whose addresses are
+// rejected as Ignored
+func (c *Classifier) Ignore(s string) error {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf("%q is not an IP address or CIDR range", s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		s = fmt.Sprintf("%s/%d", ip, bits)
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ignore = append(c.ignore, n)
+	return nil
+}
+
+// AddSelf records one of this host's own addresses, rejected as Self
+func (c *Classifier) AddSelf(s string) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.self[ip.String()] = true
+}
+
+// Allow lets addresses of a non-public class through, for networks on a
+// LAN or loopback. Only classes ParseAllowable accepts have an effect.
+func (c *Classifier) Allow(class Class) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allow[class] = true
+}
+
+// Classify returns the class of s, an address in any textual form
+func (c *Classifier) Classify(s string) Class {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return Invalid
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.self[ip.String()] {
+		return Self
+	}
+	for _, n := range c.ignore {
+		if n.Contains(ip) {
+			return Ignored
+		}
+	}
+	return Classify(ip)
+}
+
+// Accepts reports whether s is worth keeping, without counting it
+func (c *Classifier) Accepts(s string) bool {
+	class := c.Classify(s)
+	if class == Public {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.allow[class]
+}
+
+// Check classifies s, counts the result and reports whether s is worth
+// keeping
+func (c *Classifier) Check(s string) (Class, bool) {
+	class := c.Classify(s)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case class == Public:
+		c.accepted++
+		return class, true
+	case c.allow[class]:
+		c.allowed[class]++
+		return class, true
+	default:
+		c.rejected[class]++
+		return class, false
+	}
+}
+
+// Stats returns the counts so far and the current configuration
+func (c *Classifier) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s := Stats{
+		Accepted: c.accepted,
+		Allowed:  make(map[Class]uint64, len(c.allowed)),
+		Rejected: make(map[Class]uint64, len(c.rejected)),
+		Ignore:   make([]string, 0, len(c.ignore)),
+		Self:     make([]string, 0, len(c.self)),
+	}
+	for class, n := range c.allowed {
+		s.Allowed[class] = n
+	}
+	for class, n := range c.rejected {
+		s.Rejected[class] = n
+	}
+	for _, n := range c.ignore {
+		s.Ignore = append(s.Ignore, n.String())
+	}
+	for ip := range c.self {
+		s.Self = append(s.Self, ip)
+	}
+	sort.Strings(s.Self)
+	return s
+}
@@ -0,0 +1,159 @@
+package addrclass_test
+
+import (
+	"net"
+	"testing"
+
+	"zano-peer-finder/internal/addrclass"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want addrclass.Class
+	}{
+		{"95.216.50.10", addrclass.Public},
+		{"0.0.0.0", addrclass.Unspecified},
+		{"0.1.2.3", addrclass.Reserved},
+		{"10.1.2.3", addrclass.Private},
+		{"100.64.0.1", addrclass.CGNAT},
+		{"100.128.0.1", addrclass.Public},
+		{"127.0.0.1", addrclass.Loopback},
+		{"169.254.1.1", addrclass.LinkLocal},
+		{"172.16.0.1", addrclass.Private},
+		{"172.32.0.1", addrclass.Public},
+		{"192.0.0.8", addrclass.Reserved},
+		{"192.0.2.1", addrclass.Documentation},
+		{"192.168.1.1", addrclass.Private},
+		{"198.18.0.1", addrclass.Reserved},
+		{"198.51.100.1", addrclass.Documentation},
+		{"203.0.113.1", addrclass.Documentation},
+		{"224.0.0.1", addrclass.Multicast},
+		{"240.0.0.1", addrclass.Reserved},
+		{"255.255.255.255", addrclass.Reserved},
+		{"2a01:4f8:10a:2b::2", addrclass.Public},
+		{"::", addrclass.Unspecified},
+		{"::1", addrclass.Loopback},
+		{"100::1", addrclass.Reserved},
+		{"2001:db8::1", addrclass.Documentation},
+		{"fd00::1", addrclass.Private},
+		{"fe80::1", addrclass.LinkLocal},
+		{"ff02::1", addrclass.Multicast},
+		// IPv4-mapped addresses are classified as the IPv4 address
+		{"::ffff:95.216.50.10", addrclass.Public},
+		{"::ffff:10.1.2.3", addrclass.Private},
+		{"::ffff:127.0.0.1", addrclass.Loopback},
+	}
+	for _, tc := range tests {
+		if got := addrclass.Classify(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("%s classified as %s, want %s", tc.ip, got, tc.want)
+		}
+	}
+	if got := addrclass.Classify(nil); got != addrclass.Invalid {
+		t.Errorf("nil classified as %s", got)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	c := addrclass.New()
+	for _, s := range []string{"8.8.8.0/24", " 1.1.1.1 ", "2a01:4f8::/32", "::ffff:9.9.9.9"} {
+		if err := c.Ignore(s); err != nil {
+			t.Fatalf("Ignore(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "bogus", "10.0.0.0/33", "1.2.3.4/abc", "2a01::/129"} {
+		if err := c.Ignore(s); err == nil {
+			t.Errorf("Ignore(%q) accepted", s)
+		}
+	}
+
+	tests := []struct {
+		ip   string
+		want addrclass.Class
+	}{
+		{"8.8.8.8", addrclass.Ignored},
+		{"::ffff:8.8.8.8", addrclass.Ignored},
+		{"8.8.9.8", addrclass.Public},
+		{"1.1.1.1", addrclass.Ignored},
+		{"1.1.1.2", addrclass.Public},
+		{"9.9.9.9", addrclass.Ignored},
+		{"2a01:4f8:10a::1", addrclass.Ignored},
+		{"2a01:4f9::1", addrclass.Public},
+		{"not-an-ip", addrclass.Invalid},
+	}
+	for _, tc := range tests {
+		if got := c.Classify(tc.ip); got != tc.want {
+			t.Errorf("%s classified as %s, want %s", tc.ip, got, tc.want)
+		}
+	}
+	if stats := c.Stats(); len(stats.Ignore) != 4 {
+		t.Errorf("stats list ignore ranges %v", stats.Ignore)
+	}
+}
+
+func TestAddSelf(t *testing.T) {
+	c := addrclass.New()
+	c.AddSelf("2A01:4F8:0:0::1")
+	c.AddSelf("::ffff:95.216.50.10")
+	c.AddSelf("bogus")
+
+	for _, ip := range []string{"2a01:4f8::1", "95.216.50.10", "::ffff:95.216.50.10"} {
+		if got := c.Classify(ip); got != addrclass.Self {
+			t.Errorf("%s classified as %s, want self", ip, got)
+		}
+	}
+	if got := c.Classify("95.216.50.11"); got != addrclass.Public {
+		t.Errorf("other address classified as %s", got)
+	}
+	if stats := c.Stats(); len(stats.Self) != 2 || stats.Self[0] != "2a01:4f8::1" || stats.Self[1] != "95.216.50.10" {
+		t.Errorf("stats list own addresses %v", stats.Self)
+	}
+}
+
+func TestAllowAndCounts(t *testing.T) {
+	c := addrclass.New()
+	c.Allow(addrclass.Private)
+	c.AddSelf("95.216.50.10")
+
+	tests := []struct {
+		ip    string
+		class addrclass.Class
+		ok    bool
+	}{
+		{"95.216.50.11", addrclass.Public, true},
+		{"10.0.0.1", addrclass.Private, true},
+		{"fd00::1", addrclass.Private, true},
+		{"127.0.0.1", addrclass.Loopback, false},
+		{"95.216.50.10", addrclass.Self, false},
+		{"bogus", addrclass.Invalid, false},
+	}
+	for _, tc := range tests {
+		class, ok := c.Check(tc.ip)
+		if class != tc.class || ok != tc.ok {
+			t.Errorf("Check(%s) = %s, %v, want %s, %v", tc.ip, class, ok, tc.class, tc.ok)
+		}
+		if c.Accepts(tc.ip) != tc.ok {
+			t.Errorf("Accepts(%s) disagrees with Check", tc.ip)
+		}
+	}
+
+	// Accepts doesn't count
+	stats := c.Stats()
+	if stats.Accepted != 1 || stats.Allowed[addrclass.Private] != 2 {
+		t.Errorf("counted %d accepted and %v allowed", stats.Accepted, stats.Allowed)
+	}
+	if stats.Rejected[addrclass.Loopback] != 1 || stats.Rejected[addrclass.Self] != 1 || stats.Rejected[addrclass.Invalid] != 1 {
+		t.Errorf("counted %v rejected", stats.Rejected)
+	}
+}
+
+func TestParseAllowable(t *testing.T) {
+	if class, err := addrclass.ParseAllowable(" Link-Local "); err != nil || class != addrclass.LinkLocal {
+		t.Errorf("link-local parsed as %s (%v)", class, err)
+	}
+	for _, s := range []string{"public", "self", "ignored", "multicast", "unspecified", "bogus"} {
+		if _, err := addrclass.ParseAllowable(s); err == nil {
+			t.Errorf("%q accepted as an allowable class", s)
+		}
+	}
+}
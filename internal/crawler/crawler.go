@@ -0,0 +1,353 @@
+package crawler
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/p2p"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Result is the outcome of crawling a single endpoint
+type Result struct {
+	Address  string
+	IP       string
+	Port     int
+	Time     time.Time
+	Latency  time.Duration
+	NodeData p2p.BasicNodeData
+	SyncData p2p.CoreSyncData
+	Peerlist []p2p.PeerlistEntry
+	AdvertBy string // endpoint whose peer list led us here, empty for seeds
+	Err      error
+}
+
+// Config controls crawl pacing. Zero values fall back to DefaultConfig.
+type Config struct {
+	DefaultPort  int           // port used for bare IPs
+	Concurrency  int           // connections open at once across all hosts
+	PerHostLimit int           // connections open at once to a single IP
+	Revisit      time.Duration // wait after a successful crawl
+	MinBackoff   time.Duration // wait after the first failure, doubled per failure
+	MaxBackoff   time.Duration
+	MaxFailures  int           // never-reached endpoints are dropped after this many failures
+	ForgetAfter  time.Duration // reached endpoints are dropped after MaxFailures once their last success is this old
+	MaxEndpoints int           // advertised endpoints are ignored while this many are known
+
+	// Allow, if set, decides whether an IP is worth crawling. Seeds,
+	// restored and advertised endpoints all pass through it.
+	Allow func(ip string) bool
+}
+
+// DefaultConfig returns conservative settings for the public network
+func DefaultConfig(defaultPort int) Config {
+	return Config{
+		DefaultPort:  defaultPort,
+		Concurrency:  16,
+		PerHostLimit: 1,
+		Revisit:      30 * time.Minute,
+		MinBackoff:   5 * time.Minute,
+		MaxBackoff:   12 * time.Hour,
+		MaxFailures:  8,
+		ForgetAfter:  7 * 24 * time.Hour,
+		MaxEndpoints: 50000,
+	}
+}
+
+// Crawler handshakes with known endpoints, harvests their peer lists and
+// follows newly advertised endpoints
+type Crawler struct {
+	p2pCfg   *p2p.Config
+	cfg      Config
+	onResult func(*Result)
+
+	mu        sync.Mutex
+	endpoints map[string]*Endpoint
+	queue     frontier
+	active    int
+	perHost   map[string]int
+	wake      chan struct{}
+}
+
+// New creates a crawler. onResult is called from worker goroutines for
+// every endpoint attempted, successful or not.
+func New(p2pCfg *p2p.Config, cfg Config, onResult func(*Result)) *Crawler {
+	def := DefaultConfig(cfg.DefaultPort)
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = def.Concurrency
+	}
+	if cfg.PerHostLimit <= 0 {
+		cfg.PerHostLimit = def.PerHostLimit
+	}
+	if cfg.Revisit <= 0 {
+		cfg.Revisit = def.Revisit
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = def.MinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = def.MaxFailures
+	}
+	if cfg.ForgetAfter <= 0 {
+		cfg.ForgetAfter = def.ForgetAfter
+	}
+	if cfg.MaxEndpoints <= 0 {
+		cfg.MaxEndpoints = def.MaxEndpoints
+	}
+
+	return &Crawler{
+		p2pCfg:    p2pCfg,
+		cfg:       cfg,
+		onResult:  onResult,
+		endpoints: make(map[string]*Endpoint),
+		perHost:   make(map[string]int),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Add schedules addr for an immediate crawl unless it is already known or
+// Allow rejects it. A bare IP is given the default port.
+func (c *Crawler) Add(addr string) {
+	c.add(addr, "")
+}
+
+func (c *Crawler) add(addr, advertBy string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		addr = net.JoinHostPort(addr, strconv.Itoa(c.cfg.DefaultPort))
+	}
+	if !c.allowed(host) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.endpoints[addr]; ok {
+		return
+	}
+	// Seeds are always taken; a flood of advertised endpoints can't grow
+	// the frontier past the cap
+	if advertBy != "" && len(c.endpoints) >= c.cfg.MaxEndpoints {
+		return
+	}
+	e := &Endpoint{Address: addr, Host: host, AdvertBy: advertBy, NextAttempt: time.Now()}
+	c.endpoints[addr] = e
+	heap.Push(&c.queue, e)
+	c.signal()
+}
+
+// Restore loads previously saved endpoints, keeping their backoff state.
+// Endpoints already known are left untouched, and ones Allow rejects or
+// advertised ones past the cap are skipped.
+func (c *Crawler) Restore(endpoints []Endpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range endpoints {
+		e := endpoints[i]
+		if _, ok := c.endpoints[e.Address]; ok {
+			continue
+		}
+		if e.AdvertBy != "" && len(c.endpoints) >= c.cfg.MaxEndpoints {
+			continue
+		}
+		if e.Host == "" {
+			e.Host, _, _ = net.SplitHostPort(e.Address)
+		}
+		if !c.allowed(e.Host) {
+			continue
+		}
+		c.endpoints[e.Address] = &e
+		heap.Push(&c.queue, &e)
+	}
+	c.signal()
+}
+
+// Snapshot returns the state of every known endpoint, including in-flight ones
+func (c *Crawler) Snapshot() []Endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Endpoint, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		out = append(out, *e)
+	}
+	return out
+}
+
+// Stats returns the number of known, queued and in-flight endpoints
+func (c *Crawler) Stats() (known, queued, active int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.endpoints), len(c.queue), c.active
+}
+
+// allowed reports whether host passes the Allow filter
+func (c *Crawler) allowed(host string) bool {
+	if c.cfg.Allow == nil || c.cfg.Allow(host) {
+		return true
+	}
+	log.Debug().Str("host", host).Msg("Skipping endpoint rejected by the address filter")
+	return false
+}
+
+func (c *Crawler) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run crawls until ctx is cancelled, then waits for in-flight crawls to finish
+func (c *Crawler) Run(ctx context.Context) {
+	log.Info().
+		Int("concurrency", c.cfg.Concurrency).
+		Int("perHost", c.cfg.PerHostLimit).
+		Msg("Starting P2P crawler")
+
+	var wg sync.WaitGroup
+	for {
+		e := c.next(ctx)
+		if e == nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.complete(e, c.crawl(ctx, e))
+		}()
+	}
+	wg.Wait()
+	log.Info().Msg("P2P crawler stopped")
+}
+
+// next blocks until an endpoint is due and both the global and per-host
+// limits leave room for it
+func (c *Crawler) next(ctx context.Context) *Endpoint {
+	for {
+		c.mu.Lock()
+		wait := time.Minute
+		if c.active < c.cfg.Concurrency {
+			now := time.Now()
+			var skipped []*Endpoint
+			var picked *Endpoint
+			for c.queue.Len() > 0 {
+				e := c.queue[0]
+				if e.NextAttempt.After(now) {
+					// Uncontacted endpoints are always due, so the head is
+					// the earliest revisit
+					wait = e.NextAttempt.Sub(now)
+					break
+				}
+				heap.Pop(&c.queue)
+				if c.perHost[e.Host] >= c.cfg.PerHostLimit {
+					skipped = append(skipped, e)
+					continue
+				}
+				picked = e
+				break
+			}
+			for _, e := range skipped {
+				heap.Push(&c.queue, e)
+			}
+			if picked != nil {
+				c.active++
+				c.perHost[picked.Host]++
+				picked.Attempts++
+				picked.LastAttempt = now
+				c.mu.Unlock()
+				return picked
+			}
+		}
+		c.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-c.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// complete releases the endpoint's slots and reschedules it
+func (c *Crawler) complete(e *Endpoint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	if c.perHost[e.Host]--; c.perHost[e.Host] <= 0 {
+		delete(c.perHost, e.Host)
+	}
+	defer c.signal()
+
+	now := time.Now()
+	if err == nil {
+		e.Failures = 0
+		e.LastSuccess = now
+		e.NextAttempt = now.Add(c.cfg.Revisit)
+		heap.Push(&c.queue, e)
+		return
+	}
+
+	e.Failures++
+	if e.Failures >= c.cfg.MaxFailures && (e.LastSuccess.IsZero() || now.Sub(e.LastSuccess) > c.cfg.ForgetAfter) {
+		log.Debug().Str("addr", e.Address).Int("failures", e.Failures).Msg("Dropping unreachable endpoint")
+		delete(c.endpoints, e.Address)
+		return
+	}
+
+	backoff := c.cfg.MinBackoff << (e.Failures - 1)
+	if backoff > c.cfg.MaxBackoff || backoff <= 0 {
+		backoff = c.cfg.MaxBackoff
+	}
+	// Spread retries so a burst of failures doesn't come back as a burst
+	jitter := time.Duration(rand.Int63n(int64(backoff)/5 + 1))
+	e.NextAttempt = now.Add(backoff - backoff/10 + jitter)
+	heap.Push(&c.queue, e)
+}
+
+func (c *Crawler) crawl(ctx context.Context, e *Endpoint) error {
+	host, portStr, _ := net.SplitHostPort(e.Address)
+	port, _ := strconv.Atoi(portStr)
+	res := &Result{Address: e.Address, IP: host, Port: port, Time: time.Now(), AdvertBy: e.AdvertBy}
+
+	peer, err := p2p.Connect(ctx, e.Address, c.p2pCfg)
+	if err != nil {
+		log.Debug().Err(err).Str("addr", e.Address).Int("failures", e.Failures).Msg("Crawl failed")
+		res.Err = err
+		c.onResult(res)
+		return err
+	}
+	peer.Close()
+
+	res.Latency = peer.Latency
+	res.NodeData = peer.Handshake.NodeData
+	res.SyncData = peer.Handshake.PayloadData
+	res.Peerlist = peer.Peerlist
+
+	log.Info().
+		Str("addr", e.Address).
+		Uint64("height", res.SyncData.CurrentHeight).
+		Str("version", res.SyncData.ClientVersion).
+		Int("peers", len(res.Peerlist)).
+		Msg("Crawled node")
+
+	c.onResult(res)
+
+	for _, p := range res.Peerlist {
+		c.add(p.Address(), e.Address)
+	}
+	return nil
+}
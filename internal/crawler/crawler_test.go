@@ -0,0 +1,270 @@
+package crawler_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"zano-peer-finder/internal/crawler"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/simnet"
+)
+
+// collector gathers the first result per address
+type collector struct {
+	mu      sync.Mutex
+	results map[string]*crawler.Result
+	added   chan struct{}
+}
+
+func newCollector() *collector {
+	return &collector{results: make(map[string]*crawler.Result), added: make(chan struct{}, 1)}
+}
+
+func (c *collector) onResult(r *crawler.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.results[r.Address]; ok {
+		return
+	}
+	c.results[r.Address] = r
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+}
+
+// wait returns once n addresses have a result, or fails the test
+func (c *collector) wait(t *testing.T, n int) map[string]*crawler.Result {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.results) >= n {
+			out := make(map[string]*crawler.Result, len(c.results))
+			for k, v := range c.results {
+				out[k] = v
+			}
+			c.mu.Unlock()
+			return out
+		}
+		got := len(c.results)
+		c.mu.Unlock()
+
+		select {
+		case <-c.added:
+		case <-deadline:
+			t.Fatalf("got %d results, want %d", got, n)
+		}
+	}
+}
+
+// startCrawler runs a crawler over the simulated network from a single seed
+func startCrawler(t *testing.T, sim *simnet.Network, cfg crawler.Config, seed string) (*crawler.Crawler, *collector) {
+	t.Helper()
+	p2pCfg := p2p.NewConfig(sim.NetworkID)
+	p2pCfg.Timeout = 500 * time.Millisecond
+
+	col := newCollector()
+	c := crawler.New(p2pCfg, cfg, col.onResult)
+	c.Add(seed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return c, col
+}
+
+func TestCrawlFanOut(t *testing.T) {
+	sim, err := simnet.New(network.Mainnet.NetworkID, []simnet.NodeSpec{
+		{Height: 100, Peers: []int{1, 2}},
+		{Height: 101, Peers: []int{3}},
+		{Height: 102, Peers: []int{0, 4, 5, 6}},
+		{Height: 103},
+		{Behavior: simnet.BehaviorRefuse},
+		{Behavior: simnet.BehaviorTimeout},
+		{Behavior: simnet.BehaviorMalformed},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	_, col := startCrawler(t, sim, crawler.Config{Concurrency: 4}, sim.Nodes[0].Addr)
+	results := col.wait(t, len(sim.Nodes))
+
+	advertBy := map[int]int{1: 0, 2: 0, 3: 1, 4: 2, 5: 2, 6: 2}
+	for i, node := range sim.Nodes {
+		r := results[node.Addr]
+		if r == nil {
+			t.Fatalf("node %d was never crawled", i)
+		}
+		if i == 0 {
+			if r.AdvertBy != "" {
+				t.Errorf("seed advertised by %s", r.AdvertBy)
+			}
+		} else if want := sim.Nodes[advertBy[i]].Addr; r.AdvertBy != want {
+			t.Errorf("node %d advertised by %s, want %s", i, r.AdvertBy, want)
+		}
+
+		if i >= 4 {
+			if r.Err == nil {
+				t.Errorf("node %d crawl succeeded", i)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("node %d: %v", i, r.Err)
+			continue
+		}
+		if r.NodeData.PeerID != node.PeerID || r.SyncData.CurrentHeight != uint64(100+i) {
+			t.Errorf("node %d gave peer id %d height %d", i, r.NodeData.PeerID, r.SyncData.CurrentHeight)
+		}
+	}
+
+	// The peer lists are ingested as they were advertised
+	if got := results[sim.Nodes[2].Addr].Peerlist; len(got) != 4 || got[0].Address() != sim.Nodes[0].Addr {
+		t.Errorf("unexpected peer list %v", got)
+	}
+	if sim.Nodes[0].Handshakes.Load() != 1 {
+		t.Errorf("seed saw %d handshakes, want 1 before its revisit", sim.Nodes[0].Handshakes.Load())
+	}
+}
+
+func TestCrawlFailureBackoff(t *testing.T) {
+	sim, err := simnet.New(network.Mainnet.NetworkID, []simnet.NodeSpec{
+		{Peers: []int{1}},
+		{Behavior: simnet.BehaviorRefuse},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	cfg := crawler.Config{MinBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond, MaxFailures: 3}
+	c, col := startCrawler(t, sim, cfg, sim.Nodes[0].Addr)
+	col.wait(t, 2)
+
+	// The refusing endpoint has never answered, so it is dropped once it
+	// has failed MaxFailures times
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		known := make(map[string]bool)
+		for _, e := range c.Snapshot() {
+			known[e.Address] = true
+		}
+		if !known[sim.Nodes[1].Addr] {
+			if !known[sim.Nodes[0].Addr] {
+				t.Fatal("reachable seed was dropped")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unreachable endpoint was never dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCrawlAllow(t *testing.T) {
+	sim, err := simnet.New(network.Mainnet.NetworkID, []simnet.NodeSpec{
+		{Peers: []int{1}, ExtraPeers: []p2p.PeerlistEntry{{IP: net.IPv4(10, 0, 0, 1), Port: 11121}}},
+		{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	// The simulated nodes are on loopback; the private address the seed
+	// also advertises is never added
+	cfg := crawler.Config{Allow: func(ip string) bool { return ip == "127.0.0.1" }}
+	c, col := startCrawler(t, sim, cfg, sim.Nodes[0].Addr)
+	col.wait(t, 2)
+
+	time.Sleep(200 * time.Millisecond)
+	for _, e := range c.Snapshot() {
+		if e.Host != "127.0.0.1" {
+			t.Errorf("rejected endpoint %s was added", e.Address)
+		}
+	}
+	if known, _, _ := c.Stats(); known != 2 {
+		t.Errorf("crawler knows %d endpoints, want 2", known)
+	}
+
+	// Seeds and restored endpoints pass through the same filter
+	c.Add("192.0.2.1:11121")
+	c.Restore([]crawler.Endpoint{{Address: "10.0.0.2:11121", NextAttempt: time.Now()}})
+	if known, _, _ := c.Stats(); known != 2 {
+		t.Errorf("crawler knows %d endpoints after adding rejected ones, want 2", known)
+	}
+}
+
+func TestCrawlMaxEndpoints(t *testing.T) {
+	sim, err := simnet.New(network.Mainnet.NetworkID, []simnet.NodeSpec{
+		{Peers: []int{1, 2, 3}},
+		{}, {}, {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	c, col := startCrawler(t, sim, crawler.Config{MaxEndpoints: 2}, sim.Nodes[0].Addr)
+	col.wait(t, 2)
+
+	time.Sleep(200 * time.Millisecond)
+	if known, _, _ := c.Stats(); known != 2 {
+		t.Errorf("crawler knows %d endpoints, want the cap of 2", known)
+	}
+}
+
+func TestCrawlForgetsDeadEndpoints(t *testing.T) {
+	sim, err := simnet.New(network.Mainnet.NetworkID, []simnet.NodeSpec{
+		{Behavior: simnet.BehaviorRefuse},
+		{Behavior: simnet.BehaviorRefuse},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	p2pCfg := p2p.NewConfig(sim.NetworkID)
+	p2pCfg.Timeout = 500 * time.Millisecond
+	col := newCollector()
+	c := crawler.New(p2pCfg, crawler.Config{MaxFailures: 1, ForgetAfter: 24 * time.Hour}, col.onResult)
+
+	// Both answered once; only the one silent for longer than ForgetAfter
+	// is dropped on its next failure
+	now := time.Now()
+	c.Restore([]crawler.Endpoint{
+		{Address: sim.Nodes[0].Addr, LastAttempt: now.Add(-48 * time.Hour), LastSuccess: now.Add(-48 * time.Hour), NextAttempt: now},
+		{Address: sim.Nodes[1].Addr, LastAttempt: now.Add(-time.Hour), LastSuccess: now.Add(-time.Hour), NextAttempt: now},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	col.wait(t, 2)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	snapshot := c.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Address != sim.Nodes[1].Addr {
+		t.Fatalf("kept %v, want only the recently reached endpoint", snapshot)
+	}
+}
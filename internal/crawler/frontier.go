@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Endpoint is the scheduling state of one crawl target
+type Endpoint struct {
+	Address     string
+	Host        string
+	AdvertBy    string // endpoint whose peer list led us here, empty for seeds
+	Attempts    int
+	Failures    int // consecutive failures since the last success
+	LastAttempt time.Time
+	LastSuccess time.Time
+	NextAttempt time.Time
+
+	index int // position in the frontier heap, -1 while in flight
+}
+
+// contacted reports whether we have ever tried the endpoint
+func (e *Endpoint) contacted() bool {
+	return !e.LastAttempt.IsZero()
+}
+
+// frontier is a priority queue of endpoints. Never-contacted endpoints come
+// first so discovery isn't starved by revisits; within each group the
+// earliest NextAttempt wins.
+type frontier []*Endpoint
+
+func (f frontier) Len() int { return len(f) }
+
+func (f frontier) Less(i, j int) bool {
+	if f[i].contacted() != f[j].contacted() {
+		return !f[i].contacted()
+	}
+	return f[i].NextAttempt.Before(f[j].NextAttempt)
+}
+
+func (f frontier) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+	f[i].index = i
+	f[j].index = j
+}
+
+func (f *frontier) Push(x interface{}) {
+	e := x.(*Endpoint)
+	e.index = len(*f)
+	*f = append(*f, e)
+}
+
+func (f *frontier) Pop() interface{} {
+	old := *f
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*f = old[:n-1]
+	return e
+}
+
+var _ heap.Interface = (*frontier)(nil)
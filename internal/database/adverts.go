@@ -0,0 +1,188 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Advertisement is one edge of the peer graph: Advertiser listed the
+// endpoint IP:Port in a peer list it sent us
+type Advertisement struct {
+	Advertiser       string    `json:"advertiser"`
+	IP               string    `json:"ip"`
+	Port             int       `json:"port"`
+	PeerID           string    `json:"peerId"`
+	ReportedLastSeen time.Time `json:"reportedLastSeen"` // When the advertiser last saw the endpoint
+	FirstObserved    time.Time `json:"firstObserved"`    // When we first saw this edge
+	LastObserved     time.Time `json:"lastObserved"`     // When we last saw this edge
+}
+
+// UnreachableEndpoint is an advertised endpoint that has never completed a
+// handshake with us
+type UnreachableEndpoint struct {
+	IP           string    `json:"ip"`
+	Port         int       `json:"port"`
+	Advertisers  int       `json:"advertisers"`
+	LastObserved time.Time `json:"lastObserved"`
+}
+
+// PeerlistStaleness summarises how old the entries in a node's peer list are
+type PeerlistStaleness struct {
+	Advertiser string        `json:"advertiser"`
+	Entries    int           `json:"entries"`
+	MedianAge  time.Duration `json:"medianAge"`
+	MaxAge     time.Duration `json:"maxAge"`
+}
+
+// RecordAdvertisements stores the peer list advertiser sent us, keeping the
+// first time each edge was observed
+func (d *DB) RecordAdvertisements(advertiser string, ads []*Advertisement) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO peer_adverts (
+			network, advertiser, ip, port, peer_id, reported_last_seen, first_observed, last_observed
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(network, advertiser, ip, port) DO UPDATE SET
+			peer_id = excluded.peer_id,
+			reported_last_seen = excluded.reported_last_seen,
+			last_observed = excluded.last_observed
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, ad := range ads {
+		_, err = stmt.Exec(d.network, advertiser, ad.IP, ad.Port, ad.PeerID, ad.ReportedLastSeen.UTC(), now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAdvertisements returns every edge observed since the given time
+func (d *DB) GetAdvertisements(since time.Time) ([]*Advertisement, error) {
+	return d.queryAdvertisements(`
+		WHERE network = ? AND last_observed >= ?
+		ORDER BY advertiser, ip, port
+	`, d.network, since.UTC())
+}
+
+// GetAdvertisementsBy returns the peer list most recently reported by advertiser
+func (d *DB) GetAdvertisementsBy(advertiser string) ([]*Advertisement, error) {
+	return d.queryAdvertisements(`
+		WHERE network = ? AND advertiser = ?
+		ORDER BY reported_last_seen DESC
+	`, d.network, advertiser)
+}
+
+// GetAdvertisersOf returns every edge pointing at the endpoint ip:port
+func (d *DB) GetAdvertisersOf(ip string, port int) ([]*Advertisement, error) {
+	return d.queryAdvertisements(`
+		WHERE network = ? AND ip = ? AND port = ?
+		ORDER BY last_observed DESC
+	`, d.network, ip, port)
+}
+
+func (d *DB) queryAdvertisements(where string, args ...interface{}) ([]*Advertisement, error) {
+	rows, err := d.db.Query(`
+		SELECT advertiser, ip, port, peer_id, reported_last_seen, first_observed, last_observed
+		FROM peer_adverts
+	`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ads []*Advertisement
+	for rows.Next() {
+		var ad Advertisement
+		err := rows.Scan(&ad.Advertiser, &ad.IP, &ad.Port, &ad.PeerID,
+			&ad.ReportedLastSeen, &ad.FirstObserved, &ad.LastObserved)
+		if err != nil {
+			return nil, err
+		}
+		ads = append(ads, &ad)
+	}
+	return ads, rows.Err()
+}
+
+// GetUnreachableAdvertised returns endpoints advertised since the given time
+// that have never completed a handshake with us
+func (d *DB) GetUnreachableAdvertised(since time.Time) ([]*UnreachableEndpoint, error) {
+	rows, err := d.db.Query(`
+		SELECT a.ip, a.port, COUNT(DISTINCT a.advertiser), MAX(a.last_observed)
+		FROM peer_adverts a
+		WHERE a.network = ? AND a.last_observed >= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM nodes n
+				WHERE n.network = a.network AND n.ip = a.ip AND n.port = a.port
+					AND n.last_handshake > '0001-01-01 00:00:00+00:00'
+			)
+		GROUP BY a.ip, a.port
+		ORDER BY COUNT(DISTINCT a.advertiser) DESC
+	`, d.network, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*UnreachableEndpoint
+	for rows.Next() {
+		var e UnreachableEndpoint
+		var lastObserved string
+		if err := rows.Scan(&e.IP, &e.Port, &e.Advertisers, &lastObserved); err != nil {
+			return nil, err
+		}
+		// MAX() loses the column type, so the timestamp comes back as text
+		e.LastObserved, _ = time.Parse("2006-01-02 15:04:05.999999999-07:00", lastObserved)
+		endpoints = append(endpoints, &e)
+	}
+	return endpoints, rows.Err()
+}
+
+// GetPeerlistStaleness reports, per advertiser seen since the given time, how
+// long ago it last saw the peers it advertises
+func (d *DB) GetPeerlistStaleness(since time.Time) ([]*PeerlistStaleness, error) {
+	ads, err := d.GetAdvertisements(since)
+	if err != nil {
+		return nil, err
+	}
+
+	ages := make(map[string][]time.Duration)
+	for _, ad := range ads {
+		// Rows recorded before zero last_seen values were decoded as no
+		// time hold the epoch instead
+		if ad.ReportedLastSeen.IsZero() || ad.ReportedLastSeen.Unix() <= 0 {
+			continue
+		}
+		ages[ad.Advertiser] = append(ages[ad.Advertiser], ad.LastObserved.Sub(ad.ReportedLastSeen))
+	}
+
+	result := make([]*PeerlistStaleness, 0, len(ages))
+	for advertiser, a := range ages {
+		sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+		result = append(result, &PeerlistStaleness{
+			Advertiser: advertiser,
+			Entries:    len(a),
+			MedianAge:  a[len(a)/2],
+			MaxAge:     a[len(a)-1],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].MedianAge > result[j].MedianAge })
+	return result, nil
+}
+
+// PruneAdvertisements deletes edges not observed since the given time
+func (d *DB) PruneAdvertisements(before time.Time) error {
+	_, err := d.db.Exec("DELETE FROM peer_adverts WHERE network = ? AND last_observed < ?", d.network, before.UTC())
+	return err
+}
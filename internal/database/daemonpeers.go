@@ -0,0 +1,97 @@
+package database
+
+import (
+	"time"
+)
+
+// Where the local daemon reported a peer
+const (
+	DaemonPeerConnection = "connection" // Live connection table
+	DaemonPeerWhite      = "white"      // White peer list, peers it has connected to
+	DaemonPeerGray       = "gray"       // Gray peer list, peers it has only heard of
+)
+
+// DaemonPeer is an endpoint reported by the local zanod over RPC
+type DaemonPeer struct {
+	IP               string    `json:"ip"`
+	Port             int       `json:"port"`
+	Source           string    `json:"source"`
+	PeerID           string    `json:"peerId"`
+	Direction        string    `json:"direction,omitempty"` // "inbound" or "outbound", connections only
+	ConnectedSince   time.Time `json:"connectedSince"`      // Connections only
+	ReportedLastSeen time.Time `json:"reportedLastSeen"`    // Peer lists only
+	FirstObserved    time.Time `json:"firstObserved"`
+	LastObserved     time.Time `json:"lastObserved"`
+}
+
+// RecordDaemonPeers stores one poll of the local daemon's connections and
+// peer lists, keeping the first time each entry was observed
+func (d *DB) RecordDaemonPeers(peers []*DaemonPeer) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO daemon_peers (
+			network, ip, port, source, peer_id, direction, connected_since,
+			reported_last_seen, first_observed, last_observed
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(network, ip, port, source) DO UPDATE SET
+			peer_id = excluded.peer_id,
+			direction = excluded.direction,
+			connected_since = excluded.connected_since,
+			reported_last_seen = excluded.reported_last_seen,
+			last_observed = excluded.last_observed
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, p := range peers {
+		_, err = stmt.Exec(d.network, p.IP, p.Port, p.Source, p.PeerID, p.Direction,
+			p.ConnectedSince.UTC(), p.ReportedLastSeen.UTC(), now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDaemonPeers returns entries observed since the given time, live
+// connections first
+func (d *DB) GetDaemonPeers(since time.Time) ([]*DaemonPeer, error) {
+	rows, err := d.db.Query(`
+		SELECT ip, port, source, COALESCE(peer_id, ''), COALESCE(direction, ''),
+			connected_since, reported_last_seen, first_observed, last_observed
+		FROM daemon_peers
+		WHERE network = ? AND last_observed >= ?
+		ORDER BY source = ? DESC, last_observed DESC
+	`, d.network, since.UTC(), DaemonPeerConnection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peers []*DaemonPeer
+	for rows.Next() {
+		var p DaemonPeer
+		err := rows.Scan(&p.IP, &p.Port, &p.Source, &p.PeerID, &p.Direction,
+			&p.ConnectedSince, &p.ReportedLastSeen, &p.FirstObserved, &p.LastObserved)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, &p)
+	}
+	return peers, rows.Err()
+}
+
+// PruneDaemonPeers deletes entries not observed since the given time
+func (d *DB) PruneDaemonPeers(before time.Time) error {
+	_, err := d.db.Exec("DELETE FROM daemon_peers WHERE network = ? AND last_observed < ?", d.network, before.UTC())
+	return err
+}
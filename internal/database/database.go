@@ -2,36 +2,24 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
+	"zano-peer-finder/internal/network"
+
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog/log"
 )
 
 type Node struct {
-	IP          string    `json:"ip"`
-	Country     string    `json:"country"`
-	City        string    `json:"city"`
-	Lat         float64   `json:"lat"`
-	Lon         float64   `json:"lon"`
-	ISP         string    `json:"isp"`
+	Network string `json:"network"`
+	IP      string `json:"ip"`
+	Port    int    `json:"port"` // P2P port; together with IP it identifies the node
+	Geo
 	LastSeen    time.Time `json:"lastSeen"`
-	Region      string    `json:"region"`
-	RegionName  string    `json:"regionName"`
-	Timezone    string    `json:"timezone"`
-	Zip         string    `json:"zip"`
-	AS          string    `json:"as"`
-	Org         string    `json:"org"`
-	Query       string    `json:"query"`
-	Status      string    `json:"status"`
-	CountryCode string    `json:"countryCode"`
-	District    string    `json:"district"`
-	Continent   string    `json:"continent"`
-	Currency    string    `json:"currency"`
-	Mobile      bool      `json:"mobile"`
-	Proxy       bool      `json:"proxy"`
-	Hosting     bool      `json:"hosting"`
 	IsOnline    bool      `json:"isOnline"`
 	LastPing    time.Time `json:"lastPing"`
 	FirstSeen   time.Time `json:"firstSeen"`
@@ -39,121 +27,865 @@ type Node struct {
 	OnlinePings int       `json:"onlinePings"`
 	Uptime      int64     `json:"uptime"` // Uptime in seconds
 	IsStaking   bool      `json:"isStaking"`
+
+	// Protocol metadata reported by the node during a Levin handshake
+	PeerID        string    `json:"peerId"`
+	MyPort        int       `json:"myPort"`
+	NetworkID     string    `json:"networkId"`
+	ClientVersion string    `json:"clientVersion"`
+	TopHeight     uint64    `json:"topHeight"`
+	TopBlockID    string    `json:"topBlockId"`
+	LocalTime     int64     `json:"localTime"` // Remote clock as unix seconds
+	LastHandshake time.Time `json:"lastHandshake"`
+	LastLevinPing time.Time `json:"lastLevinPing"` // Last answer to COMMAND_PING
+
+	// Daemon RPC status from the last getinfo probe of the node's RPC port
+	PublicRPC       bool      `json:"publicRpc"`
+	RPCPort         int       `json:"rpcPort"`
+	RPCHeight       uint64    `json:"rpcHeight"`
+	RPCTopBlockID   string    `json:"rpcTopBlockId"`
+	RPCSynchronized bool      `json:"rpcSynchronized"`
+	RPCLatency      int64     `json:"rpcLatency"` // Milliseconds
+	LastRPCCheck    time.Time `json:"lastRpcCheck"`
+
+	// Last peer event the zanod log parser reported for the node
+	LogEvent   string    `json:"logEvent"`
+	LogEventAt time.Time `json:"logEventAt"`
+}
+
+// Geo is the ip-api geolocation of an address. It is stored once per IP
+// and shared by every endpoint on that IP.
+type Geo struct {
+	Country     string  `json:"country"`
+	City        string  `json:"city"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	ISP         string  `json:"isp"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"regionName"`
+	Timezone    string  `json:"timezone"`
+	Zip         string  `json:"zip"`
+	AS          string  `json:"as"`
+	Org         string  `json:"org"`
+	Query       string  `json:"query"`
+	Status      string  `json:"status"`
+	CountryCode string  `json:"countryCode"`
+	District    string  `json:"district"`
+	Continent   string  `json:"continent"`
+	Currency    string  `json:"currency"`
+	Mobile      bool    `json:"mobile"`
+	Proxy       bool    `json:"proxy"`
+	Hosting     bool    `json:"hosting"`
+}
+
+// HeightSample is one timed sync observation of a node's chain tip
+type HeightSample struct {
+	IP           string    `json:"ip"`
+	Port         int       `json:"port"`
+	SampledAt    time.Time `json:"sampledAt"`
+	Height       uint64    `json:"height"`
+	TopBlockID   string    `json:"topBlockId"`
+	MedianHeight uint64    `json:"medianHeight"`
+	Lag          int64     `json:"lag"` // Blocks behind the network median
+}
+
+// RPCStatus holds the result of probing a node's daemon RPC port
+type RPCStatus struct {
+	Public       bool // A genuine Zano daemon answered getinfo
+	Port         int
+	Height       uint64
+	TopBlockID   string
+	Synchronized bool
+	Latency      time.Duration
+}
+
+// Handshake holds the fields recorded from a successful Levin handshake
+type Handshake struct {
+	PeerID        string
+	MyPort        int
+	NetworkID     string
+	ClientVersion string
+	TopHeight     uint64
+	TopBlockID    string
+	LocalTime     int64
+}
+
+// nodeColumns lists the columns read by GetNode and GetAllNodes, in scan
+// order. They are selected from nodesFrom; an IP that hasn't been
+// geolocated yet reads as an empty Geo.
+const nodeColumns = `n.ip, n.port, COALESCE(g.country, ''), COALESCE(g.city, ''), COALESCE(g.lat, 0), COALESCE(g.lon, 0), COALESCE(g.isp, ''), n.last_seen,
+			COALESCE(g.region, ''), COALESCE(g.region_name, ''), COALESCE(g.timezone, ''), COALESCE(g.zip, ''),
+			COALESCE(g.as_number, ''), COALESCE(g.org, ''), COALESCE(g.query, ''), COALESCE(g.status, ''),
+			COALESCE(g.country_code, ''), COALESCE(g.district, ''), COALESCE(g.continent, ''), COALESCE(g.currency, ''),
+			COALESCE(g.mobile, FALSE), COALESCE(g.proxy, FALSE), COALESCE(g.hosting, FALSE),
+			n.is_online, n.last_ping, n.first_seen, n.total_pings, n.online_pings, n.uptime,
+			n.is_staking, n.peer_id, n.my_port, n.network_id, n.client_version,
+			n.top_height, n.top_block_id, n.local_time, n.last_handshake, n.network,
+			n.public_rpc, n.rpc_port, n.rpc_height, n.rpc_top_block_id,
+			n.rpc_synchronized, n.rpc_latency, n.last_rpc_check, n.log_event, n.log_event_at,
+			n.last_levin_ping`
+
+// nodesFrom joins each endpoint with the geolocation of its IP
+const nodesFrom = `nodes n LEFT JOIN ip_geo g ON g.ip = n.ip`
+
+// scanNode scans a row selected with nodeColumns
+func scanNode(row interface{ Scan(...interface{}) error }, node *Node) error {
+	return row.Scan(
+		&node.IP, &node.Port, &node.Country, &node.City, &node.Lat, &node.Lon, &node.ISP, &node.LastSeen,
+		&node.Region, &node.RegionName, &node.Timezone, &node.Zip, &node.AS, &node.Org, &node.Query, &node.Status,
+		&node.CountryCode, &node.District, &node.Continent, &node.Currency, &node.Mobile, &node.Proxy, &node.Hosting,
+		&node.IsOnline, &node.LastPing, &node.FirstSeen, &node.TotalPings, &node.OnlinePings, &node.Uptime,
+		&node.IsStaking, &node.PeerID, &node.MyPort, &node.NetworkID, &node.ClientVersion,
+		&node.TopHeight, &node.TopBlockID, &node.LocalTime, &node.LastHandshake, &node.Network,
+		&node.PublicRPC, &node.RPCPort, &node.RPCHeight, &node.RPCTopBlockID,
+		&node.RPCSynchronized, &node.RPCLatency, &node.LastRPCCheck, &node.LogEvent, &node.LogEventAt,
+		&node.LastLevinPing)
 }
 
 type DB struct {
-	db *sql.DB
+	db      *sql.DB
+	network string
 }
 
-func New(dbPath string) (*DB, error) {
+// legacyNodesSchema defines the nodes table as it was before nodes were
+// keyed by endpoint, with geolocation inline. It is only used to rebuild
+// tables from before networks were tracked, ahead of the endpoint
+// migration. The table name is a parameter so the same definition serves
+// creation and the rebuild migrations.
+const legacyNodesSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL DEFAULT 'mainnet',
+		ip TEXT NOT NULL,
+		country TEXT,
+		city TEXT,
+		lat REAL,
+		lon REAL,
+		isp TEXT,
+		last_seen TIMESTAMP,
+		region TEXT,
+		region_name TEXT,
+		timezone TEXT,
+		zip TEXT,
+		as_number TEXT,
+		org TEXT,
+		query TEXT,
+		status TEXT,
+		country_code TEXT,
+		district TEXT,
+		continent TEXT,
+		currency TEXT,
+		mobile BOOLEAN,
+		proxy BOOLEAN,
+		hosting BOOLEAN,
+		is_online BOOLEAN,
+		last_ping TIMESTAMP,
+		first_seen TIMESTAMP,
+		total_pings INTEGER DEFAULT 0,
+		online_pings INTEGER DEFAULT 0,
+		uptime INTEGER DEFAULT 0,
+		is_staking BOOLEAN DEFAULT FALSE,
+		peer_id TEXT DEFAULT '',
+		my_port INTEGER DEFAULT 0,
+		network_id TEXT DEFAULT '',
+		client_version TEXT DEFAULT '',
+		top_height INTEGER DEFAULT 0,
+		top_block_id TEXT DEFAULT '',
+		local_time INTEGER DEFAULT 0,
+		last_handshake TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		public_rpc BOOLEAN DEFAULT FALSE,
+		rpc_port INTEGER DEFAULT 0,
+		rpc_height INTEGER DEFAULT 0,
+		rpc_top_block_id TEXT DEFAULT '',
+		rpc_synchronized BOOLEAN DEFAULT FALSE,
+		rpc_latency INTEGER DEFAULT 0,
+		last_rpc_check TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		log_event TEXT DEFAULT '',
+		log_event_at TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		last_levin_ping TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		PRIMARY KEY (network, ip)
+	)
+`
+
+// nodesSchema defines the nodes table, one row per P2P endpoint. The table
+// name is a parameter so the same definition serves creation and the
+// rebuild migrations.
+const nodesSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL DEFAULT 'mainnet',
+		ip TEXT NOT NULL,
+		port INTEGER NOT NULL DEFAULT 0,
+		last_seen TIMESTAMP,
+		is_online BOOLEAN,
+		last_ping TIMESTAMP,
+		first_seen TIMESTAMP,
+		total_pings INTEGER DEFAULT 0,
+		online_pings INTEGER DEFAULT 0,
+		uptime INTEGER DEFAULT 0,
+		is_staking BOOLEAN DEFAULT FALSE,
+		peer_id TEXT DEFAULT '',
+		my_port INTEGER DEFAULT 0,
+		network_id TEXT DEFAULT '',
+		client_version TEXT DEFAULT '',
+		top_height INTEGER DEFAULT 0,
+		top_block_id TEXT DEFAULT '',
+		local_time INTEGER DEFAULT 0,
+		last_handshake TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		public_rpc BOOLEAN DEFAULT FALSE,
+		rpc_port INTEGER DEFAULT 0,
+		rpc_height INTEGER DEFAULT 0,
+		rpc_top_block_id TEXT DEFAULT '',
+		rpc_synchronized BOOLEAN DEFAULT FALSE,
+		rpc_latency INTEGER DEFAULT 0,
+		last_rpc_check TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		log_event TEXT DEFAULT '',
+		log_event_at TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		last_levin_ping TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00',
+		PRIMARY KEY (network, ip, port)
+	)
+`
+
+// geoColumns are the ip_geo columns holding a Geo, in struct order
+const geoColumns = `country, city, lat, lon, isp, region, region_name, timezone, zip,
+		as_number, org, query, status, country_code, district, continent, currency,
+		mobile, proxy, hosting`
+
+// ipGeoSchema defines the per-IP geolocation table. Geolocation doesn't
+// depend on the network, so the table isn't scoped to one.
+const ipGeoSchema = `
+	CREATE TABLE IF NOT EXISTS ip_geo (
+		ip TEXT PRIMARY KEY,
+		country TEXT,
+		city TEXT,
+		lat REAL,
+		lon REAL,
+		isp TEXT,
+		region TEXT,
+		region_name TEXT,
+		timezone TEXT,
+		zip TEXT,
+		as_number TEXT,
+		org TEXT,
+		query TEXT,
+		status TEXT,
+		country_code TEXT,
+		district TEXT,
+		continent TEXT,
+		currency TEXT,
+		mobile BOOLEAN,
+		proxy BOOLEAN,
+		hosting BOOLEAN,
+		updated_at TIMESTAMP NOT NULL
+	)
+`
+
+// legacyPeersSchema defines the saved peers table as it was before peers
+// were stored by endpoint, when ip held "ip:port" strings or bare IPs. It
+// is only used to rebuild tables from before networks were tracked, ahead
+// of the endpoint migration.
+const legacyPeersSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL DEFAULT 'mainnet',
+		ip TEXT NOT NULL,
+		PRIMARY KEY (network, ip)
+	)
+`
+
+// peersSchema defines the saved peers table, one row per endpoint
+const peersSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL DEFAULT 'mainnet',
+		ip TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		PRIMARY KEY (network, ip, port)
+	)
+`
+
+// nodeSourcesSchema defines the discovery sources table, one row per
+// endpoint and source
+const nodeSourcesSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		sightings INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (network, ip, port, source)
+	)
+`
+
+// blockAnnouncementsSchema defines the block announcements table, one row
+// per endpoint and height
+const blockAnnouncementsSchema = `
+	CREATE TABLE IF NOT EXISTS %s (
+		network TEXT NOT NULL,
+		height INTEGER NOT NULL,
+		ip TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		block_id TEXT,
+		announced_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (network, height, ip, port)
+	)
+`
+
+// New opens the database at dbPath. All reads and writes through the
+// returned DB are scoped to network, so one database can hold several
+// networks without mixing them.
+func New(dbPath string, network string) (*DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create nodes table if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf(nodesSchema, "nodes"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create IP geolocation table if it doesn't exist
+	_, err = db.Exec(ipGeoSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create peers table if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf(peersSchema, "peers"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create height samples table if it doesn't exist
 	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS nodes (
-			ip TEXT PRIMARY KEY,
-			country TEXT,
-			city TEXT,
-			lat REAL,
-			lon REAL,
-			isp TEXT,
-			last_seen TIMESTAMP,
-			region TEXT,
-			region_name TEXT,
-			timezone TEXT,
-			zip TEXT,
-			as_number TEXT,
-			org TEXT,
-			query TEXT,
-			status TEXT,
-			country_code TEXT,
-			district TEXT,
-			continent TEXT,
-			currency TEXT,
-			mobile BOOLEAN,
-			proxy BOOLEAN,
-			hosting BOOLEAN,
-			is_online BOOLEAN,
-			last_ping TIMESTAMP,
-			first_seen TIMESTAMP,
-			total_pings INTEGER DEFAULT 0,
-			online_pings INTEGER DEFAULT 0,
-			uptime INTEGER DEFAULT 0,
-			is_staking BOOLEAN DEFAULT FALSE
+		CREATE TABLE IF NOT EXISTS height_samples (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			network TEXT NOT NULL DEFAULT 'mainnet',
+			ip TEXT NOT NULL,
+			port INTEGER DEFAULT 0,
+			sampled_at TIMESTAMP NOT NULL,
+			height INTEGER NOT NULL,
+			top_block_id TEXT,
+			median_height INTEGER NOT NULL
 		)
 	`)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create peers table if it doesn't exist
+	// Create peer advertisement graph table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS peer_adverts (
+			network TEXT NOT NULL,
+			advertiser TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			peer_id TEXT,
+			reported_last_seen TIMESTAMP,
+			first_observed TIMESTAMP NOT NULL,
+			last_observed TIMESTAMP NOT NULL,
+			PRIMARY KEY (network, advertiser, ip, port)
+		);
+		CREATE INDEX IF NOT EXISTS idx_peer_adverts_endpoint ON peer_adverts (network, ip, port);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create local daemon peer table if it doesn't exist
 	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS peers (
-			ip TEXT PRIMARY KEY
+		CREATE TABLE IF NOT EXISTS daemon_peers (
+			network TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			peer_id TEXT,
+			direction TEXT,
+			connected_since TIMESTAMP,
+			reported_last_seen TIMESTAMP,
+			first_observed TIMESTAMP NOT NULL,
+			last_observed TIMESTAMP NOT NULL,
+			PRIMARY KEY (network, ip, port, source)
 		)
 	`)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add is_staking column if it doesn't exist
+	// Create fork alerts table if it doesn't exist
 	_, err = db.Exec(`
-		ALTER TABLE nodes ADD COLUMN is_staking BOOLEAN DEFAULT FALSE;
+		CREATE TABLE IF NOT EXISTS fork_alerts (
+			network TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			height INTEGER NOT NULL,
+			block_id TEXT NOT NULL,
+			majority_block_id TEXT,
+			majority_nodes INTEGER DEFAULT 0,
+			nodes TEXT,
+			detail TEXT,
+			first_detected TIMESTAMP NOT NULL,
+			last_detected TIMESTAMP NOT NULL,
+			PRIMARY KEY (network, kind, height, block_id)
+		)
 	`)
-	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+	if err != nil {
+		return nil, err
+	}
+
+	// Create block announcements table if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf(blockAnnouncementsSchema, "block_announcements"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create crawl frontier table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS crawl_frontier (
+			network TEXT NOT NULL,
+			address TEXT NOT NULL,
+			advert_by TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_attempt TIMESTAMP,
+			last_success TIMESTAMP,
+			next_attempt TIMESTAMP,
+			PRIMARY KEY (network, address)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create node discovery sources table if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf(nodeSourcesSchema, "node_sources"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Add columns introduced after the initial schema if they don't exist
+	migrations := []struct{ table, column string }{
+		{"nodes", "is_staking BOOLEAN DEFAULT FALSE"},
+		{"nodes", "peer_id TEXT DEFAULT ''"},
+		{"nodes", "my_port INTEGER DEFAULT 0"},
+		{"nodes", "network_id TEXT DEFAULT ''"},
+		{"nodes", "client_version TEXT DEFAULT ''"},
+		{"nodes", "top_height INTEGER DEFAULT 0"},
+		{"nodes", "top_block_id TEXT DEFAULT ''"},
+		{"nodes", "local_time INTEGER DEFAULT 0"},
+		{"nodes", "last_handshake TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00'"},
+		{"height_samples", "network TEXT NOT NULL DEFAULT 'mainnet'"},
+		{"nodes", "public_rpc BOOLEAN DEFAULT FALSE"},
+		{"nodes", "rpc_port INTEGER DEFAULT 0"},
+		{"nodes", "rpc_height INTEGER DEFAULT 0"},
+		{"nodes", "rpc_synchronized BOOLEAN DEFAULT FALSE"},
+		{"nodes", "rpc_latency INTEGER DEFAULT 0"},
+		{"nodes", "last_rpc_check TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00'"},
+		{"nodes", "rpc_top_block_id TEXT DEFAULT ''"},
+		{"nodes", "log_event TEXT DEFAULT ''"},
+		{"nodes", "log_event_at TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00'"},
+		{"height_samples", "port INTEGER DEFAULT 0"},
+		{"nodes", "last_levin_ping TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00'"},
+	}
+	for _, m := range migrations {
+		_, err = db.Exec("ALTER TABLE " + m.table + " ADD COLUMN " + m.column)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, err
+		}
+	}
+
+	// Drop columns that are no longer written, before any rebuild copies them
+	dropped := []struct{ table, column string }{
+		{"nodes", "rpc_version"},
+	}
+	for _, m := range dropped {
+		_, err = db.Exec("ALTER TABLE " + m.table + " DROP COLUMN " + m.column)
+		if err != nil && !strings.Contains(err.Error(), "no such column") {
+			return nil, err
+		}
+	}
+
+	// Tables created before networks were tracked are keyed on ip alone and
+	// need rebuilding; their rows all belong to mainnet
+	if err := rebuildWithNetwork(db, "nodes", legacyNodesSchema); err != nil {
+		return nil, err
+	}
+	if err := rebuildWithNetwork(db, "peers", legacyPeersSchema); err != nil {
+		return nil, err
+	}
+
+	// Nodes tables keyed on ip need their endpoints and geolocation split
+	if err := migrateNodesToEndpoints(db); err != nil {
+		return nil, err
+	}
+	if err := migrateAnnouncementsToEndpoints(db); err != nil {
+		return nil, err
+	}
+	if err := migrateSourcesToEndpoints(db); err != nil {
 		return nil, err
 	}
+	if err := migratePeersToEndpoints(db); err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_height_samples_ip ON height_samples (network, ip, sampled_at)`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{db: db, network: network}, nil
+}
+
+// Network returns the network this DB is scoped to
+func (d *DB) Network() string {
+	return d.network
+}
+
+// columns returns the column names of table in declaration order
+func columns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var (
+			cid       int
+			name, typ string
+			notNull   bool
+			dflt      sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// rebuildWithNetwork recreates table from schema if it lacks the network
+// column, copying every existing row in as mainnet
+func rebuildWithNetwork(db *sql.DB, table, schema string) error {
+	cols, err := columns(db, table)
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if c == "network" {
+			return nil
+		}
+	}
+
+	log.Info().Str("table", table).Msg("Migrating table to per-network keys")
+	list := strings.Join(cols, ", ")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		fmt.Sprintf(schema, table+"_rebuild"),
+		fmt.Sprintf("INSERT INTO %s_rebuild (network, %s) SELECT 'mainnet', %s FROM %s", table, list, list, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s_rebuild RENAME TO %s", table, table),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error migrating %s: %v", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateNodesToEndpoints rebuilds a nodes table keyed on ip into one keyed
+// on (ip, port), moving geolocation into ip_geo. Each existing row takes
+// the port the node announced in its last handshake, or its network's
+// default P2P port.
+func migrateNodesToEndpoints(db *sql.DB) error {
+	cols, err := columns(db, "nodes")
+	if err != nil {
+		return err
+	}
+	geo := make(map[string]bool)
+	for _, c := range strings.Split(geoColumns, ",") {
+		geo[strings.TrimSpace(c)] = true
+	}
+	var kept []string
+	for _, c := range cols {
+		if c == "port" {
+			return nil
+		}
+		if !geo[c] {
+			kept = append(kept, c)
+		}
+	}
+
+	log.Info().Msg("Migrating nodes to per-endpoint keys")
+	list := strings.Join(kept, ", ")
+
+	port := "CASE WHEN my_port > 0 THEN my_port"
+	for _, name := range network.Names() {
+		profile, _ := network.Lookup(name)
+		port += fmt.Sprintf(" WHEN network = '%s' THEN %d", name, profile.P2PPort)
+	}
+	port += " ELSE 0 END"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		// An IP on several networks keeps its most recent lookup
+		fmt.Sprintf(`INSERT OR IGNORE INTO ip_geo (ip, %s, updated_at)
+			SELECT ip, %s, COALESCE(last_seen, CURRENT_TIMESTAMP) FROM nodes
+			WHERE status = 'success' ORDER BY last_seen DESC`, geoColumns, geoColumns),
+		fmt.Sprintf(nodesSchema, "nodes_rebuild"),
+		fmt.Sprintf("INSERT INTO nodes_rebuild (port, %s) SELECT %s, %s FROM nodes", list, port, list),
+		"DROP TABLE nodes",
+		"ALTER TABLE nodes_rebuild RENAME TO nodes",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error migrating nodes: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateAnnouncementsToEndpoints rebuilds a block announcements table
+// keyed on ip into one keyed on (ip, port). Existing rows take their
+// network's default P2P port.
+func migrateAnnouncementsToEndpoints(db *sql.DB) error {
+	cols, err := columns(db, "block_announcements")
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if c == "port" {
+			return nil
+		}
+	}
+
+	log.Info().Msg("Migrating block announcements to per-endpoint keys")
+	list := strings.Join(cols, ", ")
 
-	return &DB{db: db}, nil
+	port := "CASE"
+	for _, name := range network.Names() {
+		profile, _ := network.Lookup(name)
+		port += fmt.Sprintf(" WHEN network = '%s' THEN %d", name, profile.P2PPort)
+	}
+	port += " ELSE 0 END"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		fmt.Sprintf(blockAnnouncementsSchema, "block_announcements_rebuild"),
+		fmt.Sprintf("INSERT INTO block_announcements_rebuild (port, %s) SELECT %s, %s FROM block_announcements", list, port, list),
+		"DROP TABLE block_announcements",
+		"ALTER TABLE block_announcements_rebuild RENAME TO block_announcements",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error migrating block announcements: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateSourcesToEndpoints rebuilds a discovery sources table keyed on ip
+// into one keyed on (ip, port). Each existing row is copied to every
+// endpoint recorded on its IP, or to the network's default P2P port when
+// there is none.
+func migrateSourcesToEndpoints(db *sql.DB) error {
+	cols, err := columns(db, "node_sources")
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if c == "port" {
+			return nil
+		}
+	}
+
+	log.Info().Msg("Migrating discovery sources to per-endpoint keys")
+
+	port := "CASE"
+	for _, name := range network.Names() {
+		profile, _ := network.Lookup(name)
+		port += fmt.Sprintf(" WHEN s.network = '%s' THEN %d", name, profile.P2PPort)
+	}
+	port += " ELSE 0 END"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		fmt.Sprintf(nodeSourcesSchema, "node_sources_rebuild"),
+		fmt.Sprintf(`INSERT INTO node_sources_rebuild (network, ip, port, source, first_seen, last_seen, sightings)
+			SELECT s.network, s.ip, COALESCE(n.port, %s), s.source, s.first_seen, s.last_seen, s.sightings
+			FROM node_sources s LEFT JOIN nodes n ON n.network = s.network AND n.ip = s.ip`, port),
+		"DROP TABLE node_sources",
+		"ALTER TABLE node_sources_rebuild RENAME TO node_sources",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error migrating discovery sources: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migratePeersToEndpoints rebuilds a saved peers table whose ip column
+// holds "ip:port" strings, or bare IPs saved by older versions, into one
+// with the port in a column of its own. Bare IPs take their network's
+// default P2P port; values that aren't an address are dropped.
+func migratePeersToEndpoints(db *sql.DB) error {
+	cols, err := columns(db, "peers")
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if c == "port" {
+			return nil
+		}
+	}
+
+	log.Info().Msg("Migrating saved peers to per-endpoint keys")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT network, ip FROM peers")
+	if err != nil {
+		return err
+	}
+	type savedRow struct{ network, value string }
+	var saved []savedRow
+	for rows.Next() {
+		var r savedRow
+		if err := rows.Scan(&r.network, &r.value); err != nil {
+			rows.Close()
+			return err
+		}
+		saved = append(saved, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(peersSchema, "peers_rebuild")); err != nil {
+		return fmt.Errorf("error migrating saved peers: %v", err)
+	}
+	for _, r := range saved {
+		host, portStr, err := net.SplitHostPort(r.value)
+		port, _ := strconv.Atoi(portStr)
+		if err != nil {
+			host, port = r.value, 0
+			if profile, err := network.Lookup(r.network); err == nil {
+				port = profile.P2PPort
+			}
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || port <= 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO peers_rebuild (network, ip, port) VALUES (?, ?, ?)", r.network, ip.String(), port); err != nil {
+			return fmt.Errorf("error migrating saved peers: %v", err)
+		}
+	}
+	for _, stmt := range []string{"DROP TABLE peers", "ALTER TABLE peers_rebuild RENAME TO peers"} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error migrating saved peers: %v", err)
+		}
+	}
+	return tx.Commit()
 }
 
 func (d *DB) Close() error {
 	return d.db.Close()
 }
 
+// UpsertNode stores a node's endpoint row and, if the node carries a
+// geolocation lookup result, its IP's geolocation
 func (d *DB) UpsertNode(node *Node) error {
 	log.Debug().
 		Str("ip", node.IP).
+		Int("port", node.Port).
 		Str("country", node.Country).
 		Str("city", node.City).
 		Float64("lat", node.Lat).
 		Float64("lon", node.Lon).
 		Msg("Upserting node to database")
 
-	_, err := d.db.Exec(`
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if node.Status != "" {
+		_, err = tx.Exec(`
+			INSERT INTO ip_geo (ip, `+geoColumns+`, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(ip) DO UPDATE SET
+				country = excluded.country,
+				city = excluded.city,
+				lat = excluded.lat,
+				lon = excluded.lon,
+				isp = excluded.isp,
+				region = excluded.region,
+				region_name = excluded.region_name,
+				timezone = excluded.timezone,
+				zip = excluded.zip,
+				as_number = excluded.as_number,
+				org = excluded.org,
+				query = excluded.query,
+				status = excluded.status,
+				country_code = excluded.country_code,
+				district = excluded.district,
+				continent = excluded.continent,
+				currency = excluded.currency,
+				mobile = excluded.mobile,
+				proxy = excluded.proxy,
+				hosting = excluded.hosting,
+				updated_at = excluded.updated_at
+		`, node.IP, node.Country, node.City, node.Lat, node.Lon, node.ISP,
+			node.Region, node.RegionName, node.Timezone, node.Zip, node.AS, node.Org, node.Query, node.Status,
+			node.CountryCode, node.District, node.Continent, node.Currency, node.Mobile, node.Proxy, node.Hosting,
+			time.Now().UTC())
+		if err != nil {
+			log.Error().Err(err).Str("ip", node.IP).Msg("Error upserting node geolocation")
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
 		INSERT INTO nodes (
-			ip, country, city, lat, lon, isp, last_seen,
-			region, region_name, timezone, zip, as_number, org, query, status,
-			country_code, district, continent, currency, mobile, proxy, hosting,
+			network, ip, port, last_seen,
 			is_online, last_ping, first_seen, total_pings, online_pings, uptime,
 			is_staking
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(ip) DO UPDATE SET
-			country = excluded.country,
-			city = excluded.city,
-			lat = excluded.lat,
-			lon = excluded.lon,
-			isp = excluded.isp,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(network, ip, port) DO UPDATE SET
 			last_seen = excluded.last_seen,
-			region = excluded.region,
-			region_name = excluded.region_name,
-			timezone = excluded.timezone,
-			zip = excluded.zip,
-			as_number = excluded.as_number,
-			org = excluded.org,
-			query = excluded.query,
-			status = excluded.status,
-			country_code = excluded.country_code,
-			district = excluded.district,
-			continent = excluded.continent,
-			currency = excluded.currency,
-			mobile = excluded.mobile,
-			proxy = excluded.proxy,
-			hosting = excluded.hosting,
 			is_online = excluded.is_online,
 			last_ping = excluded.last_ping,
 			first_seen = excluded.first_seen,
@@ -161,35 +893,49 @@ func (d *DB) UpsertNode(node *Node) error {
 			online_pings = excluded.online_pings,
 			uptime = excluded.uptime,
 			is_staking = excluded.is_staking
-	`, node.IP, node.Country, node.City, node.Lat, node.Lon, node.ISP, node.LastSeen,
-		node.Region, node.RegionName, node.Timezone, node.Zip, node.AS, node.Org, node.Query, node.Status,
-		node.CountryCode, node.District, node.Continent, node.Currency, node.Mobile, node.Proxy, node.Hosting,
+	`, d.network, node.IP, node.Port, node.LastSeen,
 		node.IsOnline, node.LastPing, node.FirstSeen, node.TotalPings, node.OnlinePings, node.Uptime, node.IsStaking)
-
 	if err != nil {
-		log.Error().Err(err).Str("ip", node.IP).Msg("Error upserting node")
+		log.Error().Err(err).Str("ip", node.IP).Int("port", node.Port).Msg("Error upserting node")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
-	log.Debug().Str("ip", node.IP).Msg("Successfully upserted node")
+	log.Debug().Str("ip", node.IP).Int("port", node.Port).Msg("Successfully upserted node")
 	return nil
 }
 
-func (d *DB) GetNode(ip string) (*Node, error) {
-	var node Node
+// GetGeo returns the stored geolocation of ip, or nil if it has none
+func (d *DB) GetGeo(ip string) (*Geo, error) {
+	var g Geo
 	err := d.db.QueryRow(`
-		SELECT ip, country, city, lat, lon, isp, last_seen,
-			region, region_name, timezone, zip, as_number, org, query, status,
-			country_code, district, continent, currency, mobile, proxy, hosting,
-			is_online, last_ping, first_seen, total_pings, online_pings, uptime,
-			is_staking
-		FROM nodes
+		SELECT `+geoColumns+`
+		FROM ip_geo
 		WHERE ip = ?
 	`, ip).Scan(
-		&node.IP, &node.Country, &node.City, &node.Lat, &node.Lon, &node.ISP, &node.LastSeen,
-		&node.Region, &node.RegionName, &node.Timezone, &node.Zip, &node.AS, &node.Org, &node.Query, &node.Status,
-		&node.CountryCode, &node.District, &node.Continent, &node.Currency, &node.Mobile, &node.Proxy, &node.Hosting,
-		&node.IsOnline, &node.LastPing, &node.FirstSeen, &node.TotalPings, &node.OnlinePings, &node.Uptime, &node.IsStaking)
+		&g.Country, &g.City, &g.Lat, &g.Lon, &g.ISP,
+		&g.Region, &g.RegionName, &g.Timezone, &g.Zip, &g.AS, &g.Org, &g.Query, &g.Status,
+		&g.CountryCode, &g.District, &g.Continent, &g.Currency, &g.Mobile, &g.Proxy, &g.Hosting)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetNode returns the node at the endpoint ip:port, or nil if there is none
+func (d *DB) GetNode(ip string, port int) (*Node, error) {
+	var node Node
+	err := scanNode(d.db.QueryRow(`
+		SELECT `+nodeColumns+`
+		FROM `+nodesFrom+`
+		WHERE n.network = ? AND n.ip = ? AND n.port = ?
+	`, d.network, ip, port), &node)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -199,18 +945,39 @@ func (d *DB) GetNode(ip string) (*Node, error) {
 	return &node, nil
 }
 
+// GetNodesByIP returns every endpoint recorded on ip, most recently seen first
+func (d *DB) GetNodesByIP(ip string) ([]*Node, error) {
+	rows, err := d.db.Query(`
+		SELECT `+nodeColumns+`
+		FROM `+nodesFrom+`
+		WHERE n.network = ? AND n.ip = ?
+		ORDER BY n.last_seen DESC
+	`, d.network, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*Node
+	for rows.Next() {
+		node := &Node{}
+		if err := scanNode(rows, node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
 func (d *DB) GetAllNodes() ([]*Node, error) {
 	log.Debug().Msg("Retrieving all nodes from database")
 
 	rows, err := d.db.Query(`
-		SELECT ip, country, city, lat, lon, isp, last_seen,
-			region, region_name, timezone, zip, as_number, org, query, status,
-			country_code, district, continent, currency, mobile, proxy, hosting,
-			is_online, last_ping, first_seen, total_pings, online_pings, uptime,
-			is_staking
-		FROM nodes
-		ORDER BY last_seen DESC
-	`)
+		SELECT ` + nodeColumns + `
+		FROM ` + nodesFrom + `
+		WHERE n.network = ?
+		ORDER BY n.last_seen DESC
+	`, d.network)
 	if err != nil {
 		log.Error().Err(err).Msg("Error querying nodes")
 		return nil, err
@@ -220,12 +987,7 @@ func (d *DB) GetAllNodes() ([]*Node, error) {
 	var nodes []*Node
 	for rows.Next() {
 		var node Node
-		err := rows.Scan(
-			&node.IP, &node.Country, &node.City, &node.Lat, &node.Lon, &node.ISP, &node.LastSeen,
-			&node.Region, &node.RegionName, &node.Timezone, &node.Zip, &node.AS, &node.Org, &node.Query, &node.Status,
-			&node.CountryCode, &node.District, &node.Continent, &node.Currency, &node.Mobile, &node.Proxy, &node.Hosting,
-			&node.IsOnline, &node.LastPing, &node.FirstSeen, &node.TotalPings, &node.OnlinePings, &node.Uptime, &node.IsStaking)
-		if err != nil {
+		if err := scanNode(rows, &node); err != nil {
 			log.Error().Err(err).Msg("Error scanning node row")
 			return nil, err
 		}
@@ -238,10 +1000,10 @@ func (d *DB) GetAllNodes() ([]*Node, error) {
 
 func (d *DB) GetStaleNodes(olderThan time.Duration) ([]string, error) {
 	rows, err := d.db.Query(`
-		SELECT ip
+		SELECT DISTINCT ip
 		FROM nodes
-		WHERE last_seen < datetime('now', ?)
-	`, olderThan.String())
+		WHERE network = ? AND last_seen < datetime('now', ?)
+	`, d.network, olderThan.String())
 	if err != nil {
 		return nil, err
 	}
@@ -258,17 +1020,18 @@ func (d *DB) GetStaleNodes(olderThan time.Duration) ([]string, error) {
 	return ips, rows.Err()
 }
 
-func (d *DB) UpdateNodeStatus(ip string, isOnline bool) error {
+func (d *DB) UpdateNodeStatus(ip string, port int, isOnline bool) error {
 	now := time.Now()
 	log.Debug().
 		Str("ip", ip).
+		Int("port", port).
 		Bool("isOnline", isOnline).
 		Time("now", now).
 		Msg("Updating node status")
 
 	// Get current node stats
 	var node Node
-	err := d.db.QueryRow("SELECT first_seen, total_pings, online_pings, uptime, is_online, last_ping FROM nodes WHERE ip = ?", ip).Scan(
+	err := d.db.QueryRow("SELECT first_seen, total_pings, online_pings, uptime, is_online, last_ping FROM nodes WHERE network = ? AND ip = ? AND port = ?", d.network, ip, port).Scan(
 		&node.FirstSeen,
 		&node.TotalPings,
 		&node.OnlinePings,
@@ -323,8 +1086,8 @@ func (d *DB) UpdateNodeStatus(ip string, isOnline bool) error {
 			online_pings = ?,
 			uptime = ?,
 			is_staking = ?
-		WHERE ip = ?
-	`, isOnline, now, node.TotalPings, node.OnlinePings, node.Uptime, isStaking, ip)
+		WHERE network = ? AND ip = ? AND port = ?
+	`, isOnline, now, node.TotalPings, node.OnlinePings, node.Uptime, isStaking, d.network, ip, port)
 
 	if err != nil {
 		log.Error().
@@ -347,8 +1110,244 @@ func (d *DB) UpdateNodeStatus(ip string, isOnline bool) error {
 	return nil
 }
 
+// UpdateNodeHandshake records protocol metadata from a successful handshake.
+// UpsertNode leaves these columns alone, so log-discovered updates don't
+// wipe what the node told us about itself.
+func (d *DB) UpdateNodeHandshake(ip string, port int, hs *Handshake) error {
+	_, err := d.db.Exec(`
+		UPDATE nodes
+		SET peer_id = ?,
+			my_port = ?,
+			network_id = ?,
+			client_version = ?,
+			top_height = ?,
+			top_block_id = ?,
+			local_time = ?,
+			last_handshake = ?
+		WHERE network = ? AND ip = ? AND port = ?
+	`, hs.PeerID, hs.MyPort, hs.NetworkID, hs.ClientVersion, int64(hs.TopHeight), hs.TopBlockID, hs.LocalTime, time.Now(), d.network, ip, port)
+	if err != nil {
+		log.Error().Err(err).Str("ip", ip).Int("port", port).Msg("Error updating node handshake")
+		return err
+	}
+
+	log.Debug().
+		Str("ip", ip).
+		Int("port", port).
+		Str("peerId", hs.PeerID).
+		Str("version", hs.ClientVersion).
+		Uint64("height", hs.TopHeight).
+		Msg("Updated node handshake")
+	return nil
+}
+
+// UpdateNodeRPC records the outcome of probing a node's daemon RPC port.
+// A failed probe clears the public RPC flag along with the last answer's
+// height, top block and latency, keeping only the port and check time. The
+// RPC port belongs to the host, so every endpoint on ip is updated.
+func (d *DB) UpdateNodeRPC(ip string, st *RPCStatus) error {
+	if !st.Public {
+		// Clear the last answer so its tip isn't taken for a fresh one
+		_, err := d.db.Exec(`
+			UPDATE nodes
+			SET public_rpc = FALSE, rpc_synchronized = FALSE, rpc_height = 0, rpc_top_block_id = '',
+				rpc_latency = 0, last_rpc_check = ?
+			WHERE network = ? AND ip = ?
+		`, time.Now().UTC(), d.network, ip)
+		return err
+	}
+
+	_, err := d.db.Exec(`
+		UPDATE nodes
+		SET public_rpc = TRUE,
+			rpc_port = ?,
+			rpc_height = ?,
+			rpc_top_block_id = ?,
+			rpc_synchronized = ?,
+			rpc_latency = ?,
+			last_rpc_check = ?
+		WHERE network = ? AND ip = ?
+	`, st.Port, int64(st.Height), st.TopBlockID, st.Synchronized, st.Latency.Milliseconds(), time.Now().UTC(), d.network, ip)
+	return err
+}
+
+// GetPublicRPCNodes returns nodes whose RPC answered as a synchronized Zano
+// daemon since the given time, fastest first and freshest among equals.
+// Each IP is listed once, by its lowest-numbered endpoint; the RPC fields
+// are the same on all of them.
+func (d *DB) GetPublicRPCNodes(since time.Time) ([]*Node, error) {
+	rows, err := d.db.Query(`
+		SELECT `+nodeColumns+`
+		FROM `+nodesFrom+`
+		WHERE n.network = ? AND n.public_rpc AND n.rpc_synchronized AND n.last_rpc_check >= ?
+			AND n.port = (
+				SELECT MIN(o.port) FROM nodes o
+				WHERE o.network = n.network AND o.ip = n.ip
+					AND o.public_rpc AND o.rpc_synchronized AND o.last_rpc_check >= ?
+			)
+		ORDER BY n.rpc_latency ASC, n.last_rpc_check DESC, n.ip ASC
+	`, d.network, since.UTC(), since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*Node
+	for rows.Next() {
+		node := &Node{}
+		if err := scanNode(rows, node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+// UpdateNodeHeight records the latest chain tip reported by a node
+func (d *DB) UpdateNodeHeight(ip string, port int, height uint64, topBlockID string) error {
+	_, err := d.db.Exec(`
+		UPDATE nodes
+		SET top_height = ?, top_block_id = ?
+		WHERE network = ? AND ip = ? AND port = ?
+	`, int64(height), topBlockID, d.network, ip, port)
+	return err
+}
+
+// UpdateNodeLogEvent records the last peer event parsed from zanod's log
+// for a node
+func (d *DB) UpdateNodeLogEvent(ip string, port int, event string, at time.Time) error {
+	_, err := d.db.Exec(`
+		UPDATE nodes
+		SET log_event = ?, log_event_at = ?
+		WHERE network = ? AND ip = ? AND port = ?
+	`, event, at, d.network, ip, port)
+	return err
+}
+
+// UpdateNodeLevinPing records that a node answered a Levin COMMAND_PING
+func (d *DB) UpdateNodeLevinPing(ip string, port int, at time.Time) error {
+	_, err := d.db.Exec(`
+		UPDATE nodes
+		SET last_levin_ping = ?
+		WHERE network = ? AND ip = ? AND port = ?
+	`, at, d.network, ip, port)
+	return err
+}
+
+// ExtendNodeSeen widens a node's first/last seen window to include the
+// given times, for sightings that aren't happening now such as those
+// replayed from old logs. It reports whether the node exists.
+func (d *DB) ExtendNodeSeen(ip string, port int, firstSeen, lastSeen time.Time) (bool, error) {
+	var storedFirst, storedLast sql.NullTime
+	err := d.db.QueryRow("SELECT first_seen, last_seen FROM nodes WHERE network = ? AND ip = ? AND port = ?", d.network, ip, port).Scan(&storedFirst, &storedLast)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	first, last := storedFirst.Time, storedLast.Time
+	if first.IsZero() || firstSeen.Before(first) {
+		first = firstSeen
+	}
+	if lastSeen.After(last) {
+		last = lastSeen
+	}
+	_, err = d.db.Exec(`
+		UPDATE nodes
+		SET first_seen = ?, last_seen = ?
+		WHERE network = ? AND ip = ? AND port = ?
+	`, first, last, d.network, ip, port)
+	return true, err
+}
+
+// AddHeightSamples stores one sampling round in a single transaction
+func (d *DB) AddHeightSamples(samples []*HeightSample) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO height_samples (network, ip, port, sampled_at, height, top_block_id, median_height)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range samples {
+		_, err = stmt.Exec(d.network, s.IP, s.Port, s.SampledAt, int64(s.Height), s.TopBlockID, int64(s.MedianHeight))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetHeightSamples returns the samples of the node at ip:port since the
+// given time, oldest first. Port 0 returns the samples of every endpoint on
+// ip.
+func (d *DB) GetHeightSamples(ip string, port int, since time.Time) ([]*HeightSample, error) {
+	if port == 0 {
+		return d.queryHeightSamples(`
+			WHERE network = ? AND ip = ? AND sampled_at >= ?
+			ORDER BY sampled_at ASC
+		`, d.network, ip, since)
+	}
+	return d.queryHeightSamples(`
+		WHERE network = ? AND ip = ? AND port = ? AND sampled_at >= ?
+		ORDER BY sampled_at ASC
+	`, d.network, ip, port, since)
+}
+
+// GetAllHeightSamples returns every node's samples since the given time, oldest first
+func (d *DB) GetAllHeightSamples(since time.Time) ([]*HeightSample, error) {
+	return d.queryHeightSamples(`
+		WHERE network = ? AND sampled_at >= ?
+		ORDER BY sampled_at ASC
+	`, d.network, since)
+}
+
+func (d *DB) queryHeightSamples(where string, args ...interface{}) ([]*HeightSample, error) {
+	rows, err := d.db.Query(`
+		SELECT ip, COALESCE(port, 0), sampled_at, height, top_block_id, median_height
+		FROM height_samples
+	`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*HeightSample
+	for rows.Next() {
+		var s HeightSample
+		if err := rows.Scan(&s.IP, &s.Port, &s.SampledAt, &s.Height, &s.TopBlockID, &s.MedianHeight); err != nil {
+			return nil, err
+		}
+		s.Lag = int64(s.MedianHeight) - int64(s.Height)
+		samples = append(samples, &s)
+	}
+	return samples, rows.Err()
+}
+
+// PruneHeightSamples deletes samples older than the given time
+func (d *DB) PruneHeightSamples(before time.Time) error {
+	_, err := d.db.Exec("DELETE FROM height_samples WHERE network = ? AND sampled_at < ?", d.network, before)
+	return err
+}
+
+// SavedPeer is an endpoint the log scraper found, kept across restarts
+type SavedPeer struct {
+	IP   string
+	Port int
+}
+
 // Add new function to save peers
-func (d *DB) SavePeers(peers []string) error {
+func (d *DB) SavePeers(peers []SavedPeer) error {
 	// Start a transaction
 	tx, err := d.db.Begin()
 	if err != nil {
@@ -357,20 +1356,20 @@ func (d *DB) SavePeers(peers []string) error {
 	defer tx.Rollback()
 
 	// Clear existing peers
-	_, err = tx.Exec("DELETE FROM peers")
+	_, err = tx.Exec("DELETE FROM peers WHERE network = ?", d.network)
 	if err != nil {
 		return err
 	}
 
 	// Insert new peers
-	stmt, err := tx.Prepare("INSERT INTO peers (ip) VALUES (?)")
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO peers (network, ip, port) VALUES (?, ?, ?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, peer := range peers {
-		_, err = stmt.Exec(peer)
+		_, err = stmt.Exec(d.network, peer.IP, peer.Port)
 		if err != nil {
 			return err
 		}
@@ -380,20 +1379,20 @@ func (d *DB) SavePeers(peers []string) error {
 }
 
 // Add new function to load peers
-func (d *DB) LoadPeers() ([]string, error) {
-	rows, err := d.db.Query("SELECT ip FROM peers")
+func (d *DB) LoadPeers() ([]SavedPeer, error) {
+	rows, err := d.db.Query("SELECT ip, port FROM peers WHERE network = ?", d.network)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var peers []string
+	var peers []SavedPeer
 	for rows.Next() {
-		var ip string
-		if err := rows.Scan(&ip); err != nil {
+		var peer SavedPeer
+		if err := rows.Scan(&peer.IP, &peer.Port); err != nil {
 			return nil, err
 		}
-		peers = append(peers, ip)
+		peers = append(peers, peer)
 	}
 	return peers, rows.Err()
 }
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Kinds of fork alert
+const (
+	ForkMinorityChain      = "minority_chain"      // Nodes report a different block than most at the same height
+	ForkOrphanedTip        = "orphaned_tip"        // Nodes stopped on a block the network abandoned
+	ForkHardForkDivergence = "hardfork_divergence" // Nodes split off or stalled around a scheduled hard fork
+)
+
+// ForkAlert is one chain disagreement found by the fork analysis
+type ForkAlert struct {
+	Kind            string    `json:"kind"`
+	Height          uint64    `json:"height"`
+	BlockID         string    `json:"blockId"`         // Block the flagged nodes report
+	MajorityBlockID string    `json:"majorityBlockId"` // Block most nodes report at the same height, if known
+	MajorityNodes   int       `json:"majorityNodes"`
+	Nodes           []string  `json:"nodes"` // ip:port endpoints of the flagged nodes
+	Detail          string    `json:"detail"`
+	FirstDetected   time.Time `json:"firstDetected"`
+	LastDetected    time.Time `json:"lastDetected"`
+}
+
+// RecordForkAlert stores an alert, keeping when it was first detected.
+// It reports whether the alert is new.
+func (d *DB) RecordForkAlert(a *ForkAlert) (bool, error) {
+	now := time.Now().UTC()
+
+	var first time.Time
+	err := d.db.QueryRow(`
+		SELECT first_detected FROM fork_alerts
+		WHERE network = ? AND kind = ? AND height = ? AND block_id = ?
+	`, d.network, a.Kind, int64(a.Height), a.BlockID).Scan(&first)
+	isNew := err == sql.ErrNoRows
+	if err != nil && !isNew {
+		return false, err
+	}
+
+	_, err = d.db.Exec(`
+		INSERT INTO fork_alerts (
+			network, kind, height, block_id, majority_block_id, majority_nodes,
+			nodes, detail, first_detected, last_detected
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(network, kind, height, block_id) DO UPDATE SET
+			majority_block_id = excluded.majority_block_id,
+			majority_nodes = excluded.majority_nodes,
+			nodes = excluded.nodes,
+			detail = excluded.detail,
+			last_detected = excluded.last_detected
+	`, d.network, a.Kind, int64(a.Height), a.BlockID, a.MajorityBlockID, a.MajorityNodes,
+		strings.Join(a.Nodes, ","), a.Detail, now, now)
+	if err != nil {
+		return false, err
+	}
+
+	a.LastDetected = now
+	a.FirstDetected = now
+	if !isNew {
+		a.FirstDetected = first
+	}
+	return isNew, nil
+}
+
+// GetForkAlerts returns alerts detected since the given time, most recent first
+func (d *DB) GetForkAlerts(since time.Time) ([]*ForkAlert, error) {
+	rows, err := d.db.Query(`
+		SELECT kind, height, block_id, COALESCE(majority_block_id, ''), majority_nodes,
+			COALESCE(nodes, ''), COALESCE(detail, ''), first_detected, last_detected
+		FROM fork_alerts
+		WHERE network = ? AND last_detected >= ?
+		ORDER BY last_detected DESC, height DESC
+	`, d.network, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*ForkAlert
+	for rows.Next() {
+		var a ForkAlert
+		var nodes string
+		err := rows.Scan(&a.Kind, &a.Height, &a.BlockID, &a.MajorityBlockID, &a.MajorityNodes,
+			&nodes, &a.Detail, &a.FirstDetected, &a.LastDetected)
+		if err != nil {
+			return nil, err
+		}
+		if nodes != "" {
+			a.Nodes = strings.Split(nodes, ",")
+		}
+		alerts = append(alerts, &a)
+	}
+	return alerts, rows.Err()
+}
+
+// PruneForkAlerts deletes alerts not detected since the given time
+func (d *DB) PruneForkAlerts(before time.Time) error {
+	_, err := d.db.Exec("DELETE FROM fork_alerts WHERE network = ? AND last_detected < ?", d.network, before.UTC())
+	return err
+}
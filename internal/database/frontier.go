@@ -0,0 +1,73 @@
+package database
+
+import (
+	"time"
+)
+
+// FrontierEntry is the saved crawl state of one endpoint
+type FrontierEntry struct {
+	Address     string
+	AdvertBy    string
+	Attempts    int
+	Failures    int
+	LastAttempt time.Time
+	LastSuccess time.Time
+	NextAttempt time.Time
+}
+
+// SaveFrontier replaces the stored crawl frontier with entries
+func (d *DB) SaveFrontier(entries []*FrontierEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM crawl_frontier WHERE network = ?", d.network); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO crawl_frontier (
+			network, address, advert_by, attempts, failures, last_attempt, last_success, next_attempt
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		_, err = stmt.Exec(d.network, e.Address, e.AdvertBy, e.Attempts, e.Failures,
+			e.LastAttempt.UTC(), e.LastSuccess.UTC(), e.NextAttempt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadFrontier returns the crawl frontier saved for the current network
+func (d *DB) LoadFrontier() ([]*FrontierEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT address, COALESCE(advert_by, ''), attempts, failures, last_attempt, last_success, next_attempt
+		FROM crawl_frontier
+		WHERE network = ?
+	`, d.network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*FrontierEntry
+	for rows.Next() {
+		e := &FrontierEntry{}
+		if err := rows.Scan(&e.Address, &e.AdvertBy, &e.Attempts, &e.Failures,
+			&e.LastAttempt, &e.LastSuccess, &e.NextAttempt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
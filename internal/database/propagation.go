@@ -0,0 +1,262 @@
+package database
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// How a peer told us about a block
+const (
+	AnnounceNewBlock    = "new_block"    // NOTIFY_NEW_BLOCK
+	AnnounceFluffyBlock = "fluffy_block" // NOTIFY_NEW_FLUFFY_BLOCK
+	AnnounceTimedSync   = "timed_sync"   // A higher height in timed sync, only accurate to the sync interval
+)
+
+// propagationLookback is how far before a report's window announcements are
+// read to find each block's true first sighting
+const propagationLookback = 30 * time.Minute
+
+// BlockAnnouncement is the first time one peer told us about a block
+type BlockAnnouncement struct {
+	Height      uint64    `json:"height"` // Chain size including the block, as peers report it
+	IP          string    `json:"ip"`
+	Port        int       `json:"port"`
+	Source      string    `json:"source"`
+	BlockID     string    `json:"blockId,omitempty"`
+	AnnouncedAt time.Time `json:"announcedAt"`
+}
+
+// Percentiles summarises a set of propagation delays
+type Percentiles struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// BlockPropagation describes how one block spread among watched peers.
+// Delays are measured from the first announcement we received. Delays
+// covers blocks relayed to us; SyncDelays covers blocks we only learned of
+// through timed sync, which are accurate to the sync interval.
+type BlockPropagation struct {
+	Height         uint64      `json:"height"`
+	BlockID        string      `json:"blockId,omitempty"`
+	FirstSeen      time.Time   `json:"firstSeen"`
+	FirstAnnouncer string      `json:"firstAnnouncer"` // ip:port endpoint
+	Delays         Percentiles `json:"delays"`
+	SyncDelays     Percentiles `json:"syncDelays"`
+}
+
+// NodePropagation describes how quickly one peer relays blocks to us
+type NodePropagation struct {
+	IP         string      `json:"ip"`
+	Port       int         `json:"port"`
+	Delays     Percentiles `json:"delays"`
+	SyncDelays Percentiles `json:"syncDelays"`
+}
+
+// PropagationReport holds per-block, per-node and network-wide delays
+type PropagationReport struct {
+	Network     Percentiles         `json:"network"`
+	NetworkSync Percentiles         `json:"networkSync"`
+	Blocks      []*BlockPropagation `json:"blocks"`
+	Nodes       []*NodePropagation  `json:"nodes"`
+}
+
+// blockKey identifies a block by height and id, so competing blocks at one
+// height are kept apart
+type blockKey struct {
+	height uint64
+	id     string
+}
+
+// delaySet holds relay delays apart from the coarser timed sync ones
+type delaySet struct {
+	relay []time.Duration
+	sync  []time.Duration
+}
+
+func (s *delaySet) add(source string, delay time.Duration) {
+	if source == AnnounceTimedSync {
+		s.sync = append(s.sync, delay)
+	} else {
+		s.relay = append(s.relay, delay)
+	}
+}
+
+// RecordBlockAnnouncement stores an announcement unless the endpoint
+// already announced that height
+func (d *DB) RecordBlockAnnouncement(a *BlockAnnouncement) error {
+	_, err := d.db.Exec(`
+		INSERT INTO block_announcements (network, height, ip, port, source, block_id, announced_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(network, height, ip, port) DO UPDATE SET
+			block_id = COALESCE(NULLIF(block_announcements.block_id, ''), excluded.block_id)
+	`, d.network, int64(a.Height), a.IP, a.Port, a.Source, a.BlockID, a.AnnouncedAt.UTC())
+	return err
+}
+
+// GetBlockAnnouncements returns announcements made since the given time,
+// oldest first
+func (d *DB) GetBlockAnnouncements(since time.Time) ([]*BlockAnnouncement, error) {
+	rows, err := d.db.Query(`
+		SELECT height, ip, port, source, COALESCE(block_id, ''), announced_at
+		FROM block_announcements
+		WHERE network = ? AND announced_at >= ?
+		ORDER BY announced_at ASC
+	`, d.network, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anns []*BlockAnnouncement
+	for rows.Next() {
+		var a BlockAnnouncement
+		if err := rows.Scan(&a.Height, &a.IP, &a.Port, &a.Source, &a.BlockID, &a.AnnouncedAt); err != nil {
+			return nil, err
+		}
+		anns = append(anns, &a)
+	}
+	return anns, rows.Err()
+}
+
+// GetPropagation computes delay percentiles for blocks first announced since
+// the given time. Relay notifications carry no block id; the endpoint's
+// next timed sync usually fills it in. An announcement still without one
+// is attributed to the only block seen at its height, and left out when
+// several blocks competed for it.
+func (d *DB) GetPropagation(since time.Time) (*PropagationReport, error) {
+	// Read a little further back so a block first announced just before
+	// since isn't mistaken for one first announced by a later peer
+	anns, err := d.GetBlockAnnouncements(since.Add(-propagationLookback))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint64]map[string]bool)
+	for _, a := range anns {
+		if a.BlockID == "" {
+			continue
+		}
+		if ids[a.Height] == nil {
+			ids[a.Height] = make(map[string]bool)
+		}
+		ids[a.Height][a.BlockID] = true
+	}
+	keyOf := func(a *BlockAnnouncement) (blockKey, bool) {
+		if a.BlockID != "" {
+			return blockKey{a.Height, a.BlockID}, true
+		}
+		known := ids[a.Height]
+		if len(known) > 1 {
+			return blockKey{}, false
+		}
+		for id := range known {
+			return blockKey{a.Height, id}, true
+		}
+		return blockKey{height: a.Height}, true
+	}
+
+	// Announcements are oldest first, so the first one per block sets the baseline
+	blocks := make(map[blockKey]*BlockPropagation)
+	for _, a := range anns {
+		key, ok := keyOf(a)
+		if !ok {
+			continue
+		}
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = &BlockPropagation{Height: a.Height, BlockID: key.id, FirstSeen: a.AnnouncedAt, FirstAnnouncer: net.JoinHostPort(a.IP, strconv.Itoa(a.Port))}
+		}
+	}
+
+	type endpoint struct {
+		ip   string
+		port int
+	}
+	blockDelays := make(map[blockKey]*delaySet)
+	nodeDelays := make(map[endpoint]*delaySet)
+	var all delaySet
+	for _, a := range anns {
+		key, ok := keyOf(a)
+		if !ok {
+			continue
+		}
+		b := blocks[key]
+		if b.FirstSeen.Before(since) {
+			continue
+		}
+		delay := a.AnnouncedAt.Sub(b.FirstSeen)
+		if blockDelays[key] == nil {
+			blockDelays[key] = &delaySet{}
+		}
+		blockDelays[key].add(a.Source, delay)
+		ep := endpoint{a.IP, a.Port}
+		if nodeDelays[ep] == nil {
+			nodeDelays[ep] = &delaySet{}
+		}
+		nodeDelays[ep].add(a.Source, delay)
+		all.add(a.Source, delay)
+	}
+
+	report := &PropagationReport{Network: percentiles(all.relay), NetworkSync: percentiles(all.sync)}
+	for key, b := range blocks {
+		if b.FirstSeen.Before(since) {
+			continue
+		}
+		b.Delays = percentiles(blockDelays[key].relay)
+		b.SyncDelays = percentiles(blockDelays[key].sync)
+		report.Blocks = append(report.Blocks, b)
+	}
+	sort.Slice(report.Blocks, func(i, j int) bool {
+		if report.Blocks[i].Height != report.Blocks[j].Height {
+			return report.Blocks[i].Height > report.Blocks[j].Height
+		}
+		return report.Blocks[i].FirstSeen.Before(report.Blocks[j].FirstSeen)
+	})
+
+	for ep, delays := range nodeDelays {
+		report.Nodes = append(report.Nodes, &NodePropagation{IP: ep.ip, Port: ep.port, Delays: percentiles(delays.relay), SyncDelays: percentiles(delays.sync)})
+	}
+	// Nodes that relay blocks come first, fastest first, then those only
+	// measured through timed sync
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		a, b := report.Nodes[i], report.Nodes[j]
+		if (a.Delays.Count > 0) != (b.Delays.Count > 0) {
+			return a.Delays.Count > 0
+		}
+		if a.Delays.Count > 0 {
+			return a.Delays.P50 < b.Delays.P50
+		}
+		return a.SyncDelays.P50 < b.SyncDelays.P50
+	})
+
+	return report, nil
+}
+
+// PruneBlockAnnouncements deletes announcements made before the given time
+func (d *DB) PruneBlockAnnouncements(before time.Time) error {
+	_, err := d.db.Exec("DELETE FROM block_announcements WHERE network = ? AND announced_at < ?", d.network, before.UTC())
+	return err
+}
+
+func percentiles(delays []time.Duration) Percentiles {
+	if len(delays) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), delays...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	return Percentiles{
+		Count: len(sorted),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
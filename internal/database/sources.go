@@ -0,0 +1,102 @@
+package database
+
+import (
+	"time"
+)
+
+// NodeSource records when one discovery source reported a node's endpoint
+type NodeSource struct {
+	IP        string    `json:"ip"`
+	Port      int       `json:"port"`
+	Source    string    `json:"source"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Sightings int       `json:"sightings"`
+}
+
+// SourceSummary is how much one discovery source has contributed
+type SourceSummary struct {
+	Source string `json:"source"`
+	Nodes  int    `json:"nodes"`  // Endpoints the source reported
+	Unique int    `json:"unique"` // Endpoints no other source reported
+	First  int    `json:"first"`  // Endpoints the source reported before any other
+	Recent int    `json:"recent"` // Endpoints the source reported since the cutoff
+}
+
+// RecordNodeSource notes that source reported the endpoint ip and port at
+// seenAt. The first and last seen times only ever widen, so replayed or
+// delayed sightings are safe to record.
+func (d *DB) RecordNodeSource(ip string, port int, source string, seenAt time.Time) error {
+	seenAt = seenAt.UTC()
+	_, err := d.db.Exec(`
+		INSERT INTO node_sources (network, ip, port, source, first_seen, last_seen, sightings)
+		VALUES (?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(network, ip, port, source) DO UPDATE SET
+			first_seen = MIN(first_seen, excluded.first_seen),
+			last_seen = MAX(last_seen, excluded.last_seen),
+			sightings = sightings + 1
+	`, d.network, ip, port, source, seenAt, seenAt)
+	return err
+}
+
+// GetNodeSources returns the sources that reported an endpoint on ip,
+// earliest first. A port of 0 covers every endpoint on the IP.
+func (d *DB) GetNodeSources(ip string, port int) ([]*NodeSource, error) {
+	rows, err := d.db.Query(`
+		SELECT ip, port, source, first_seen, last_seen, sightings
+		FROM node_sources
+		WHERE network = ? AND ip = ? AND (? = 0 OR port = ?)
+		ORDER BY first_seen, port
+	`, d.network, ip, port, port)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*NodeSource
+	for rows.Next() {
+		var s NodeSource
+		if err := rows.Scan(&s.IP, &s.Port, &s.Source, &s.FirstSeen, &s.LastSeen, &s.Sightings); err != nil {
+			return nil, err
+		}
+		sources = append(sources, &s)
+	}
+	return sources, rows.Err()
+}
+
+// GetSourceSummaries returns every source's contribution. Recent counts
+// the endpoints reported since the given time.
+func (d *DB) GetSourceSummaries(since time.Time) ([]*SourceSummary, error) {
+	rows, err := d.db.Query(`
+		SELECT s.source,
+			COUNT(*),
+			SUM(NOT EXISTS (
+				SELECT 1 FROM node_sources o
+				WHERE o.network = s.network AND o.ip = s.ip AND o.port = s.port AND o.source != s.source
+			)),
+			SUM(NOT EXISTS (
+				SELECT 1 FROM node_sources o
+				WHERE o.network = s.network AND o.ip = s.ip AND o.port = s.port AND o.source != s.source
+					AND o.first_seen < s.first_seen
+			)),
+			SUM(s.last_seen >= ?)
+		FROM node_sources s
+		WHERE s.network = ?
+		GROUP BY s.source
+		ORDER BY COUNT(*) DESC
+	`, since.UTC(), d.network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*SourceSummary
+	for rows.Next() {
+		var s SourceSummary
+		if err := rows.Scan(&s.Source, &s.Nodes, &s.Unique, &s.First, &s.Recent); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &s)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,141 @@
+// Package discovery defines the sources peer-finder learns endpoints from
+// and the generic ones that don't depend on a running zanod.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sighting is one report of an endpoint by a source
+type Sighting struct {
+	IP         string
+	Port       int // 0 if the source doesn't know it
+	Source     string
+	ObservedAt time.Time // When the source saw the endpoint, not when it was reported
+	Event      string    // What the source saw happen, if it knows
+}
+
+// Emit receives a source's sightings. It must not block for long.
+type Emit func(Sighting)
+
+// Source is a discovery mechanism. Start begins reporting sightings to
+// emit until ctx is cancelled or Stop is called; Stop waits for the
+// source's goroutines to finish.
+type Source interface {
+	Name() string
+	Start(ctx context.Context, emit Emit) error
+	Stop()
+}
+
+// Manager runs a set of sources that all report to one emit function
+type Manager struct {
+	mu      sync.Mutex
+	sources []Source
+	started []Source
+}
+
+// NewManager returns a manager for the given sources
+func NewManager(sources ...Source) *Manager {
+	return &Manager{sources: sources}
+}
+
+// Add registers another source; it is started by the next Start
+func (m *Manager) Add(src Source) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources = append(m.sources, src)
+}
+
+// Start starts every source. A source that fails to start is logged and
+// skipped so the others keep running.
+func (m *Manager) Start(ctx context.Context, emit Emit) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, src := range m.sources {
+		if err := src.Start(ctx, emit); err != nil {
+			log.Error().Err(err).Str("source", src.Name()).Msg("Error starting discovery source")
+			continue
+		}
+		log.Info().Str("source", src.Name()).Msg("Started discovery source")
+		m.started = append(m.started, src)
+	}
+	m.sources = nil
+}
+
+// Stop stops every started source and waits for them
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, src := range m.started {
+		src.Stop()
+	}
+	m.started = nil
+}
+
+// ParseEndpoint splits "ip" or "ip:port" into its parts, using
+// defaultPort when no port is given. IPv6 addresses with a port are
+// bracketed, "[2001:db8::1]:11121"; without one the brackets are optional.
+// The IP is returned in canonical form.
+func ParseEndpoint(s string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port
+		host, portStr = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), strconv.Itoa(defaultPort)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", 0, fmt.Errorf("%q is not an IP address", host)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %q", s)
+	}
+	return ip.String(), port, nil
+}
+
+// poller runs a function now and then at an interval until stopped. It
+// backs the sources that re-check their input periodically.
+type poller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start runs fn immediately, then every interval if it is positive
+func (p *poller) start(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		fn(ctx)
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}()
+}
+
+// Stop cancels the poller and waits for the running call to return
+func (p *poller) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
@@ -0,0 +1,28 @@
+package discovery
+
+import "testing"
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		ip   string
+		port int
+		ok   bool
+	}{
+		{"95.216.50.10", "95.216.50.10", 11121, true},
+		{"95.216.50.10:11131", "95.216.50.10", 11131, true},
+		{"2A01:4F8:0:0::1", "2a01:4f8::1", 11121, true},
+		{"[2a01:4f8::1]", "2a01:4f8::1", 11121, true},
+		{"[2a01:4f8::1]:11131", "2a01:4f8::1", 11131, true},
+		{"::ffff:95.216.50.10", "95.216.50.10", 11121, true},
+		{"seeds.zano.org", "", 0, false},
+		{"95.216.50.10:0", "", 0, false},
+		{"95.216.50.10:70000", "", 0, false},
+	}
+	for _, tc := range tests {
+		ip, port, err := ParseEndpoint(tc.in, 11121)
+		if (err == nil) != tc.ok || ip != tc.ip || port != tc.port {
+			t.Errorf("%q parsed as %q, %d (%v), want %q, %d", tc.in, ip, port, err, tc.ip, tc.port)
+		}
+	}
+}
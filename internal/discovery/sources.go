@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Static reports a fixed list of endpoints, such as the network's seed
+// nodes, at start and then every Interval
+type Static struct {
+	poller
+	Endpoints   []string // "ip", "ip:port" or "[ipv6]:port"
+	DefaultPort int
+	Interval    time.Duration // 0 reports the list once
+}
+
+func (s *Static) Name() string { return "seed" }
+
+func (s *Static) Start(ctx context.Context, emit Emit) error {
+	s.start(ctx, s.Interval, func(ctx context.Context) {
+		now := time.Now()
+		for _, e := range s.Endpoints {
+			ip, port, err := ParseEndpoint(strings.TrimSpace(e), s.DefaultPort)
+			if err != nil {
+				log.Warn().Err(err).Msg("Skipping static endpoint")
+				continue
+			}
+			emit(Sighting{IP: ip, Port: port, Source: s.Name(), ObservedAt: now})
+		}
+	})
+	return nil
+}
+
+// File imports endpoints from a text file with one "ip", "ip:port" or
+// "[ipv6]:port" per line. Blank lines and lines starting with # are
+// ignored. The file is checked every Interval and read again when it
+// changes.
+type File struct {
+	poller
+	Path        string
+	DefaultPort int
+	Interval    time.Duration // 0 reads the file once
+
+	modTime time.Time
+	size    int64
+}
+
+func (f *File) Name() string { return "file" }
+
+func (f *File) Start(ctx context.Context, emit Emit) error {
+	// Fail early on a file that can't be read at all
+	if _, err := os.Stat(f.Path); err != nil {
+		return err
+	}
+	f.start(ctx, f.Interval, func(ctx context.Context) { f.read(emit) })
+	return nil
+}
+
+// read reports the file's endpoints if it changed since the last read
+func (f *File) read(emit Emit) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", f.Path).Msg("Error checking endpoint file")
+		return
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return
+	}
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", f.Path).Msg("Error opening endpoint file")
+		return
+	}
+	defer file.Close()
+
+	// Sightings carry the file's modification time: that's when its
+	// contents were last known to be current
+	observed := info.ModTime()
+	count, skipped := 0, 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ip, port, err := ParseEndpoint(line, f.DefaultPort)
+		if err != nil {
+			skipped++
+			continue
+		}
+		emit(Sighting{IP: ip, Port: port, Source: f.Name(), ObservedAt: observed})
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Str("path", f.Path).Msg("Error reading endpoint file")
+		return
+	}
+
+	f.modTime, f.size = info.ModTime(), info.Size()
+	log.Info().Str("path", f.Path).Int("endpoints", count).Int("skipped", skipped).Msg("Imported endpoint file")
+}
+
+// DNS resolves seed host names and reports every address they return, at
+// start and then every Interval
+type DNS struct {
+	poller
+	Hosts       []string // "host", "host:port" or an IP literal; both A and AAAA records are used
+	DefaultPort int
+	Interval    time.Duration // 0 resolves once
+	Resolver    *net.Resolver // net.DefaultResolver if nil
+}
+
+func (d *DNS) Name() string { return "dns" }
+
+func (d *DNS) Start(ctx context.Context, emit Emit) error {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	d.start(ctx, d.Interval, func(ctx context.Context) {
+		for _, h := range d.Hosts {
+			host, port, err := splitHostPort(strings.TrimSpace(h), d.DefaultPort)
+			if err != nil {
+				log.Warn().Err(err).Str("host", h).Msg("Skipping DNS seed")
+				continue
+			}
+
+			lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			addrs, err := resolver.LookupIPAddr(lookupCtx, host)
+			cancel()
+			if err != nil {
+				log.Warn().Err(err).Str("host", host).Msg("Error resolving DNS seed")
+				continue
+			}
+
+			now := time.Now()
+			for _, a := range addrs {
+				emit(Sighting{IP: a.IP.String(), Port: port, Source: d.Name(), ObservedAt: now})
+			}
+			log.Debug().Str("host", host).Int("addresses", len(addrs)).Msg("Resolved DNS seed")
+		}
+	})
+	return nil
+}
+
+// splitHostPort splits "host" or "host:port", using defaultPort when no
+// port is given. The host may be an IP literal; an IPv6 one needs brackets
+// only when a port follows.
+func splitHostPort(s string, defaultPort int) (string, int, error) {
+	if ip := strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"); net.ParseIP(ip) != nil {
+		return ip, defaultPort, nil
+	}
+	if !strings.Contains(s, ":") {
+		return s, defaultPort, nil
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := net.LookupPort("tcp", portStr)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
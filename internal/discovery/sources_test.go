@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		in   string
+		host string
+		port int
+		ok   bool
+	}{
+		{"seeds.zano.org", "seeds.zano.org", 11121, true},
+		{"seeds.zano.org:11131", "seeds.zano.org", 11131, true},
+		{"95.216.50.10", "95.216.50.10", 11121, true},
+		{"95.216.50.10:11131", "95.216.50.10", 11131, true},
+		{"2a01:4f8::1", "2a01:4f8::1", 11121, true},
+		{"[2a01:4f8::1]", "2a01:4f8::1", 11121, true},
+		{"[2a01:4f8::1]:11131", "2a01:4f8::1", 11131, true},
+		{"::ffff:95.216.50.10", "::ffff:95.216.50.10", 11121, true},
+		{"seeds.zano.org:p2p", "", 0, false},
+		{"seeds.zano.org:11121:1", "", 0, false},
+	}
+	for _, tc := range tests {
+		host, port, err := splitHostPort(tc.in, 11121)
+		if (err == nil) != tc.ok || host != tc.host || port != tc.port {
+			t.Errorf("%q split into %q, %d (%v), want %q, %d", tc.in, host, port, err, tc.host, tc.port)
+		}
+	}
+}
+
+// collect runs src once and returns its sightings
+func collect(t *testing.T, src Source) []Sighting {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		got []Sighting
+	)
+	if err := src.Start(context.Background(), func(s Sighting) {
+		mu.Lock()
+		got = append(got, s)
+		mu.Unlock()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	src.Stop()
+	return got
+}
+
+func TestStaticSource(t *testing.T) {
+	got := collect(t, &Static{Endpoints: []string{"95.216.50.10", " [2a01:4f8::1]:11131 ", "2a01:4f8::2", "not-an-ip"}, DefaultPort: 11121})
+	want := []Sighting{
+		{IP: "95.216.50.10", Port: 11121, Source: "seed"},
+		{IP: "2a01:4f8::1", Port: 11131, Source: "seed"},
+		{IP: "2a01:4f8::2", Port: 11121, Source: "seed"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sightings, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].IP != want[i].IP || got[i].Port != want[i].Port || got[i].Source != want[i].Source || got[i].ObservedAt.IsZero() {
+			t.Errorf("sighting %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.txt")
+	if err := os.WriteFile(path, []byte("# seeds\n95.216.50.10:11131\n\n2a01:4f8::1\nbogus\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, &File{Path: path, DefaultPort: 11121})
+	if len(got) != 2 || got[0].IP != "95.216.50.10" || got[0].Port != 11131 || got[1].IP != "2a01:4f8::1" || got[1].Port != 11121 {
+		t.Fatalf("unexpected sightings %+v", got)
+	}
+	// Sightings are as current as the file
+	if !got[0].ObservedAt.Equal(info.ModTime()) {
+		t.Errorf("sighting observed at %s, want the file's modification time %s", got[0].ObservedAt, info.ModTime())
+	}
+
+	if err := (&File{Path: filepath.Join(t.TempDir(), "missing.txt")}).Start(context.Background(), func(Sighting) {}); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestDNSSourceIPLiteral(t *testing.T) {
+	// IP literals resolve to themselves without a lookup
+	got := collect(t, &DNS{Hosts: []string{"2a01:4f8::1", "95.216.50.10:11131"}, DefaultPort: 11121})
+	if len(got) != 2 || got[0].IP != "2a01:4f8::1" || got[0].Port != 11121 || got[1].IP != "95.216.50.10" || got[1].Port != 11131 {
+		t.Fatalf("unexpected sightings %+v", got)
+	}
+}
@@ -0,0 +1,394 @@
+package epee
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Unmarshal parses a portable storage blob into v, which must be a pointer
+// to a struct or to a map[string]interface{}. Struct fields are matched by
+// their `epee:"name"` tag; entries without a matching field are ignored.
+func Unmarshal(data []byte, v interface{}) error {
+	root, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("epee: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+	return assign(rv.Elem(), root, "")
+}
+
+// Decode parses a portable storage blob into its generic form. Objects
+// become map[string]interface{}, arrays []interface{}, strings string and
+// numbers keep the Go type matching their wire type.
+func Decode(data []byte) (map[string]interface{}, error) {
+	if len(data) < headerSize {
+		return nil, ErrTruncated
+	}
+	if binary.LittleEndian.Uint32(data[0:4]) != SignatureA ||
+		binary.LittleEndian.Uint32(data[4:8]) != SignatureB {
+		return nil, ErrBadSignature
+	}
+	if data[8] != FormatVersion {
+		return nil, fmt.Errorf("epee: unsupported format version %d", data[8])
+	}
+
+	d := &decoder{buf: data[headerSize:]}
+	root, err := d.section(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("epee: %d trailing bytes", len(d.buf))
+	}
+	return root, nil
+}
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if uint64(len(d.buf)) < n {
+		return nil, ErrTruncated
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n, err := readVarint(d.buf)
+	if err != nil {
+		return 0, err
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *decoder) section(depth int) (map[string]interface{}, error) {
+	if depth > MaxDepth {
+		return nil, ErrTooDeep
+	}
+	count, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	// Every entry needs at least a name length, a type and one value byte
+	if count > uint64(len(d.buf))/3 {
+		return nil, ErrTruncated
+	}
+
+	section := make(map[string]interface{}, count)
+	for i := uint64(0); i < count; i++ {
+		nameLen, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		name, err := d.take(uint64(nameLen[0]))
+		if err != nil {
+			return nil, err
+		}
+		typ, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+
+		var val interface{}
+		if typ[0]&FlagArray != 0 {
+			val, err = d.array(typ[0]&^FlagArray, depth)
+		} else {
+			val, err = d.value(typ[0], depth)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("epee: entry %q: %w", name, err)
+		}
+		section[string(name)] = val
+	}
+	return section, nil
+}
+
+func (d *decoder) array(elem byte, depth int) ([]interface{}, error) {
+	count, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(d.buf)) {
+		return nil, ErrTruncated
+	}
+
+	arr := make([]interface{}, 0, count)
+	for i := uint64(0); i < count; i++ {
+		v, err := d.value(elem, depth)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *decoder) value(typ byte, depth int) (interface{}, error) {
+	fixed := func(n uint64) ([]byte, error) { return d.take(n) }
+
+	switch typ {
+	case TypeInt64:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case TypeInt32:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(binary.LittleEndian.Uint32(b)), nil
+	case TypeInt16:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(binary.LittleEndian.Uint16(b)), nil
+	case TypeInt8:
+		b, err := fixed(1)
+		if err != nil {
+			return nil, err
+		}
+		return int8(b[0]), nil
+	case TypeUint64:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint64(b), nil
+	case TypeUint32:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint32(b), nil
+	case TypeUint16:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint16(b), nil
+	case TypeUint8:
+		b, err := fixed(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case TypeDouble:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case TypeBool:
+		b, err := fixed(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case TypeString:
+		n, err := d.varint()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case TypeObject:
+		return d.section(depth + 1)
+	case TypeArray:
+		// Nested arrays carry their own element type per element
+		if depth+1 > MaxDepth {
+			return nil, ErrTooDeep
+		}
+		t, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return d.array(t[0]&^FlagArray, depth+1)
+	}
+	return nil, fmt.Errorf("epee: unknown entry type %d", typ)
+}
+
+// assign stores a generic value into dst, converting between numeric widths
+// where the value fits
+func assign(dst reflect.Value, src interface{}, path string) error {
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src, path)
+
+	case reflect.Struct:
+		obj, ok := src.(map[string]interface{})
+		if !ok {
+			return mismatch(path, "object", src)
+		}
+		fields := structFields(dst.Type())
+		for _, f := range fields {
+			v, ok := obj[f.name]
+			if !ok {
+				continue
+			}
+			if err := assign(dst.Field(f.index), v, path+"."+f.name); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		obj, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch(path, "object", src)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(obj)))
+		}
+		for k, v := range obj {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, v, path+"."+k); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		return nil
+
+	case reflect.Array:
+		// Fixed size byte arrays are PODs serialized as blobs (hashes, uuids)
+		s, ok := src.(string)
+		if !ok || dst.Type().Elem().Kind() != reflect.Uint8 {
+			return mismatch(path, "blob", src)
+		}
+		if len(s) != dst.Len() {
+			return fmt.Errorf("epee: %s: blob is %d bytes, want %d", path, len(s), dst.Len())
+		}
+		reflect.Copy(dst, reflect.ValueOf([]byte(s)))
+		return nil
+
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := src.(string)
+			if !ok {
+				return mismatch(path, "string", src)
+			}
+			dst.SetBytes([]byte(s))
+			return nil
+		}
+		arr, ok := src.([]interface{})
+		if !ok {
+			return mismatch(path, "array", src)
+		}
+		out := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, v := range arr {
+			if err := assign(out.Index(i), v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+		return nil
+
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return mismatch(path, "string", src)
+		}
+		dst.SetString(s)
+		return nil
+
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch(path, "bool", src)
+		}
+		dst.SetBool(b)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := src.(float64)
+		if !ok {
+			return mismatch(path, "double", src)
+		}
+		dst.SetFloat(f)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, neg, ok := toInteger(src)
+		if !ok {
+			return mismatch(path, "integer", src)
+		}
+		i := int64(n)
+		if neg {
+			i = -int64(n)
+		}
+		if (!neg && n > math.MaxInt64) || dst.OverflowInt(i) {
+			return fmt.Errorf("epee: %s: value overflows %s", path, dst.Type())
+		}
+		dst.SetInt(i)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, neg, ok := toInteger(src)
+		if !ok {
+			return mismatch(path, "integer", src)
+		}
+		if neg || dst.OverflowUint(n) {
+			return fmt.Errorf("epee: %s: value overflows %s", path, dst.Type())
+		}
+		dst.SetUint(n)
+		return nil
+	}
+
+	return fmt.Errorf("epee: %s: unsupported field type %s", path, dst.Type())
+}
+
+// toInteger returns the magnitude and sign of any decoded integer value
+func toInteger(v interface{}) (uint64, bool, bool) {
+	var i int64
+	switch n := v.(type) {
+	case uint64:
+		return n, false, true
+	case uint32:
+		return uint64(n), false, true
+	case uint16:
+		return uint64(n), false, true
+	case uint8:
+		return uint64(n), false, true
+	case int64:
+		i = n
+	case int32:
+		i = int64(n)
+	case int16:
+		i = int64(n)
+	case int8:
+		i = int64(n)
+	default:
+		return 0, false, false
+	}
+	if i < 0 {
+		return uint64(-i), true, true
+	}
+	return uint64(i), false, true
+}
+
+func mismatch(path, want string, got interface{}) error {
+	return fmt.Errorf("epee: %s: want %s, got %T", path, want, got)
+}
@@ -0,0 +1,280 @@
+package epee
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Marshal serializes v, a struct or map[string]interface{}, as a portable
+// storage blob. Struct fields are written in declaration order under their
+// `epee:"name"` tag; untagged fields are skipped. The "omitempty" option
+// drops zero values. Empty slices are always omitted, matching epee's
+// container serializer.
+func Marshal(v interface{}) ([]byte, error) {
+	buf := make([]byte, 0, 256)
+	buf = binary.LittleEndian.AppendUint32(buf, SignatureA)
+	buf = binary.LittleEndian.AppendUint32(buf, SignatureB)
+	buf = append(buf, FormatVersion)
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	return encodeSection(buf, rv, 0)
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []field
+
+func structFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("epee")
+		if tag == "" || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{name: parts[0], index: i}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+type entry struct {
+	name string
+	val  reflect.Value
+}
+
+func encodeSection(buf []byte, v reflect.Value, depth int) ([]byte, error) {
+	if depth > MaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	var entries []entry
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range structFields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			entries = append(entries, entry{f.name, fv})
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("epee: map key must be string, got %s", v.Type().Key())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			entries = append(entries, entry{k, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))})
+		}
+	default:
+		return nil, fmt.Errorf("epee: cannot serialize %s as a section", v.Type())
+	}
+
+	// Drop nil interfaces and empty containers before writing the count
+	kept := entries[:0]
+	for _, e := range entries {
+		ev := indirect(e.val)
+		if !ev.IsValid() {
+			continue
+		}
+		if ev.Kind() == reflect.Slice && ev.Type().Elem().Kind() != reflect.Uint8 && ev.Len() == 0 {
+			continue
+		}
+		kept = append(kept, entry{e.name, ev})
+	}
+
+	buf, err := putVarint(buf, uint64(len(kept)))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range kept {
+		if len(e.name) > MaxNameLength {
+			return nil, fmt.Errorf("epee: entry name %q too long", e.name)
+		}
+		buf = append(buf, byte(len(e.name)))
+		buf = append(buf, e.name...)
+
+		typ, err := wireType(e.val)
+		if err != nil {
+			return nil, fmt.Errorf("epee: entry %q: %w", e.name, err)
+		}
+		buf = append(buf, typ)
+		if typ&FlagArray != 0 {
+			buf, err = encodeArray(buf, e.val, typ&^FlagArray, depth)
+		} else {
+			buf, err = encodeValue(buf, e.val, typ, depth)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("epee: entry %q: %w", e.name, err)
+		}
+	}
+	return buf, nil
+}
+
+// indirect unwraps pointers and interfaces, returning an invalid value for nil
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// wireType maps a Go value to its portable storage type tag
+func wireType(v reflect.Value) (byte, error) {
+	switch v.Kind() {
+	case reflect.Int64, reflect.Int:
+		return TypeInt64, nil
+	case reflect.Int32:
+		return TypeInt32, nil
+	case reflect.Int16:
+		return TypeInt16, nil
+	case reflect.Int8:
+		return TypeInt8, nil
+	case reflect.Uint64, reflect.Uint:
+		return TypeUint64, nil
+	case reflect.Uint32:
+		return TypeUint32, nil
+	case reflect.Uint16:
+		return TypeUint16, nil
+	case reflect.Uint8:
+		return TypeUint8, nil
+	case reflect.Float32, reflect.Float64:
+		return TypeDouble, nil
+	case reflect.Bool:
+		return TypeBool, nil
+	case reflect.String:
+		return TypeString, nil
+	case reflect.Struct, reflect.Map:
+		return TypeObject, nil
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return TypeString, nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return TypeString, nil
+		}
+		if v.Len() == 0 {
+			return 0, fmt.Errorf("cannot infer element type of empty %s", v.Type())
+		}
+		elem, err := wireType(indirect(v.Index(0)))
+		if err != nil {
+			return 0, err
+		}
+		if elem&FlagArray != 0 {
+			return FlagArray | TypeArray, nil
+		}
+		return FlagArray | elem, nil
+	}
+	return 0, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func encodeArray(buf []byte, v reflect.Value, elem byte, depth int) ([]byte, error) {
+	buf, err := putVarint(buf, uint64(v.Len()))
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		ev := indirect(v.Index(i))
+		if !ev.IsValid() {
+			return nil, fmt.Errorf("nil element %d in array", i)
+		}
+		typ, err := wireType(ev)
+		if err != nil {
+			return nil, err
+		}
+		if elem == TypeArray {
+			if typ&FlagArray == 0 {
+				return nil, fmt.Errorf("mixed array element %d", i)
+			}
+			buf = append(buf, typ)
+			buf, err = encodeArray(buf, ev, typ&^FlagArray, depth+1)
+		} else {
+			if typ != elem {
+				return nil, fmt.Errorf("mixed array element %d: %s != %s", i, typeName(typ), typeName(elem))
+			}
+			buf, err = encodeValue(buf, ev, typ, depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func encodeValue(buf []byte, v reflect.Value, typ byte, depth int) ([]byte, error) {
+	switch typ {
+	case TypeInt64:
+		return binary.LittleEndian.AppendUint64(buf, uint64(v.Int())), nil
+	case TypeInt32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(v.Int())), nil
+	case TypeInt16:
+		return binary.LittleEndian.AppendUint16(buf, uint16(v.Int())), nil
+	case TypeInt8:
+		return append(buf, byte(v.Int())), nil
+	case TypeUint64:
+		return binary.LittleEndian.AppendUint64(buf, v.Uint()), nil
+	case TypeUint32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(v.Uint())), nil
+	case TypeUint16:
+		return binary.LittleEndian.AppendUint16(buf, uint16(v.Uint())), nil
+	case TypeUint8:
+		return append(buf, byte(v.Uint())), nil
+	case TypeDouble:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case TypeBool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case TypeString:
+		var b []byte
+		switch v.Kind() {
+		case reflect.String:
+			b = []byte(v.String())
+		case reflect.Slice:
+			b = v.Bytes()
+		case reflect.Array:
+			b = make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+		}
+		buf, err := putVarint(buf, uint64(len(b)))
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, b...), nil
+	case TypeObject:
+		return encodeSection(buf, v, depth+1)
+	}
+	return nil, fmt.Errorf("unsupported wire type %s", typeName(typ))
+}
@@ -0,0 +1,328 @@
+package epee_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zano-peer-finder/internal/epee"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+)
+
+// Fixtures laid out byte for byte as zanod serializes these bodies: fields
+// in KV_SERIALIZE order, PODs such as network_id, top_id and the peer list
+// as blobs
+const (
+	// COMMAND_HANDSHAKE request, as peer-finder or a zanod node sends it
+	handshakeRequest = "01110101010102010108096e6f64655f646174610c100a6e6574776f726b5f69" +
+		"640a401110011101010110011100110110115407706565725f696405617f9e0d" +
+		"1c2b3a8f0a6c6f63616c5f74696d6501bbd8f16800000000076d795f706f7274" +
+		"06712b00000c7061796c6f61645f646174610c180e63757272656e745f686569" +
+		"67687405aa2526000000000006746f705f69640a805e2f0d3e1a9c4b7f8a61d2" +
+		"c3b4a59687f0e1d2c3b4a5968778695a4b3c2d1e0f166c6173745f636865636b" +
+		"706f696e745f68656967687405009f24000000000009636f72655f74696d6505" +
+		"bbd8f168000000000e636c69656e745f76657273696f6e0a48322e312e352e34" +
+		"30305b356532663064335d186e6f6e5f7072756e696e675f6d6f64655f656e61" +
+		"626c65640b01"
+
+	// COMMAND_HANDSHAKE response with a packed two entry peer list
+	handshakeResponse = "0111010101010201010c096e6f64655f646174610c100a6e6574776f726b5f69" +
+		"640a401110011101010110011100110110115407706565725f6964058d7c6b5a" +
+		"4f3e2d1c0a6c6f63616c5f74696d6501bbd8f16800000000076d795f706f7274" +
+		"06712b00000c7061796c6f61645f646174610c180e63757272656e745f686569" +
+		"67687405ac2526000000000006746f705f69640a805e2f0d3e1a9c4b7f8a61d2" +
+		"c3b4a59687f0e1d2c3b4a5968778695a4b3c2d1e0f166c6173745f636865636b" +
+		"706f696e745f68656967687405009f24000000000009636f72655f74696d6505" +
+		"bbd8f168000000000e636c69656e745f76657273696f6e0a48322e312e352e34" +
+		"30305b356532663064335d186e6f6e5f7072756e696e675f6d6f64655f656e61" +
+		"626c65640b010e6c6f63616c5f706565726c6973740ac05fd8320a712b00008d" +
+		"7c6b5a4f3e2d1c40d8f16800000000904c1203712b000071605f4e3d2c1b0ae8" +
+		"d5f16800000000"
+
+	// COMMAND_TIMED_SYNC response
+	timedSyncResponse = "0111010101010201010c0a6c6f63616c5f74696d6501f7d8f168000000000c70" +
+		"61796c6f61645f646174610c180e63757272656e745f68656967687405ad2526" +
+		"000000000006746f705f69640a805e2f0d3e1a9c4b7f8a61d2c3b4a59687f0e1" +
+		"d2c3b4a5968778695a4b3c2d1e0f166c6173745f636865636b706f696e745f68" +
+		"656967687405009f24000000000009636f72655f74696d6505f7d8f168000000" +
+		"000e636c69656e745f76657273696f6e0a48322e312e352e3430305b35653266" +
+		"3064335d186e6f6e5f7072756e696e675f6d6f64655f656e61626c65640b010e" +
+		"6c6f63616c5f706565726c6973740ac05fd8320a712b00008d7c6b5a4f3e2d1c" +
+		"40d8f16800000000904c1203712b000071605f4e3d2c1b0ae8d5f16800000000"
+
+	// COMMAND_PING request, an empty section
+	pingRequest = "01110101010102010100"
+
+	// COMMAND_PING response
+	pingResponse = "01110101010102010108067374617475730a084f4b07706565725f6964058d7c" +
+		"6b5a4f3e2d1c"
+)
+
+func fixture(t *testing.T, h string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFixtureRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		v    interface{}
+	}{
+		{"handshake request", handshakeRequest, &p2p.HandshakeRequest{}},
+		{"handshake response", handshakeResponse, &p2p.HandshakeResponse{}},
+		{"timed sync response", timedSyncResponse, &p2p.TimedSyncResponse{}},
+		{"ping request", pingRequest, &p2p.PingRequest{}},
+		{"ping response", pingResponse, &p2p.PingResponse{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := fixture(t, tc.hex)
+
+			// The generic form survives encoding. Marshal writes map keys
+			// sorted, not in zanod's order, so it is compared after decoding
+			// again.
+			root, err := epee.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := epee.Marshal(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := epee.Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(root, again) {
+				t.Fatalf("generic round trip changed the value:\n%#v\n%#v", root, again)
+			}
+
+			// The structs declare fields in zanod's order, so they reproduce
+			// the fixture exactly
+			if err := epee.Unmarshal(data, tc.v); err != nil {
+				t.Fatal(err)
+			}
+			encoded, err = epee.Marshal(tc.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != string(data) {
+				t.Fatalf("re-encoded body differs:\n got %x\nwant %x", encoded, data)
+			}
+		})
+	}
+}
+
+func TestUnmarshalHandshake(t *testing.T) {
+	var resp p2p.HandshakeResponse
+	if err := epee.Unmarshal(fixture(t, handshakeResponse), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	nd := resp.NodeData
+	if nd.NetworkID != network.Mainnet.NetworkID {
+		t.Errorf("network id is %x, want mainnet", nd.NetworkID)
+	}
+	if nd.PeerID != 0x1c2d3e4f5a6b7c8d || nd.LocalTime != 1760680123 || nd.MyPort != 11121 {
+		t.Errorf("unexpected node data %+v", nd)
+	}
+
+	pd := resp.PayloadData
+	if pd.CurrentHeight != 2500012 || pd.LastCheckpointHeight != 2400000 || pd.CoreTime != 1760680123 {
+		t.Errorf("unexpected payload data %+v", pd)
+	}
+	if pd.ClientVersion != "2.1.5.400[5e2f0d3]" || !pd.NonPruningMode {
+		t.Errorf("unexpected client version %q or pruning mode", pd.ClientVersion)
+	}
+	if hex.EncodeToString(pd.TopID[:]) != "5e2f0d3e1a9c4b7f8a61d2c3b4a59687f0e1d2c3b4a5968778695a4b3c2d1e0f" {
+		t.Errorf("unexpected top id %x", pd.TopID)
+	}
+
+	peers, err := p2p.DecodePeerlist(resp.LocalPeerlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("got %d peers, want 2", len(peers))
+	}
+	if peers[0].Address() != "95.216.50.10:11121" || peers[0].PeerID != 0x1c2d3e4f5a6b7c8d || peers[0].LastSeen.Unix() != 1760680000 {
+		t.Errorf("unexpected first peer %+v", peers[0])
+	}
+	if peers[1].Address() != "144.76.18.3:11121" {
+		t.Errorf("unexpected second peer %+v", peers[1])
+	}
+}
+
+func TestUnmarshalTimedSyncAndPing(t *testing.T) {
+	var ts p2p.TimedSyncResponse
+	if err := epee.Unmarshal(fixture(t, timedSyncResponse), &ts); err != nil {
+		t.Fatal(err)
+	}
+	if ts.LocalTime != 1760680183 || ts.PayloadData.CurrentHeight != 2500013 {
+		t.Errorf("unexpected timed sync response %+v", ts)
+	}
+
+	var ping p2p.PingResponse
+	if err := epee.Unmarshal(fixture(t, pingResponse), &ping); err != nil {
+		t.Fatal(err)
+	}
+	if ping.Status != p2p.PingOK || ping.PeerID != 0x1c2d3e4f5a6b7c8d {
+		t.Errorf("unexpected ping response %+v", ping)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data := fixture(t, handshakeResponse)
+	for n := 0; n < len(data); n++ {
+		if _, err := epee.Decode(data[:n]); err == nil {
+			t.Fatalf("decoding the first %d of %d bytes succeeded", n, len(data))
+		}
+	}
+	if _, err := epee.Decode(data[:5]); !errors.Is(err, epee.ErrTruncated) {
+		t.Fatalf("short header: got %v, want ErrTruncated", err)
+	}
+}
+
+func TestDecodeBadSignature(t *testing.T) {
+	for _, i := range []int{0, 4} {
+		data := fixture(t, pingResponse)
+		data[i] ^= 0xff
+		if _, err := epee.Decode(data); !errors.Is(err, epee.ErrBadSignature) {
+			t.Errorf("byte %d flipped: got %v, want ErrBadSignature", i, err)
+		}
+	}
+
+	data := fixture(t, pingResponse)
+	data[8] = 2
+	if _, err := epee.Decode(data); err == nil || !strings.Contains(err.Error(), "format version") {
+		t.Errorf("bad format version: got %v", err)
+	}
+}
+
+// header is the portable storage signature and version
+var header = []byte{0x01, 0x11, 0x01, 0x01, 0x01, 0x01, 0x02, 0x01, 0x01}
+
+// nested returns a blob of depth sections each holding the next as "a"
+func nested(depth int) []byte {
+	data := append([]byte(nil), header...)
+	for i := 0; i < depth; i++ {
+		data = append(data, 1<<2, 1, 'a', epee.TypeObject)
+	}
+	return append(data, 0)
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+	if _, err := epee.Decode(nested(epee.MaxDepth)); err != nil {
+		t.Fatalf("depth %d: %v", epee.MaxDepth, err)
+	}
+	if _, err := epee.Decode(nested(epee.MaxDepth + 1)); !errors.Is(err, epee.ErrTooDeep) {
+		t.Fatalf("depth %d: got %v, want ErrTooDeep", epee.MaxDepth+1, err)
+	}
+
+	// Arrays of arrays count towards the depth as well
+	data := append([]byte(nil), header...)
+	data = append(data, 1<<2, 1, 'a', epee.FlagArray|epee.TypeArray)
+	for i := 0; i <= epee.MaxDepth; i++ {
+		data = append(data, 1<<2, epee.FlagArray|epee.TypeArray)
+	}
+	data = append(data, 0)
+	if _, err := epee.Decode(data); !errors.Is(err, epee.ErrTooDeep) {
+		t.Fatalf("nested arrays: got %v, want ErrTooDeep", err)
+	}
+}
+
+func TestMarshalMaxDepth(t *testing.T) {
+	v := map[string]interface{}{}
+	for i := 0; i <= epee.MaxDepth; i++ {
+		v = map[string]interface{}{"a": v}
+	}
+	if _, err := epee.Marshal(v); !errors.Is(err, epee.ErrTooDeep) {
+		t.Fatalf("got %v, want ErrTooDeep", err)
+	}
+}
+
+func TestDecodeOversizedCount(t *testing.T) {
+	// A section claiming 2^30-1 entries with none following must fail
+	// before anything is allocated for them
+	section := append(append([]byte(nil), header...), 0xfe, 0xff, 0xff, 0xff)
+	if _, err := epee.Decode(section); !errors.Is(err, epee.ErrTruncated) {
+		t.Fatalf("section: got %v, want ErrTruncated", err)
+	}
+
+	array := append(append([]byte(nil), header...), 1<<2, 1, 'a', epee.FlagArray|epee.TypeUint64, 0xfe, 0xff, 0xff, 0xff)
+	if _, err := epee.Decode(array); !errors.Is(err, epee.ErrTruncated) {
+		t.Fatalf("array: got %v, want ErrTruncated", err)
+	}
+
+	str := append(append([]byte(nil), header...), 1<<2, 1, 'a', epee.TypeString, 0xfe, 0xff, 0xff, 0xff)
+	if _, err := epee.Decode(str); !errors.Is(err, epee.ErrTruncated) {
+		t.Fatalf("string: got %v, want ErrTruncated", err)
+	}
+}
+
+func TestUnmarshalIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		src  map[string]interface{}
+		dst  interface{}
+	}{
+		{"uint64 into uint8", map[string]interface{}{"v": uint64(256)}, &struct {
+			V uint8 `epee:"v"`
+		}{}},
+		{"uint64 into uint32", map[string]interface{}{"v": uint64(math.MaxUint32 + 1)}, &struct {
+			V uint32 `epee:"v"`
+		}{}},
+		{"negative into unsigned", map[string]interface{}{"v": int64(-1)}, &struct {
+			V uint64 `epee:"v"`
+		}{}},
+		{"uint64 into int64", map[string]interface{}{"v": uint64(math.MaxInt64 + 1)}, &struct {
+			V int64 `epee:"v"`
+		}{}},
+		{"int64 into int32", map[string]interface{}{"v": int64(math.MinInt32 - 1)}, &struct {
+			V int32 `epee:"v"`
+		}{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := epee.Marshal(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := epee.Unmarshal(data, tc.dst); err == nil || !strings.Contains(err.Error(), "overflows") {
+				t.Fatalf("got %v, want an overflow error", err)
+			}
+		})
+	}
+
+	// Narrower wire types widen without complaint
+	var ok struct {
+		V int64 `epee:"v"`
+	}
+	data, _ := epee.Marshal(map[string]interface{}{"v": uint32(math.MaxUint32)})
+	if err := epee.Unmarshal(data, &ok); err != nil || ok.V != math.MaxUint32 {
+		t.Fatalf("got %d, %v", ok.V, err)
+	}
+}
+
+func TestUnmarshalTypeMismatch(t *testing.T) {
+	var dst struct {
+		ID [16]byte `epee:"id"`
+	}
+	data, _ := epee.Marshal(map[string]interface{}{"id": "too short"})
+	if err := epee.Unmarshal(data, &dst); err == nil {
+		t.Fatal("short blob accepted for a [16]byte")
+	}
+	data, _ = epee.Marshal(map[string]interface{}{"id": uint64(1)})
+	if err := epee.Unmarshal(data, &dst); err == nil {
+		t.Fatal("integer accepted for a blob")
+	}
+}
@@ -0,0 +1,105 @@
+package epee
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Portable storage signature and format version from epee's portable_storage_base.h
+const (
+	SignatureA    uint32 = 0x01011101
+	SignatureB    uint32 = 0x01020101
+	FormatVersion byte   = 1
+
+	headerSize = 9
+)
+
+// Entry type tags
+const (
+	TypeInt64  byte = 1
+	TypeInt32  byte = 2
+	TypeInt16  byte = 3
+	TypeInt8   byte = 4
+	TypeUint64 byte = 5
+	TypeUint32 byte = 6
+	TypeUint16 byte = 7
+	TypeUint8  byte = 8
+	TypeDouble byte = 9
+	TypeString byte = 10
+	TypeBool   byte = 11
+	TypeObject byte = 12
+	TypeArray  byte = 13
+
+	FlagArray byte = 0x80
+)
+
+// Decoder limits that keep a hostile peer from exhausting memory
+const (
+	MaxDepth      = 32
+	MaxNameLength = 255
+)
+
+var (
+	ErrBadSignature = errors.New("epee: bad portable storage signature")
+	ErrTruncated    = errors.New("epee: truncated data")
+	ErrTooDeep      = errors.New("epee: nesting too deep")
+)
+
+// putVarint appends v using epee's 2-bit size-tagged varint encoding
+func putVarint(buf []byte, v uint64) ([]byte, error) {
+	switch {
+	case v <= 63:
+		return append(buf, byte(v<<2)), nil
+	case v <= 16383:
+		return binary.LittleEndian.AppendUint16(buf, uint16(v<<2|1)), nil
+	case v <= 1073741823:
+		return binary.LittleEndian.AppendUint32(buf, uint32(v<<2|2)), nil
+	case v <= 4611686018427387903:
+		return binary.LittleEndian.AppendUint64(buf, v<<2|3), nil
+	}
+	return nil, fmt.Errorf("epee: varint %d out of range", v)
+}
+
+// readVarint decodes a varint and returns it with the number of bytes consumed
+func readVarint(buf []byte) (uint64, int, error) {
+	if len(buf) < 1 {
+		return 0, 0, ErrTruncated
+	}
+	switch buf[0] & 0x03 {
+	case 0:
+		return uint64(buf[0]) >> 2, 1, nil
+	case 1:
+		if len(buf) < 2 {
+			return 0, 0, ErrTruncated
+		}
+		return uint64(binary.LittleEndian.Uint16(buf)) >> 2, 2, nil
+	case 2:
+		if len(buf) < 4 {
+			return 0, 0, ErrTruncated
+		}
+		return uint64(binary.LittleEndian.Uint32(buf)) >> 2, 4, nil
+	default:
+		if len(buf) < 8 {
+			return 0, 0, ErrTruncated
+		}
+		return binary.LittleEndian.Uint64(buf) >> 2, 8, nil
+	}
+}
+
+// typeName is used in error messages
+func typeName(t byte) string {
+	names := map[byte]string{
+		TypeInt64: "int64", TypeInt32: "int32", TypeInt16: "int16", TypeInt8: "int8",
+		TypeUint64: "uint64", TypeUint32: "uint32", TypeUint16: "uint16", TypeUint8: "uint8",
+		TypeDouble: "double", TypeString: "string", TypeBool: "bool",
+		TypeObject: "object", TypeArray: "array",
+	}
+	if t&FlagArray != 0 {
+		return "array of " + typeName(t&^FlagArray)
+	}
+	if n, ok := names[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
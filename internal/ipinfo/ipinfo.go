@@ -1,9 +1,11 @@
 package ipinfo
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 )
@@ -32,10 +34,16 @@ type IPAPIResponse struct {
 }
 
 type Service struct {
-	client      *http.Client
-	rateLimiter *RateLimiter
+	client           *http.Client
+	rateLimiter      *RateLimiter
+	batchRateLimiter *RateLimiter
 }
 
+// MaxBatch is the most IPs ip-api accepts in one batch request
+const MaxBatch = 100
+
+const ipAPIFields = "status,message,continent,continentCode,country,countryCode,region,regionName,city,district,zip,lat,lon,timezone,offset,currency,isp,org,as,asname,reverse,mobile,proxy,hosting,query"
+
 type RateLimiter struct {
 	mu          sync.Mutex
 	requests    int
@@ -75,16 +83,20 @@ func NewService() *Service {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		rateLimiter: NewRateLimiter(45, time.Minute), // 45 requests per minute
+		rateLimiter:      NewRateLimiter(45, time.Minute), // 45 requests per minute
+		batchRateLimiter: NewRateLimiter(15, time.Minute), // 15 batch requests per minute
 	}
 }
 
+// GetIPInfo looks up one IP. An empty ip looks up the address the request
+// comes from, this host's public address.
 func (s *Service) GetIPInfo(ip string) (*IPAPIResponse, error) {
 	if !s.rateLimiter.Allow() {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
-	resp, err := s.client.Get(fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,continent,continentCode,country,countryCode,region,regionName,city,district,zip,lat,lon,timezone,offset,currency,isp,org,as,asname,reverse,mobile,proxy,hosting,query", ip))
+	// ip-api accepts IPv4 and IPv6 addresses alike
+	resp, err := s.client.Get(fmt.Sprintf("http://ip-api.com/json/%s?fields=%s", url.PathEscape(ip), ipAPIFields))
 	if err != nil {
 		return nil, err
 	}
@@ -101,3 +113,41 @@ func (s *Service) GetIPInfo(ip string) (*IPAPIResponse, error) {
 
 	return &ipInfo, nil
 }
+
+// GetIPInfoBatch looks up to MaxBatch IPs in one request. The results are
+// in the order of ips; each carries its own status.
+func (s *Service) GetIPInfoBatch(ips []string) ([]*IPAPIResponse, error) {
+	if len(ips) > MaxBatch {
+		return nil, fmt.Errorf("batch of %d IPs exceeds the limit of %d", len(ips), MaxBatch)
+	}
+	if !s.batchRateLimiter.Allow() {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	body, err := json.Marshal(ips)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post("http://ip-api.com/batch?fields="+ipAPIFields, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("batch lookup failed: %s", resp.Status)
+	}
+
+	var infos []*IPAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	if len(infos) != len(ips) {
+		return nil, fmt.Errorf("batch lookup returned %d results for %d IPs", len(infos), len(ips))
+	}
+
+	return infos, nil
+}
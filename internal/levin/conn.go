@@ -0,0 +1,245 @@
+package levin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed     = errors.New("levin: connection closed")
+	ErrUnexpected = errors.New("levin: unexpected response")
+)
+
+// ReturnCodeError is returned by Invoke when the remote answers with a
+// negative return code
+type ReturnCodeError struct {
+	Command uint32
+	Code    int32
+}
+
+func (e *ReturnCodeError) Error() string {
+	return fmt.Sprintf("levin: command %d failed with return code %d", e.Command, e.Code)
+}
+
+// Handler serves requests and notifications initiated by the remote side.
+// The returned body and code are only sent back when the request has
+// HaveToReturn set.
+type Handler func(p *Packet) ([]byte, int32)
+
+// Conn wraps a net.Conn and multiplexes outgoing invokes with inbound
+// requests. Levin carries no request ids, so responses are matched to
+// invokes by command in FIFO order, exactly as epee does.
+type Conn struct {
+	conn    net.Conn
+	maxBody atomic.Uint64
+	handler Handler
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint32][]chan *Packet
+	err     error
+
+	inbound chan *Packet
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// Dial opens a TCP connection to addr and wraps it in a Conn limited to
+// InitialMaxBodySize. Raise the limit with SetMaxBodySize once the
+// handshake has completed.
+func Dial(ctx context.Context, addr string, timeout time.Duration, handler Handler) (*Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c, InitialMaxBodySize, handler), nil
+}
+
+// NewConn starts reading from c, rejecting packets larger than maxBody (0
+// means DefaultMaxBodySize). A nil handler rejects every inbound request
+// with ReturnErrHandlerNotDefined and drops notifications.
+func NewConn(c net.Conn, maxBody uint64, handler Handler) *Conn {
+	lc := &Conn{
+		conn:    c,
+		handler: handler,
+		pending: make(map[uint32][]chan *Packet),
+		inbound: make(chan *Packet, 16),
+		closed:  make(chan struct{}),
+	}
+	lc.SetMaxBodySize(maxBody)
+	go lc.readLoop()
+	go lc.dispatchLoop()
+	return lc
+}
+
+// SetMaxBodySize changes the largest packet accepted in either direction,
+// typically raising it once the remote has completed a handshake. 0 means
+// DefaultMaxBodySize.
+func (c *Conn) SetMaxBodySize(n uint64) {
+	if n == 0 {
+		n = DefaultMaxBodySize
+	}
+	c.maxBody.Store(n)
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Done is closed once the connection has shut down
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns the reason the connection was closed, if any
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close shuts down the connection and fails all outstanding invokes
+func (c *Conn) Close() error {
+	c.closeWithError(ErrClosed)
+	return nil
+}
+
+func (c *Conn) closeWithError(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.pending = make(map[uint32][]chan *Packet)
+		c.mu.Unlock()
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// Invoke sends a request and waits for the matching response. If ctx expires
+// before the response arrives the connection is closed, since any late
+// response would otherwise be attributed to the next invoke of that command.
+func (c *Conn) Invoke(ctx context.Context, command uint32, body []byte) (*Packet, error) {
+	ch := make(chan *Packet, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.pending[command] = append(c.pending[command], ch)
+	c.mu.Unlock()
+
+	err := c.write(Header{
+		HaveToReturn: true,
+		Command:      command,
+		Flags:        FlagRequest,
+	}, body)
+	if err != nil {
+		c.closeWithError(err)
+		return nil, err
+	}
+
+	select {
+	case p := <-ch:
+		if p.Header.ReturnCode < 0 {
+			return p, &ReturnCodeError{Command: command, Code: p.Header.ReturnCode}
+		}
+		return p, nil
+	case <-c.closed:
+		return nil, c.Err()
+	case <-ctx.Done():
+		c.closeWithError(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a one-way message that expects no response
+func (c *Conn) Notify(command uint32, body []byte) error {
+	return c.write(Header{
+		Command: command,
+		Flags:   FlagRequest,
+	}, body)
+}
+
+func (c *Conn) write(h Header, body []byte) error {
+	if max := c.maxBody.Load(); uint64(len(body)) > max {
+		return fmt.Errorf("%w: %d > %d", ErrBodyTooLarge, len(body), max)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.closed:
+		return c.Err()
+	default:
+	}
+	return WritePacket(c.conn, h, body)
+}
+
+func (c *Conn) readLoop() {
+	for {
+		p, err := ReadPacket(c.conn, c.maxBody.Load())
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		if p.Header.IsResponse() {
+			c.mu.Lock()
+			queue := c.pending[p.Header.Command]
+			if len(queue) == 0 {
+				c.mu.Unlock()
+				c.closeWithError(fmt.Errorf("%w: command %d", ErrUnexpected, p.Header.Command))
+				return
+			}
+			ch := queue[0]
+			c.pending[p.Header.Command] = queue[1:]
+			c.mu.Unlock()
+			ch <- p
+			continue
+		}
+
+		select {
+		case c.inbound <- p:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// dispatchLoop serves inbound requests one at a time so their responses go
+// out in the order the requests arrived, without blocking the read loop
+func (c *Conn) dispatchLoop() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case p := <-c.inbound:
+			body, code := []byte(nil), ReturnErrHandlerNotDefined
+			if c.handler != nil {
+				body, code = c.handler(p)
+			}
+			if !p.Header.HaveToReturn {
+				continue
+			}
+			err := c.write(Header{
+				Command:    p.Header.Command,
+				ReturnCode: code,
+				Flags:      FlagResponse,
+			}, body)
+			if err != nil {
+				c.closeWithError(err)
+				return
+			}
+		}
+	}
+}
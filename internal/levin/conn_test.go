@@ -0,0 +1,161 @@
+package levin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipe returns a Conn and the raw remote end it talks to
+func pipe(t *testing.T, handler Handler) (*Conn, net.Conn) {
+	t.Helper()
+	local, remote := net.Pipe()
+	c := NewConn(local, 0, handler)
+	t.Cleanup(func() {
+		c.Close()
+		remote.Close()
+	})
+	return c, remote
+}
+
+type invokeResult struct {
+	p   *Packet
+	err error
+}
+
+func invokeAsync(c *Conn, command uint32, body []byte) <-chan invokeResult {
+	done := make(chan invokeResult, 1)
+	go func() {
+		p, err := c.Invoke(context.Background(), command, body)
+		done <- invokeResult{p, err}
+	}()
+	return done
+}
+
+func TestConnFIFOResponses(t *testing.T) {
+	c, remote := pipe(t, nil)
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Two invokes of the same command are in flight before either is
+	// answered; the remote reads each before the next is sent so the
+	// order is known
+	first := invokeAsync(c, 1002, []byte("first"))
+	req1, err := ReadPacket(remote, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := invokeAsync(c, 1002, []byte("second"))
+	req2, err := ReadPacket(remote, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req1.Body) != "first" || string(req2.Body) != "second" {
+		t.Fatalf("requests arrived as %q, %q", req1.Body, req2.Body)
+	}
+
+	// Levin has no request ids: responses go to invokes in the order
+	// they were sent
+	for _, body := range []string{"reply to first", "reply to second"} {
+		if err := WritePacket(remote, Header{Command: 1002, Flags: FlagResponse}, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		done <-chan invokeResult
+		want string
+	}{{first, "reply to first"}, {second, "reply to second"}} {
+		select {
+		case res := <-tc.done:
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			if string(res.p.Body) != tc.want {
+				t.Fatalf("got %q, want %q", res.p.Body, tc.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("invoke did not complete")
+		}
+	}
+}
+
+func TestConnReturnCode(t *testing.T) {
+	c, remote := pipe(t, nil)
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+
+	done := invokeAsync(c, 1003, nil)
+	if _, err := ReadPacket(remote, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePacket(remote, Header{Command: 1003, Flags: FlagResponse, ReturnCode: ReturnErrFormat}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-done
+	var rce *ReturnCodeError
+	if !errors.As(res.err, &rce) || rce.Code != ReturnErrFormat {
+		t.Fatalf("got %v, want return code %d", res.err, ReturnErrFormat)
+	}
+}
+
+func TestConnUnexpectedResponse(t *testing.T) {
+	c, remote := pipe(t, nil)
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := WritePacket(remote, Header{Command: 1002, Flags: FlagResponse}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection stayed open after an unsolicited response")
+	}
+	if !errors.Is(c.Err(), ErrUnexpected) {
+		t.Fatalf("got %v, want ErrUnexpected", c.Err())
+	}
+}
+
+func TestConnServesRequests(t *testing.T) {
+	_, remote := pipe(t, func(p *Packet) ([]byte, int32) {
+		return append([]byte("echo "), p.Body...), ReturnOK
+	})
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := WritePacket(remote, Header{Command: 1003, Flags: FlagRequest, HaveToReturn: true}, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadPacket(remote, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Header.IsResponse() || p.Header.Command != 1003 || !bytes.Equal(p.Body, []byte("echo ping")) {
+		t.Fatalf("unexpected response %+v %q", p.Header, p.Body)
+	}
+}
+
+func TestConnBodyLimit(t *testing.T) {
+	c, remote := pipe(t, nil)
+	c.SetMaxBodySize(16)
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := c.Invoke(context.Background(), 1003, make([]byte, 17)); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("oversized request: got %v, want ErrBodyTooLarge", err)
+	}
+
+	// An oversized inbound packet closes the connection
+	c, remote = pipe(t, nil)
+	c.SetMaxBodySize(16)
+	remote.SetDeadline(time.Now().Add(5 * time.Second))
+	go WritePacket(remote, Header{Command: 1003, Flags: FlagRequest}, make([]byte, 17))
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection stayed open after an oversized packet")
+	}
+	if !errors.Is(c.Err(), ErrBodyTooLarge) {
+		t.Fatalf("got %v, want ErrBodyTooLarge", c.Err())
+	}
+}
@@ -0,0 +1,149 @@
+package levin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Levin framing constants as defined by epee's levin_base.h
+const (
+	Signature uint64 = 0x0101010101012101
+
+	HeaderSize = 33
+
+	FlagRequest  uint32 = 0x00000001
+	FlagResponse uint32 = 0x00000002
+
+	ProtocolVersion1 uint32 = 1
+
+	// DefaultMaxBodySize mirrors LEVIN_DEFAULT_MAX_PACKET_SIZE in zanod
+	DefaultMaxBodySize uint64 = 100000000
+
+	// InitialMaxBodySize mirrors LEVIN_INITIAL_MAX_PACKET_SIZE, the limit
+	// zanod applies until a connection's handshake completes
+	InitialMaxBodySize uint64 = 256 * 1024
+)
+
+// Return codes used by epee when a request could not be served
+const (
+	ReturnOK                     int32 = 0
+	ReturnErrConnection          int32 = -1
+	ReturnErrConnectionNotFound  int32 = -2
+	ReturnErrConnectionDestroyed int32 = -3
+	ReturnErrConnectionTimedOut  int32 = -4
+	ReturnErrNoDuplexProtocol    int32 = -5
+	ReturnErrHandlerNotDefined   int32 = -6
+	ReturnErrFormat              int32 = -7
+)
+
+var (
+	ErrBadSignature = errors.New("levin: bad bucket signature")
+	ErrBodyTooLarge = errors.New("levin: body exceeds size limit")
+)
+
+// Header is the fixed 33 byte bucket header that precedes every Levin message
+type Header struct {
+	Signature       uint64
+	BodySize        uint64
+	HaveToReturn    bool
+	Command         uint32
+	ReturnCode      int32
+	Flags           uint32
+	ProtocolVersion uint32
+}
+
+// IsRequest reports whether the bucket carries a request or notification
+func (h *Header) IsRequest() bool {
+	return h.Flags&FlagRequest != 0
+}
+
+// IsResponse reports whether the bucket carries a response to an earlier request
+func (h *Header) IsResponse() bool {
+	return h.Flags&FlagResponse != 0
+}
+
+// MarshalBinary encodes the header in little-endian wire order
+func (h *Header) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, HeaderSize)
+	binary.LittleEndian.PutUint64(buf[0:8], h.Signature)
+	binary.LittleEndian.PutUint64(buf[8:16], h.BodySize)
+	if h.HaveToReturn {
+		buf[16] = 1
+	}
+	binary.LittleEndian.PutUint32(buf[17:21], h.Command)
+	binary.LittleEndian.PutUint32(buf[21:25], uint32(h.ReturnCode))
+	binary.LittleEndian.PutUint32(buf[25:29], h.Flags)
+	binary.LittleEndian.PutUint32(buf[29:33], h.ProtocolVersion)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a header and validates its signature
+func (h *Header) UnmarshalBinary(buf []byte) error {
+	if len(buf) < HeaderSize {
+		return fmt.Errorf("levin: short header: %d bytes", len(buf))
+	}
+	h.Signature = binary.LittleEndian.Uint64(buf[0:8])
+	if h.Signature != Signature {
+		return ErrBadSignature
+	}
+	h.BodySize = binary.LittleEndian.Uint64(buf[8:16])
+	h.HaveToReturn = buf[16] != 0
+	h.Command = binary.LittleEndian.Uint32(buf[17:21])
+	h.ReturnCode = int32(binary.LittleEndian.Uint32(buf[21:25]))
+	h.Flags = binary.LittleEndian.Uint32(buf[25:29])
+	h.ProtocolVersion = binary.LittleEndian.Uint32(buf[29:33])
+	return nil
+}
+
+// Packet is a decoded header together with its body
+type Packet struct {
+	Header Header
+	Body   []byte
+}
+
+// ReadPacket reads one bucket from r, rejecting bodies larger than maxBody.
+// A maxBody of 0 means DefaultMaxBodySize; the size comes from the remote,
+// so it is never trusted unchecked.
+func ReadPacket(r io.Reader, maxBody uint64) (*Packet, error) {
+	if maxBody == 0 {
+		maxBody = DefaultMaxBodySize
+	}
+
+	buf := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	var p Packet
+	if err := p.Header.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if p.Header.BodySize > maxBody {
+		return nil, fmt.Errorf("%w: %d > %d", ErrBodyTooLarge, p.Header.BodySize, maxBody)
+	}
+
+	p.Body = make([]byte, p.Header.BodySize)
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// WritePacket writes a header and body as a single buffer so concurrent
+// writers guarded by the caller never interleave partial buckets
+func WritePacket(w io.Writer, h Header, body []byte) error {
+	h.Signature = Signature
+	h.BodySize = uint64(len(body))
+	if h.ProtocolVersion == 0 {
+		h.ProtocolVersion = ProtocolVersion1
+	}
+
+	hdr, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(hdr, body...))
+	return err
+}
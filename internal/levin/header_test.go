@@ -0,0 +1,112 @@
+package levin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := Header{
+		Signature:       Signature,
+		BodySize:        1234,
+		HaveToReturn:    true,
+		Command:         1001,
+		ReturnCode:      ReturnErrFormat,
+		Flags:           FlagResponse,
+		ProtocolVersion: ProtocolVersion1,
+	}
+	buf, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != HeaderSize {
+		t.Fatalf("header is %d bytes, want %d", len(buf), HeaderSize)
+	}
+
+	var got Header
+	if err := got.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got != h {
+		t.Fatalf("round trip gave %+v, want %+v", got, h)
+	}
+}
+
+func TestHeaderWireLayout(t *testing.T) {
+	// A COMMAND_HANDSHAKE request as zanod sends it
+	want := []byte{
+		0x01, 0x21, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, // signature
+		0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // body size
+		0x01,                   // have to return
+		0xe9, 0x03, 0x00, 0x00, // command 1001
+		0x00, 0x00, 0x00, 0x00, // return code
+		0x01, 0x00, 0x00, 0x00, // flags
+		0x01, 0x00, 0x00, 0x00, // protocol version
+	}
+	h := Header{Signature: Signature, BodySize: 16, HaveToReturn: true, Command: 1001, Flags: FlagRequest, ProtocolVersion: ProtocolVersion1}
+	buf, _ := h.MarshalBinary()
+	if !bytes.Equal(buf, want) {
+		t.Fatalf("header is % x, want % x", buf, want)
+	}
+}
+
+func TestHeaderBadSignature(t *testing.T) {
+	h := Header{Signature: Signature}
+	buf, _ := h.MarshalBinary()
+	buf[0] ^= 0xff
+
+	var got Header
+	if err := got.UnmarshalBinary(buf); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("got %v, want ErrBadSignature", err)
+	}
+	if _, err := ReadPacket(bytes.NewReader(buf), 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("ReadPacket got %v, want ErrBadSignature", err)
+	}
+}
+
+func TestHeaderShort(t *testing.T) {
+	var h Header
+	if err := h.UnmarshalBinary(make([]byte, HeaderSize-1)); err == nil {
+		t.Fatal("short header accepted")
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	body := []byte("payload")
+	if err := WritePacket(&buf, Header{Command: 1003, Flags: FlagRequest, HaveToReturn: true}, body); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ReadPacket(&buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Body, body) {
+		t.Fatalf("body is %q, want %q", p.Body, body)
+	}
+	if p.Header.Command != 1003 || !p.Header.IsRequest() || !p.Header.HaveToReturn || p.Header.ProtocolVersion != ProtocolVersion1 {
+		t.Fatalf("unexpected header %+v", p.Header)
+	}
+}
+
+func TestReadPacketBodyLimit(t *testing.T) {
+	// The body is never sent: the size alone must be rejected before any
+	// allocation
+	header := func(size uint64) []byte {
+		h := Header{Signature: Signature}
+		buf, _ := h.MarshalBinary()
+		binary.LittleEndian.PutUint64(buf[8:16], size)
+		return buf
+	}
+
+	if _, err := ReadPacket(bytes.NewReader(header(InitialMaxBodySize+1)), InitialMaxBodySize); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("got %v, want ErrBodyTooLarge", err)
+	}
+	// No limit given means the default one, not an unlimited read
+	if _, err := ReadPacket(bytes.NewReader(header(1<<63)), 0); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("unlimited read: got %v, want ErrBodyTooLarge", err)
+	}
+}
@@ -0,0 +1,89 @@
+package p2p
+
+// Command ids from zanod's p2p_protocol_defs.h and currency_protocol_defs.h
+const (
+	CommandsPoolBase = 1000
+
+	CommandHandshake  = CommandsPoolBase + 1
+	CommandTimedSync  = CommandsPoolBase + 2
+	CommandPing       = CommandsPoolBase + 3
+	CommandStatInfo   = CommandsPoolBase + 4
+	CommandNetworkLog = CommandsPoolBase + 5
+	CommandPeerID     = CommandsPoolBase + 6
+
+	BCCommandsPoolBase = 2000
+
+	NotifyNewBlock           = BCCommandsPoolBase + 1
+	NotifyNewTransactions    = BCCommandsPoolBase + 2
+	NotifyRequestGetObjects  = BCCommandsPoolBase + 3
+	NotifyResponseGetObjects = BCCommandsPoolBase + 4
+	NotifyRequestChain       = BCCommandsPoolBase + 6
+	NotifyResponseChainEntry = BCCommandsPoolBase + 7
+	NotifyNewFluffyBlock     = BCCommandsPoolBase + 8
+)
+
+// PingOK is the status a live daemon returns for COMMAND_PING
+const PingOK = "OK"
+
+// BasicNodeData identifies a node during handshake
+type BasicNodeData struct {
+	NetworkID [16]byte `epee:"network_id"`
+	PeerID    uint64   `epee:"peer_id"`
+	LocalTime int64    `epee:"local_time"`
+	MyPort    uint32   `epee:"my_port"`
+}
+
+// CoreSyncData is the payload describing a node's chain state
+type CoreSyncData struct {
+	CurrentHeight        uint64   `epee:"current_height"`
+	TopID                [32]byte `epee:"top_id"`
+	LastCheckpointHeight uint64   `epee:"last_checkpoint_height"`
+	CoreTime             uint64   `epee:"core_time"`
+	ClientVersion        string   `epee:"client_version"`
+	NonPruningMode       bool     `epee:"non_pruning_mode_enabled"`
+}
+
+type HandshakeRequest struct {
+	NodeData    BasicNodeData `epee:"node_data"`
+	PayloadData CoreSyncData  `epee:"payload_data"`
+}
+
+// HandshakeResponse carries the remote's node data and its white peer list.
+// LocalPeerlist is left generic because zanod packs it as a blob of PODs;
+// use DecodePeerlist to read it.
+type HandshakeResponse struct {
+	NodeData      BasicNodeData `epee:"node_data"`
+	PayloadData   CoreSyncData  `epee:"payload_data"`
+	LocalPeerlist interface{}   `epee:"local_peerlist"`
+}
+
+type TimedSyncRequest struct {
+	PayloadData CoreSyncData `epee:"payload_data"`
+}
+
+type TimedSyncResponse struct {
+	LocalTime     int64        `epee:"local_time"`
+	PayloadData   CoreSyncData `epee:"payload_data"`
+	LocalPeerlist interface{}  `epee:"local_peerlist"`
+}
+
+type PingRequest struct{}
+
+type PingResponse struct {
+	Status string `epee:"status"`
+	PeerID uint64 `epee:"peer_id"`
+}
+
+// BlockCompleteEntry is a block blob with its transaction blobs
+type BlockCompleteEntry struct {
+	Block string   `epee:"block"`
+	Txs   []string `epee:"txs"`
+}
+
+// NotifyNewBlockRequest is the body of NOTIFY_NEW_BLOCK and
+// NOTIFY_NEW_FLUFFY_BLOCK. CurrentBlockchainHeight is the sender's chain
+// size including the announced block.
+type NotifyNewBlockRequest struct {
+	Block                   BlockCompleteEntry `epee:"b"`
+	CurrentBlockchainHeight uint64             `epee:"current_blockchain_height"`
+}
@@ -0,0 +1,234 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"zano-peer-finder/internal/epee"
+	"zano-peer-finder/internal/levin"
+)
+
+// DefaultClientVersion is advertised in our payload data. zanod drops peers
+// whose build is older than its minimum, so this tracks a recent release.
+const DefaultClientVersion = "2.1.5.400[peer-finder]"
+
+var ErrNetworkMismatch = errors.New("p2p: remote is on a different network")
+
+// Config describes how we present ourselves to remote nodes
+type Config struct {
+	NetworkID     [16]byte
+	PeerID        uint64
+	MyPort        uint32
+	ClientVersion string
+	Timeout       time.Duration
+}
+
+// NewConfig returns a config for the given network with a random peer id.
+// MyPort is zero so remote nodes do not try to connect back to us.
+func NewConfig(networkID [16]byte) *Config {
+	return &Config{
+		NetworkID:     networkID,
+		PeerID:        NewPeerID(),
+		ClientVersion: DefaultClientVersion,
+		Timeout:       10 * time.Second,
+	}
+}
+
+// NewPeerID returns a random peer id
+func NewPeerID() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (c *Config) nodeData() BasicNodeData {
+	return BasicNodeData{
+		NetworkID: c.NetworkID,
+		PeerID:    c.PeerID,
+		LocalTime: time.Now().Unix(),
+		MyPort:    c.MyPort,
+	}
+}
+
+func (c *Config) syncData() CoreSyncData {
+	return CoreSyncData{
+		CoreTime:       uint64(time.Now().Unix()),
+		ClientVersion:  c.ClientVersion,
+		NonPruningMode: true,
+	}
+}
+
+// Observer is called with every request and notification a remote sends
+// over a connection, before it is answered. It runs on the connection's
+// dispatch goroutine, so it must not block.
+type Observer func(p *levin.Packet)
+
+// Handler answers the requests a remote sends us while a connection is
+// open, so it does not drop us for failing timed sync
+func (c *Config) Handler() levin.Handler {
+	return c.ObservedHandler(nil)
+}
+
+// ObservedHandler is Handler with observe called for every inbound packet
+func (c *Config) ObservedHandler(observe Observer) levin.Handler {
+	return func(p *levin.Packet) ([]byte, int32) {
+		if observe != nil {
+			observe(p)
+		}
+		var resp interface{}
+		switch p.Header.Command {
+		case CommandTimedSync:
+			resp = &TimedSyncResponse{LocalTime: time.Now().Unix(), PayloadData: c.syncData()}
+		case CommandPing:
+			resp = &PingResponse{Status: PingOK, PeerID: c.PeerID}
+		default:
+			return nil, levin.ReturnErrHandlerNotDefined
+		}
+		body, err := epee.Marshal(resp)
+		if err != nil {
+			return nil, levin.ReturnErrFormat
+		}
+		return body, levin.ReturnOK
+	}
+}
+
+// Invoke marshals req, sends it as command and unmarshals the reply into resp
+func Invoke(ctx context.Context, conn *levin.Conn, command uint32, req, resp interface{}) error {
+	body, err := epee.Marshal(req)
+	if err != nil {
+		return err
+	}
+	p, err := conn.Invoke(ctx, command, body)
+	if err != nil {
+		return err
+	}
+	return epee.Unmarshal(p.Body, resp)
+}
+
+// Peer is an open, handshaken connection to a remote node
+type Peer struct {
+	Conn      *levin.Conn
+	Handshake *HandshakeResponse
+	Peerlist  []PeerlistEntry
+	Latency   time.Duration
+}
+
+// Connect dials addr and performs COMMAND_HANDSHAKE
+func Connect(ctx context.Context, addr string, cfg *Config) (*Peer, error) {
+	return ConnectObserved(ctx, addr, cfg, nil)
+}
+
+// ConnectObserved is Connect with observe called for every request and
+// notification the remote sends while the connection stays open
+func ConnectObserved(ctx context.Context, addr string, cfg *Config, observe Observer) (*Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	conn, err := levin.Dial(ctx, addr, cfg.Timeout, cfg.ObservedHandler(observe))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	req := &HandshakeRequest{NodeData: cfg.nodeData(), PayloadData: cfg.syncData()}
+	var resp HandshakeResponse
+	if err := Invoke(ctx, conn, CommandHandshake, req, &resp); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake with %s failed: %w", addr, err)
+	}
+	latency := time.Since(start)
+
+	if resp.NodeData.NetworkID != cfg.NetworkID {
+		conn.Close()
+		return nil, ErrNetworkMismatch
+	}
+
+	peers, err := DecodePeerlist(resp.LocalPeerlist)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// A handshaken peer may send blocks, which need zanod's full limit
+	conn.SetMaxBodySize(levin.DefaultMaxBodySize)
+
+	return &Peer{Conn: conn, Handshake: &resp, Peerlist: peers, Latency: latency}, nil
+}
+
+// Close closes the underlying connection
+func (p *Peer) Close() error {
+	return p.Conn.Close()
+}
+
+// Ping dials addr and sends COMMAND_PING without a handshake, the same way
+// zanod checks that a peer's advertised port is reachable. It fails unless
+// the remote answers "OK" with a non-zero peer id.
+func Ping(ctx context.Context, addr string, cfg *Config) (*PingResponse, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	conn, err := levin.Dial(ctx, addr, cfg.Timeout, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	var resp PingResponse
+	if err := Invoke(ctx, conn, CommandPing, &PingRequest{}, &resp); err != nil {
+		return nil, 0, fmt.Errorf("ping %s failed: %w", addr, err)
+	}
+	latency := time.Since(start)
+
+	if resp.Status != PingOK {
+		return &resp, latency, fmt.Errorf("ping %s: unexpected status %q", addr, resp.Status)
+	}
+	if resp.PeerID == 0 {
+		return &resp, latency, fmt.Errorf("ping %s: empty peer id", addr)
+	}
+	return &resp, latency, nil
+}
+
+// TimedSync sends COMMAND_TIMED_SYNC over an open connection and returns the
+// remote's current chain state
+func (p *Peer) TimedSync(ctx context.Context, cfg *Config) (*TimedSyncResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	var resp TimedSyncResponse
+	req := &TimedSyncRequest{PayloadData: cfg.syncData()}
+	if err := Invoke(ctx, p.Conn, CommandTimedSync, req, &resp); err != nil {
+		return nil, fmt.Errorf("timed sync with %s failed: %w", p.Conn.RemoteAddr(), err)
+	}
+	return &resp, nil
+}
+
+// DecodeNewBlock decodes a NOTIFY_NEW_BLOCK or NOTIFY_NEW_FLUFFY_BLOCK packet
+func DecodeNewBlock(p *levin.Packet) (*NotifyNewBlockRequest, error) {
+	if p.Header.Command != NotifyNewBlock && p.Header.Command != NotifyNewFluffyBlock {
+		return nil, fmt.Errorf("p2p: command %d is not a block notification", p.Header.Command)
+	}
+	var req NotifyNewBlockRequest
+	if err := epee.Unmarshal(p.Body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// DecodeTimedSync decodes a COMMAND_TIMED_SYNC request sent by a remote
+func DecodeTimedSync(p *levin.Packet) (*TimedSyncRequest, error) {
+	if p.Header.Command != CommandTimedSync || !p.Header.IsRequest() {
+		return nil, fmt.Errorf("p2p: command %d is not a timed sync request", p.Header.Command)
+	}
+	var req TimedSyncRequest
+	if err := epee.Unmarshal(p.Body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
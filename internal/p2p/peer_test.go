@@ -0,0 +1,158 @@
+package p2p_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"zano-peer-finder/internal/levin"
+	"zano-peer-finder/internal/network"
+	"zano-peer-finder/internal/p2p"
+	"zano-peer-finder/internal/simnet"
+)
+
+// startNet runs a simulated network for the length of the test
+func startNet(t *testing.T, specs []simnet.NodeSpec) *simnet.Network {
+	t.Helper()
+	sim, err := simnet.New(network.Mainnet.NetworkID, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	return sim
+}
+
+func testConfig() *p2p.Config {
+	cfg := p2p.NewConfig(network.Mainnet.NetworkID)
+	cfg.Timeout = 2 * time.Second
+	return cfg
+}
+
+func TestConnectHandshake(t *testing.T) {
+	sim := startNet(t, []simnet.NodeSpec{
+		{Height: 2500000, Version: "2.1.5.400[sim]", Peers: []int{1, 2}},
+		{Height: 2500001},
+		{Height: 2499999},
+	})
+
+	peer, err := p2p.Connect(context.Background(), sim.Nodes[0].Addr, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	hs := peer.Handshake
+	if hs.NodeData.PeerID != sim.Nodes[0].PeerID || hs.NodeData.NetworkID != network.Mainnet.NetworkID {
+		t.Errorf("unexpected node data %+v", hs.NodeData)
+	}
+	if hs.PayloadData.CurrentHeight != 2500000 || hs.PayloadData.ClientVersion != "2.1.5.400[sim]" {
+		t.Errorf("unexpected payload data %+v", hs.PayloadData)
+	}
+	if hs.PayloadData.TopID != simnet.TopID(2500000) {
+		t.Errorf("unexpected top id %x", hs.PayloadData.TopID)
+	}
+
+	// The peer list names the advertised nodes at their real addresses
+	if len(peer.Peerlist) != 2 {
+		t.Fatalf("got %d peers, want 2", len(peer.Peerlist))
+	}
+	for i, e := range peer.Peerlist {
+		want := sim.Nodes[i+1]
+		if e.Address() != want.Addr || e.PeerID != want.PeerID {
+			t.Errorf("peer %d is %s id %d, want %s id %d", i, e.Address(), e.PeerID, want.Addr, want.PeerID)
+		}
+	}
+	if sim.Nodes[0].Handshakes.Load() != 1 {
+		t.Errorf("node saw %d handshakes, want 1", sim.Nodes[0].Handshakes.Load())
+	}
+}
+
+func TestTimedSync(t *testing.T) {
+	sim := startNet(t, []simnet.NodeSpec{{Height: 100}})
+	cfg := testConfig()
+
+	peer, err := p2p.Connect(context.Background(), sim.Nodes[0].Addr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	sim.Nodes[0].SetHeight(101)
+	resp, err := peer.TimedSync(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PayloadData.CurrentHeight != 101 || resp.PayloadData.TopID != simnet.TopID(101) {
+		t.Errorf("unexpected payload data %+v", resp.PayloadData)
+	}
+}
+
+func TestPing(t *testing.T) {
+	sim := startNet(t, []simnet.NodeSpec{{}, {Behavior: simnet.BehaviorBadPing}})
+
+	resp, latency, err := p2p.Ping(context.Background(), sim.Nodes[0].Addr, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != p2p.PingOK || resp.PeerID != sim.Nodes[0].PeerID || latency <= 0 {
+		t.Errorf("unexpected ping response %+v in %s", resp, latency)
+	}
+	if sim.Nodes[0].Pings.Load() != 1 || sim.Nodes[0].Handshakes.Load() != 0 {
+		t.Errorf("node saw %d pings and %d handshakes, want a ping alone", sim.Nodes[0].Pings.Load(), sim.Nodes[0].Handshakes.Load())
+	}
+
+	if _, _, err := p2p.Ping(context.Background(), sim.Nodes[1].Addr, testConfig()); err == nil {
+		t.Error("non-OK ping status accepted")
+	}
+}
+
+func TestFailureBehaviors(t *testing.T) {
+	sim := startNet(t, []simnet.NodeSpec{
+		{Behavior: simnet.BehaviorRefuse},
+		{Behavior: simnet.BehaviorTimeout},
+		{Behavior: simnet.BehaviorMalformed},
+		{Behavior: simnet.BehaviorBadSignature},
+		{Behavior: simnet.BehaviorWrongNetwork},
+		{Behavior: simnet.BehaviorError},
+	})
+	cfg := testConfig()
+	cfg.Timeout = 500 * time.Millisecond
+
+	tests := []struct {
+		name  string
+		node  int
+		check func(error) bool
+		pings bool // A ping carries no network id, so a node on another network still answers it
+	}{
+		{"refused", 0, func(err error) bool { return err != nil }, false},
+		{"timeout", 1, func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }, false},
+		{"malformed body", 2, func(err error) bool { return err != nil }, false},
+		{"bad signature", 3, func(err error) bool { return errors.Is(err, levin.ErrBadSignature) }, false},
+		{"wrong network", 4, func(err error) bool { return errors.Is(err, p2p.ErrNetworkMismatch) }, true},
+		{"error return code", 5, func(err error) bool {
+			var rce *levin.ReturnCodeError
+			return errors.As(err, &rce)
+		}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			peer, err := p2p.Connect(context.Background(), sim.Nodes[tc.node].Addr, cfg)
+			if err == nil {
+				peer.Close()
+				t.Fatal("handshake succeeded")
+			}
+			if !tc.check(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*cfg.Timeout {
+				t.Errorf("failure took %s with a %s timeout", elapsed, cfg.Timeout)
+			}
+
+			if _, _, err := p2p.Ping(context.Background(), sim.Nodes[tc.node].Addr, cfg); (err == nil) != tc.pings {
+				t.Errorf("ping gave %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// peerlistEntrySize is sizeof(peerlist_entry) under #pragma pack(1):
+// uint32 ip, uint32 port, uint64 id, int64 last_seen
+const peerlistEntrySize = 24
+
+// PeerlistEntry is a single advertised peer
+type PeerlistEntry struct {
+	IP       net.IP
+	Port     uint32
+	PeerID   uint64
+	LastSeen time.Time
+}
+
+// Address returns the entry as a dialable host:port string
+func (e PeerlistEntry) Address() string {
+	return net.JoinHostPort(e.IP.String(), strconv.FormatUint(uint64(e.Port), 10))
+}
+
+// DecodePeerlist reads a local_peerlist value as decoded by epee. zanod
+// sends a blob of packed entries; an array of objects is accepted too.
+func DecodePeerlist(v interface{}) ([]PeerlistEntry, error) {
+	switch pl := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return decodePeerlistBlob([]byte(pl))
+	case []interface{}:
+		return decodePeerlistObjects(pl)
+	}
+	return nil, fmt.Errorf("p2p: unexpected local_peerlist type %T", v)
+}
+
+func decodePeerlistBlob(b []byte) ([]PeerlistEntry, error) {
+	if len(b)%peerlistEntrySize != 0 {
+		return nil, fmt.Errorf("p2p: peerlist blob length %d is not a multiple of %d", len(b), peerlistEntrySize)
+	}
+
+	entries := make([]PeerlistEntry, 0, len(b)/peerlistEntrySize)
+	for off := 0; off < len(b); off += peerlistEntrySize {
+		e := b[off : off+peerlistEntrySize]
+		entries = append(entries, PeerlistEntry{
+			// The address is stored in network order in a little-endian uint32
+			IP:       net.IPv4(e[0], e[1], e[2], e[3]),
+			Port:     binary.LittleEndian.Uint32(e[4:8]),
+			PeerID:   binary.LittleEndian.Uint64(e[8:16]),
+			LastSeen: lastSeenTime(int64(binary.LittleEndian.Uint64(e[16:24]))),
+		})
+	}
+	return entries, nil
+}
+
+func decodePeerlistObjects(arr []interface{}) ([]PeerlistEntry, error) {
+	entries := make([]PeerlistEntry, 0, len(arr))
+	for i, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("p2p: peerlist entry %d is %T", i, item)
+		}
+		adr, _ := obj["adr"].(map[string]interface{})
+		ip, ok := asUint(adr["ip"])
+		if !ok {
+			return nil, fmt.Errorf("p2p: peerlist entry %d has no ip", i)
+		}
+		port, _ := asUint(adr["port"])
+		id, _ := asUint(obj["id"])
+		lastSeen, _ := asUint(obj["last_seen"])
+
+		entries = append(entries, PeerlistEntry{
+			IP:       net.IPv4(byte(ip), byte(ip>>8), byte(ip>>16), byte(ip>>24)),
+			Port:     uint32(port),
+			PeerID:   id,
+			LastSeen: lastSeenTime(int64(lastSeen)),
+		})
+	}
+	return entries, nil
+}
+
+// EncodePeerlist packs entries into the blob form zanod sends
+func EncodePeerlist(entries []PeerlistEntry) string {
+	b := make([]byte, 0, len(entries)*peerlistEntrySize)
+	for _, e := range entries {
+		ip := e.IP.To4()
+		if ip == nil {
+			continue
+		}
+		b = append(b, ip...)
+		b = binary.LittleEndian.AppendUint32(b, e.Port)
+		b = binary.LittleEndian.AppendUint64(b, e.PeerID)
+		var lastSeen int64
+		if !e.LastSeen.IsZero() {
+			lastSeen = e.LastSeen.Unix()
+		}
+		b = binary.LittleEndian.AppendUint64(b, uint64(lastSeen))
+	}
+	return string(b)
+}
+
+// lastSeenTime converts a last_seen timestamp. zanod sends 0 for peers it
+// has never seen itself, which is no time rather than the epoch.
+func lastSeenTime(sec int64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func asUint(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case uint32:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint8:
+		return uint64(n), true
+	case int64:
+		return uint64(n), n >= 0
+	case int32:
+		return uint64(n), n >= 0
+	}
+	return 0, false
+}
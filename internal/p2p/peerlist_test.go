@@ -0,0 +1,64 @@
+package p2p_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"zano-peer-finder/internal/p2p"
+)
+
+func TestPeerlistBlobRoundTrip(t *testing.T) {
+	want := []p2p.PeerlistEntry{
+		{IP: net.IPv4(95, 216, 50, 10), Port: 11121, PeerID: 0x1122334455667788, LastSeen: time.Unix(1760680123, 0)},
+		{IP: net.IPv4(144, 76, 18, 3), Port: 11121, PeerID: 42},
+	}
+	got, err := p2p.DecodePeerlist(p2p.EncodePeerlist(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].IP.Equal(want[i].IP) || got[i].Port != want[i].Port || got[i].PeerID != want[i].PeerID || !got[i].LastSeen.Equal(want[i].LastSeen) {
+			t.Errorf("entry %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPeerlistZeroLastSeen(t *testing.T) {
+	// A packed entry with last_seen 0, as zanod sends for peers it has
+	// never seen itself
+	blob := string([]byte{
+		95, 216, 50, 10, // ip
+		0x71, 0x2b, 0, 0, // port 11121
+		1, 0, 0, 0, 0, 0, 0, 0, // peer id
+		0, 0, 0, 0, 0, 0, 0, 0, // last_seen
+	})
+	entries, err := p2p.DecodePeerlist(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].LastSeen.IsZero() {
+		t.Fatalf("last_seen 0 decoded as %v", entries)
+	}
+
+	objects := []interface{}{map[string]interface{}{
+		"adr":       map[string]interface{}{"ip": uint32(0x0a32d85f), "port": uint32(11121)},
+		"id":        uint64(1),
+		"last_seen": int64(0),
+	}}
+	if entries, err = p2p.DecodePeerlist(objects); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].LastSeen.IsZero() || entries[0].Address() != "95.216.50.10:11121" {
+		t.Fatalf("object entry decoded as %+v", entries)
+	}
+}
+
+func TestPeerlistBadLength(t *testing.T) {
+	if _, err := p2p.DecodePeerlist(string(make([]byte, 25))); err == nil {
+		t.Fatal("truncated peerlist blob accepted")
+	}
+}
@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"zano-peer-finder/internal/epee"
+	"zano-peer-finder/internal/levin"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MaxInboundBodySize caps packets from peers that connect to us once they
+// have handshaken. It leaves room for block notifications, which we read
+// and discard.
+const MaxInboundBodySize = 10 * 1024 * 1024
+
+// Server accepts inbound Levin connections and answers handshakes, so nodes
+// that connect out to us (including ones behind NAT) can be recorded
+type Server struct {
+	cfg         *Config
+	lifetime    time.Duration
+	onHandshake func(remote *net.TCPAddr, req *HandshakeRequest)
+
+	mu    sync.Mutex
+	conns map[*levin.Conn]struct{}
+}
+
+// NewServer creates a server. onHandshake is called for every inbound
+// handshake on our network, before the response is sent. Connections are
+// held open for at most lifetime; we only need the handshake, but dropping
+// peers straight away makes them reconnect in a loop.
+func NewServer(cfg *Config, lifetime time.Duration, onHandshake func(remote *net.TCPAddr, req *HandshakeRequest)) *Server {
+	return &Server{
+		cfg:         cfg,
+		lifetime:    lifetime,
+		onHandshake: onHandshake,
+		conns:       make(map[*levin.Conn]struct{}),
+	}
+}
+
+// ListenAndServe accepts connections on addr until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("addr", ln.Addr().String()).Msg("P2P listener started")
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		s.serve(c)
+	}
+}
+
+func (s *Server) serve(c net.Conn) {
+	remote, _ := c.RemoteAddr().(*net.TCPAddr)
+	handshaken := false
+	var lc *levin.Conn
+	ready := make(chan struct{}) // lc is set
+
+	base := s.cfg.Handler()
+	handler := func(p *levin.Packet) ([]byte, int32) {
+		if p.Header.Command != CommandHandshake {
+			if !handshaken && p.Header.Command != CommandPing {
+				return nil, levin.ReturnErrConnection
+			}
+			return base(p)
+		}
+
+		var req HandshakeRequest
+		if err := epee.Unmarshal(p.Body, &req); err != nil {
+			log.Debug().Err(err).Str("remote", c.RemoteAddr().String()).Msg("Malformed inbound handshake")
+			return nil, levin.ReturnErrFormat
+		}
+		if req.NodeData.NetworkID != s.cfg.NetworkID {
+			log.Debug().Str("remote", c.RemoteAddr().String()).Msg("Inbound handshake from another network")
+			c.Close()
+			return nil, levin.ReturnErrConnection
+		}
+		handshaken = true
+		<-ready
+		lc.SetMaxBodySize(MaxInboundBodySize)
+		if s.onHandshake != nil && remote != nil {
+			s.onHandshake(remote, &req)
+		}
+
+		body, err := epee.Marshal(&HandshakeResponse{
+			NodeData:    s.cfg.nodeData(),
+			PayloadData: s.cfg.syncData(),
+		})
+		if err != nil {
+			return nil, levin.ReturnErrFormat
+		}
+		return body, levin.ReturnOK
+	}
+
+	// Strangers get zanod's pre-handshake limit until they handshake
+	lc = levin.NewConn(c, levin.InitialMaxBodySize, handler)
+	close(ready)
+
+	s.mu.Lock()
+	s.conns[lc] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		timer := time.NewTimer(s.lifetime)
+		defer timer.Stop()
+		select {
+		case <-lc.Done():
+		case <-timer.C:
+			lc.Close()
+		}
+		s.mu.Lock()
+		delete(s.conns, lc)
+		s.mu.Unlock()
+	}()
+}
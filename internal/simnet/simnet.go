@@ -0,0 +1,319 @@
+package simnet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zano-peer-finder/internal/epee"
+	"zano-peer-finder/internal/levin"
+	"zano-peer-finder/internal/p2p"
+)
+
+// Behavior controls how a simulated node treats incoming connections
+type Behavior int
+
+const (
+	BehaviorNormal       Behavior = iota
+	BehaviorRefuse                // close the connection as soon as it is accepted
+	BehaviorTimeout               // accept and read, but never answer
+	BehaviorMalformed             // answer with a bucket whose body is not portable storage
+	BehaviorBadSignature          // answer with garbage that fails the Levin signature check
+	BehaviorWrongNetwork          // answer handshakes with a different network id
+	BehaviorBadPing               // answer COMMAND_PING with a non-OK status
+	BehaviorError                 // answer every request with a negative return code
+)
+
+// NodeSpec describes one simulated node
+type NodeSpec struct {
+	Height   uint64
+	Version  string
+	Behavior Behavior
+	// Peers lists indexes of other nodes in the network to advertise
+	Peers []int
+	// ExtraPeers are advertised verbatim, e.g. unreachable endpoints
+	ExtraPeers []p2p.PeerlistEntry
+	// Delay is added before every response
+	Delay time.Duration
+}
+
+// Node is a running simulated node
+type Node struct {
+	Index  int
+	Addr   string
+	PeerID uint64
+
+	Handshakes atomic.Int64
+	TimedSyncs atomic.Int64
+	Pings      atomic.Int64
+
+	mu       sync.Mutex
+	spec     NodeSpec
+	peerlist []p2p.PeerlistEntry
+	conns    map[*levin.Conn]struct{}
+
+	network  *Network
+	listener net.Listener
+}
+
+// Network is a set of simulated nodes listening on loopback
+type Network struct {
+	NetworkID [16]byte
+	Nodes     []*Node
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// New starts one node per spec on 127.0.0.1 with an ephemeral port and
+// resolves each node's advertised peers to the real addresses
+func New(networkID [16]byte, specs []NodeSpec) (*Network, error) {
+	n := &Network{NetworkID: networkID, conns: make(map[net.Conn]struct{})}
+
+	for i, spec := range specs {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		if spec.Version == "" {
+			spec.Version = p2p.DefaultClientVersion
+		}
+		n.Nodes = append(n.Nodes, &Node{
+			Index:    i,
+			Addr:     ln.Addr().String(),
+			PeerID:   uint64(i + 1),
+			spec:     spec,
+			conns:    make(map[*levin.Conn]struct{}),
+			network:  n,
+			listener: ln,
+		})
+	}
+
+	for _, node := range n.Nodes {
+		for _, idx := range node.spec.Peers {
+			if idx < 0 || idx >= len(n.Nodes) {
+				n.Close()
+				return nil, fmt.Errorf("simnet: node %d advertises unknown node %d", node.Index, idx)
+			}
+			peer := n.Nodes[idx]
+			host, portStr, _ := net.SplitHostPort(peer.Addr)
+			port, _ := strconv.Atoi(portStr)
+			node.peerlist = append(node.peerlist, p2p.PeerlistEntry{
+				IP:       net.ParseIP(host),
+				Port:     uint32(port),
+				PeerID:   peer.PeerID,
+				LastSeen: time.Now(),
+			})
+		}
+		node.peerlist = append(node.peerlist, node.spec.ExtraPeers...)
+	}
+
+	for _, node := range n.Nodes {
+		n.wg.Add(1)
+		go node.acceptLoop()
+	}
+	return n, nil
+}
+
+// Addrs returns the address of every node
+func (n *Network) Addrs() []string {
+	addrs := make([]string, len(n.Nodes))
+	for i, node := range n.Nodes {
+		addrs[i] = node.Addr
+	}
+	return addrs
+}
+
+// Close stops all nodes and waits for their accept loops to exit
+func (n *Network) Close() {
+	for _, node := range n.Nodes {
+		node.listener.Close()
+	}
+	n.mu.Lock()
+	for c := range n.conns {
+		c.Close()
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// SetHeight changes the height a node reports, e.g. to simulate a new block
+func (node *Node) SetHeight(height uint64) {
+	node.mu.Lock()
+	node.spec.Height = height
+	node.mu.Unlock()
+}
+
+// AnnounceBlock moves the node to height and sends NOTIFY_NEW_FLUFFY_BLOCK
+// to every open connection, the way a daemon relays a block it accepted
+func (node *Node) AnnounceBlock(height uint64) {
+	node.mu.Lock()
+	node.spec.Height = height
+	conns := make([]*levin.Conn, 0, len(node.conns))
+	for lc := range node.conns {
+		conns = append(conns, lc)
+	}
+	node.mu.Unlock()
+
+	id := TopID(height)
+	body, err := epee.Marshal(&p2p.NotifyNewBlockRequest{
+		Block:                   p2p.BlockCompleteEntry{Block: string(id[:])},
+		CurrentBlockchainHeight: height,
+	})
+	if err != nil {
+		return
+	}
+	for _, lc := range conns {
+		lc.Notify(p2p.NotifyNewFluffyBlock, body)
+	}
+}
+
+// SetBehavior changes how the node treats new requests
+func (node *Node) SetBehavior(b Behavior) {
+	node.mu.Lock()
+	node.spec.Behavior = b
+	node.mu.Unlock()
+}
+
+func (node *Node) snapshot() NodeSpec {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.spec
+}
+
+// TopID derives a deterministic block id from a height so nodes at the
+// same height agree on their tip
+func TopID(height uint64) [32]byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], height)
+	return sha256.Sum256(b[:])
+}
+
+func (node *Node) acceptLoop() {
+	defer node.network.wg.Done()
+	for {
+		c, err := node.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		switch node.snapshot().Behavior {
+		case BehaviorRefuse:
+			c.Close()
+		case BehaviorTimeout:
+			// Hold the connection open without answering until the network closes
+			node.network.track(c, nil)
+		case BehaviorBadSignature:
+			go func() {
+				c.Write([]byte("this is not a levin bucket, just noise on the wire"))
+				c.Close()
+			}()
+		default:
+			lc := levin.NewConn(c, levin.DefaultMaxBodySize, node.handle)
+			node.network.track(c, lc.Done())
+			node.mu.Lock()
+			node.conns[lc] = struct{}{}
+			node.mu.Unlock()
+			go func() {
+				<-lc.Done()
+				node.mu.Lock()
+				delete(node.conns, lc)
+				node.mu.Unlock()
+			}()
+		}
+	}
+}
+
+// track remembers c so Close can tear it down, forgetting it once done closes
+func (n *Network) track(c net.Conn, done <-chan struct{}) {
+	n.mu.Lock()
+	n.conns[c] = struct{}{}
+	n.mu.Unlock()
+
+	if done == nil {
+		return
+	}
+	go func() {
+		<-done
+		n.mu.Lock()
+		delete(n.conns, c)
+		n.mu.Unlock()
+	}()
+}
+
+func (node *Node) handle(p *levin.Packet) ([]byte, int32) {
+	spec := node.snapshot()
+	if spec.Delay > 0 {
+		time.Sleep(spec.Delay)
+	}
+
+	switch spec.Behavior {
+	case BehaviorMalformed:
+		return []byte{0xde, 0xad, 0xbe, 0xef}, levin.ReturnOK
+	case BehaviorError:
+		return nil, levin.ReturnErrConnection
+	}
+
+	networkID := node.network.NetworkID
+	if spec.Behavior == BehaviorWrongNetwork {
+		networkID[15] ^= 0xff
+	}
+	nodeData := p2p.BasicNodeData{
+		NetworkID: networkID,
+		PeerID:    node.PeerID,
+		LocalTime: time.Now().Unix(),
+		MyPort:    node.port(),
+	}
+	syncData := p2p.CoreSyncData{
+		CurrentHeight: spec.Height,
+		TopID:         TopID(spec.Height),
+		CoreTime:      uint64(time.Now().Unix()),
+		ClientVersion: spec.Version,
+	}
+
+	var resp interface{}
+	switch p.Header.Command {
+	case p2p.CommandHandshake:
+		node.Handshakes.Add(1)
+		resp = &p2p.HandshakeResponse{
+			NodeData:      nodeData,
+			PayloadData:   syncData,
+			LocalPeerlist: p2p.EncodePeerlist(node.peerlist),
+		}
+	case p2p.CommandTimedSync:
+		node.TimedSyncs.Add(1)
+		resp = &p2p.TimedSyncResponse{
+			LocalTime:     time.Now().Unix(),
+			PayloadData:   syncData,
+			LocalPeerlist: p2p.EncodePeerlist(node.peerlist),
+		}
+	case p2p.CommandPing:
+		node.Pings.Add(1)
+		status := p2p.PingOK
+		if spec.Behavior == BehaviorBadPing {
+			status = "FAIL"
+		}
+		resp = &p2p.PingResponse{Status: status, PeerID: node.PeerID}
+	default:
+		return nil, levin.ReturnErrHandlerNotDefined
+	}
+
+	body, err := epee.Marshal(resp)
+	if err != nil {
+		return nil, levin.ReturnErrFormat
+	}
+	return body, levin.ReturnOK
+}
+
+func (node *Node) port() uint32 {
+	_, portStr, _ := net.SplitHostPort(node.Addr)
+	port, _ := strconv.Atoi(portStr)
+	return uint32(port)
+}
@@ -0,0 +1,187 @@
+package zanolog
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EventType classifies what a zanod log line says happened to a peer
+type EventType string
+
+const (
+	EventOutboundConnect EventType = "outbound_connect"
+	EventInboundConnect  EventType = "inbound_connect"
+	EventHandshakeFailed EventType = "handshake_failed"
+	EventDisconnect      EventType = "disconnect"
+	EventPeerBanned      EventType = "peer_banned"
+	EventSyncProgress    EventType = "sync_progress"
+	// An endpoint named in a line that matches no other pattern
+	EventPeerMentioned EventType = "peer_mentioned"
+)
+
+// Connection directions
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// Event is a peer event parsed from one log line
+type Event struct {
+	Type      EventType
+	IP        string
+	Port      int    // 0 if the line doesn't say
+	Direction string // DirectionInbound, DirectionOutbound or empty
+	Height    uint64 // Sync target height, sync events only
+}
+
+// String formats the event as one tab-separated line, the format of the
+// golden files in testdata
+func (e Event) String() string {
+	dir := e.Direction
+	if dir == "" {
+		dir = "-"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%d", e.Type, net.JoinHostPort(e.IP, strconv.Itoa(e.Port)), dir, e.Height)
+}
+
+// Address patterns. IPv6 addresses are only recognised in brackets when
+// followed by a port, as "[2001:db8::1]:11121", since a bare one can't be
+// told apart from its port.
+const (
+	ipv4Pattern = `\d{1,3}(?:\.\d{1,3}){3}`
+	ipv6Pattern = `\[[0-9A-Fa-f:.]*:[0-9A-Fa-f:.]*\]`
+	hostPattern = `(?:` + ipv4Pattern + `|` + ipv6Pattern + `)`
+)
+
+// epee tags lines logged for a connection with its context,
+// "[1.2.3.4:11121 OUT]" or "[[2001:db8::1]:11121 INC]"
+var contextRegex = regexp.MustCompile(`\[(` + hostPattern + `):(\d{1,5}) (INC|OUT)\]`)
+
+// An endpoint with its port. A port is required so that version strings
+// such as 2.0.1.367 and dotted numbers in hashes don't match.
+var endpointRegex = regexp.MustCompile(`(?:^|[^\d.])(` + hostPattern + `):(\d{1,5})\b`)
+
+// An address without a port, accepted only in ban messages which name the
+// host alone. A trailing full stop ends the sentence. Bare IPv6 addresses
+// are matched loosely and checked by parsing, which also skips the
+// timestamp.
+var hostRegex = regexp.MustCompile(`(?:^|[^\d.])(` + ipv4Pattern + `)(?:\.?(?:[^\d.]|$))` +
+	`|(?:^|[^\w:.\[])((?:[0-9A-Fa-f]{0,4}:){2,7}(?:` + ipv4Pattern + `|[0-9A-Fa-f]{1,4})?)` +
+	`|(` + ipv6Pattern + `)`)
+
+// The sync target in "Sync data returned a new top block candidate:
+// 2500000 -> 2500010 [10 blocks (0 days) behind]"
+var syncHeightRegex = regexp.MustCompile(`(\d+) -> (\d+)`)
+
+// pattern maps message text to an event type. Patterns are tried in order,
+// so more specific ones come first.
+type pattern struct {
+	typ       EventType
+	re        *regexp.Regexp
+	direction string // Implied direction when the line has no context
+}
+
+var patterns = []pattern{
+	{typ: EventPeerBanned, re: regexp.MustCompile(`(?i)\b(?:blocked|banned|blocking host|ban host)\b`)},
+	{typ: EventHandshakeFailed, re: regexp.MustCompile(`(?i)handshake\b.*\b(?:fail|failed|timeout|timed out|error)\b|(?:fail|failed) to (?:invoke )?(?:command_)?handshake|wrong network|network id mismatch`)},
+	{typ: EventDisconnect, re: regexp.MustCompile(`(?i)\bclose(?:d)? connection\b|\bconnection closed\b|\bdisconnect(?:ed|ing)?\b|\bdropping connection\b`)},
+	{typ: EventSyncProgress, re: regexp.MustCompile(`(?i)\bsync data returned\b|\bsynchroniz(?:ed|ation|ing)\b|\bsyncing\b`)},
+	{typ: EventInboundConnect, re: regexp.MustCompile(`(?i)\b(?:incoming|accepted) connection\b`), direction: DirectionInbound},
+	{typ: EventOutboundConnect, re: regexp.MustCompile(`(?i)\bconnecting to\b|\bconnected to\b`), direction: DirectionOutbound},
+	{typ: EventOutboundConnect, re: regexp.MustCompile(`(?i)\bnew connection\b|\bhandshake(?:d)? ok\b|\bconnection established\b`)},
+}
+
+// Parse classifies one log line. It reports false for lines that name no
+// usable peer endpoint.
+func Parse(line string) (Event, bool) {
+	var ev Event
+
+	// The connection context is the most reliable source of the endpoint
+	// and direction
+	if m := contextRegex.FindStringSubmatch(line); m != nil {
+		ev.IP, ev.Port = canonicalIP(m[1]), atoiPort(m[2])
+		if m[3] == "INC" {
+			ev.Direction = DirectionInbound
+		} else {
+			ev.Direction = DirectionOutbound
+		}
+		line = strings.Replace(line, m[0], "", 1)
+	}
+
+	typ := EventPeerMentioned
+	impliedDirection := ""
+	for _, p := range patterns {
+		if p.re.MatchString(line) {
+			typ, impliedDirection = p.typ, p.direction
+			break
+		}
+	}
+
+	if ev.IP == "" {
+		if m := endpointRegex.FindStringSubmatch(line); m != nil {
+			ev.IP, ev.Port = canonicalIP(m[1]), atoiPort(m[2])
+		} else if typ == EventPeerBanned {
+			ev.IP = findHost(line)
+		}
+		ev.Direction = impliedDirection
+	}
+	if !usableIP(ev.IP) {
+		return Event{}, false
+	}
+
+	// A new connection's direction comes from its context
+	if typ == EventOutboundConnect && ev.Direction == DirectionInbound {
+		typ = EventInboundConnect
+	}
+	ev.Type = typ
+
+	if typ == EventSyncProgress {
+		if m := syncHeightRegex.FindStringSubmatch(line); m != nil {
+			ev.Height, _ = strconv.ParseUint(m[2], 10, 64)
+		}
+	}
+	return ev, true
+}
+
+// findHost returns the first address in line that parses, in canonical form
+func findHost(line string) string {
+	for _, m := range hostRegex.FindAllStringSubmatch(line, -1) {
+		for _, host := range m[1:] {
+			if ip := canonicalIP(host); ip != "" {
+				return ip
+			}
+		}
+	}
+	return ""
+}
+
+// canonicalIP returns the standard form of an address, bracketed or not:
+// IPv6 compressed and lower case, IPv4-mapped IPv6 as IPv4. It returns ""
+// for anything that isn't an address.
+func canonicalIP(s string) string {
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// usableIP reports whether ip is a valid address of a remote peer
+func usableIP(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	return !ip.IsLoopback() && !ip.IsUnspecified()
+}
+
+func atoiPort(s string) int {
+	port, err := strconv.Atoi(s)
+	if err != nil || port > 65535 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,33 @@
+// Package zanolog extracts peer information from zanod log output
+package zanolog
+
+import (
+	"regexp"
+	"time"
+)
+
+// zanod prefixes each log entry with its local time, e.g.
+// "2024-Mar-05 12:34:56.789123". Some builds print numeric months.
+var timestampRegex = regexp.MustCompile(`^\s*(\d{4}-(?:[A-Z][a-z]{2}|\d{2})-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)`)
+
+var timestampLayouts = []string{
+	"2006-Jan-02 15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// ParseTimestamp returns the time a log line was written. zanod logs in
+// the local time of its host, so loc must be that host's time zone.
+// Continuation lines of multi-line entries carry no timestamp.
+func ParseTimestamp(line string, loc *time.Location) (time.Time, bool) {
+	m := timestampRegex.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	for _, layout := range timestampLayouts {
+		// Fractional seconds are accepted after the seconds field
+		if t, err := time.ParseInLocation(layout, m[1], loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
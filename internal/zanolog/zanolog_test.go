@@ -0,0 +1,116 @@
+package zanolog_test
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zano-peer-finder/internal/zanolog"
+)
+
+var update = flag.Bool("update", false, "Rewrite testdata/events.golden from the parser's output")
+
+// TestEventsGolden parses testdata/events.log and compares the events with
+// testdata/events.golden, in the format log-replay -events prints
+func TestEventsGolden(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got bytes.Buffer
+	lineNo := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		if ev, ok := zanolog.Parse(scanner.Text()); ok {
+			fmt.Fprintf(&got, "%d\t%s\n", lineNo, ev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "events.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotLines := strings.Split(got.String(), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("events differ from %s at line %d (run with -update if the change is intended):\ngot:  %q\nwant: %q", golden, i+1, g, w)
+		}
+	}
+}
+
+func TestParseIPv6(t *testing.T) {
+	tests := []struct {
+		line string
+		want zanolog.Event
+		ok   bool
+	}{
+		{
+			"[P2P0][[2a01:4f8:10a:2B::2]:11121 OUT] CONNECTION HANDSHAKED OK",
+			zanolog.Event{Type: zanolog.EventOutboundConnect, IP: "2a01:4f8:10a:2b::2", Port: 11121, Direction: zanolog.DirectionOutbound},
+			true,
+		},
+		{
+			"[P2P2][[2001:DB8:0:0:0:0:0:7]:40600 INC] CLOSE CONNECTION",
+			zanolog.Event{Type: zanolog.EventDisconnect, IP: "2001:db8::7", Port: 40600, Direction: zanolog.DirectionInbound},
+			true,
+		},
+		{
+			"[P2P1][[2a01:4f8::9]:11121 OUT] Sync data returned a new top block candidate: 2555120 -> 2555184 [64 blocks (0 days) behind]",
+			zanolog.Event{Type: zanolog.EventSyncProgress, IP: "2a01:4f8::9", Port: 11121, Direction: zanolog.DirectionOutbound, Height: 2555184},
+			true,
+		},
+		{
+			"[P2P8]Syncing with [2a01:4f8::5]:11121, 12 blocks behind",
+			zanolog.Event{Type: zanolog.EventSyncProgress, IP: "2a01:4f8::5", Port: 11121},
+			true,
+		},
+		// Ban messages name the host alone, without brackets or port
+		{
+			"[P2P6]Host 2A01:4F8::23 blocked.",
+			zanolog.Event{Type: zanolog.EventPeerBanned, IP: "2a01:4f8::23"},
+			true,
+		},
+		// IPv4-mapped addresses are stored as IPv4
+		{
+			"[P2P7]Accepted connection from [::ffff:46.4.18.22]:52311",
+			zanolog.Event{Type: zanolog.EventInboundConnect, IP: "46.4.18.22", Port: 52311, Direction: zanolog.DirectionInbound},
+			true,
+		},
+		// The daemon's own unspecified and loopback bind addresses
+		{"Binding on [::]:11121", zanolog.Event{}, false},
+		{"Starting core rpc server at [::1]:11211", zanolog.Event{}, false},
+	}
+	for _, tc := range tests {
+		ev, ok := zanolog.Parse(tc.line)
+		if ok != tc.ok || ev != tc.want {
+			t.Errorf("%q parsed as %+v (ok %v), want %+v (ok %v)", tc.line, ev, ok, tc.want, tc.ok)
+		}
+	}
+}
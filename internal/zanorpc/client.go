@@ -0,0 +1,167 @@
+// Package zanorpc is a client for the zanod daemon RPC interface
+package zanorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MaxResponseSize bounds how much of a response body is read
+const MaxResponseSize = 16 << 20
+
+// JSON-RPC error codes returned by the daemon
+const (
+	CodeMethodNotFound = -32601
+)
+
+// Error is a JSON-RPC error returned by the daemon
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("zanorpc: rpc error %d: %s", e.Code, e.Message)
+}
+
+// ErrBadStatus is returned when a call succeeds at the transport level but
+// the daemon reports a status other than OK
+var ErrBadStatus = errors.New("zanorpc: daemon returned non-OK status")
+
+// IsMethodNotFound reports whether err means the daemon doesn't expose the
+// requested method, which happens with restricted RPC or older builds
+func IsMethodNotFound(err error) bool {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == CodeMethodNotFound
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// HTTPError is returned when the daemon answers with a non-200 status
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("zanorpc: http status %d", e.StatusCode)
+}
+
+// Client talks to one daemon's RPC port
+type Client struct {
+	baseURL string
+	http    *http.Client
+	nextID  uint64
+}
+
+// New creates a client for the daemon at addr (host:port or a full URL)
+func New(addr string, timeout time.Duration) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{
+		baseURL: strings.TrimRight(addr, "/"),
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// URL returns the daemon's base URL
+func (c *Client) URL() string {
+	return c.baseURL
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Call invokes a JSON-RPC method on /json_rpc and decodes its result
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	req := request{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.nextID, 1),
+		Method:  method,
+		Params:  params,
+	}
+
+	var resp response
+	if err := c.post(ctx, "/json_rpc", req, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("zanorpc: decoding %s result: %w", method, err)
+	}
+	return nil
+}
+
+// CallPath invokes one of the daemon's plain JSON endpoints, such as /getinfo
+func (c *Client) CallPath(ctx context.Context, path string, params, result interface{}) error {
+	if params == nil {
+		params = struct{}{}
+	}
+	return c.post(ctx, path, params, result)
+}
+
+func (c *Client) post(ctx context.Context, path string, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, MaxResponseSize))
+		return &HTTPError{StatusCode: resp.StatusCode}
+	}
+
+	dec := json.NewDecoder(io.LimitReader(resp.Body, MaxResponseSize))
+	if err := dec.Decode(result); err != nil {
+		return fmt.Errorf("zanorpc: decoding %s response: %w", path, err)
+	}
+	return nil
+}
+
+// checkStatus turns a daemon status string into an error
+func checkStatus(status string) error {
+	if status != "OK" {
+		return fmt.Errorf("%w: %q", ErrBadStatus, status)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package zanorpc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotZano is returned by Validate when a getinfo answer lacks what a Zano
+// daemon always reports, e.g. because another CryptoNote daemon answered
+var ErrNotZano = errors.New("zanorpc: not a Zano daemon")
+
+// NetworkState is the daemon's view of its own sync progress
+type NetworkState int
+
+// Values of daemon_network_state
+const (
+	StateConnecting NetworkState = iota
+	StateSynchronizing
+	StateOnline
+	StateLoadingCore
+	StateInternalError
+	StateUnloadingCore
+	StateDownloadingDatabase
+)
+
+func (s NetworkState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateSynchronizing:
+		return "synchronizing"
+	case StateOnline:
+		return "online"
+	case StateLoadingCore:
+		return "loading core"
+	case StateInternalError:
+		return "internal error"
+	case StateUnloadingCore:
+		return "unloading core"
+	case StateDownloadingDatabase:
+		return "downloading database"
+	default:
+		return "unknown"
+	}
+}
+
+// MaintainersInfo is the version announcement the daemon has seen from the
+// maintainers; it describes the latest release, not the daemon itself
+type MaintainersInfo struct {
+	VerMajor    uint32 `json:"ver_major"`
+	VerMinor    uint32 `json:"ver_minor"`
+	VerRevision uint32 `json:"ver_revision"`
+	BuildNo     uint32 `json:"build_no"`
+	Mode        uint8  `json:"mode"`
+}
+
+// Info is the result of getinfo
+type Info struct {
+	Status                       string          `json:"status"`
+	Height                       uint64          `json:"height"`
+	TxCount                      uint64          `json:"tx_count"`
+	TxPoolSize                   uint64          `json:"tx_pool_size"`
+	AltBlocksCount               uint64          `json:"alt_blocks_count"`
+	OutgoingConnectionsCount     uint64          `json:"outgoing_connections_count"`
+	IncomingConnectionsCount     uint64          `json:"incoming_connections_count"`
+	SynchronizedConnectionsCount uint64          `json:"synchronized_connections_count"`
+	WhitePeerlistSize            uint64          `json:"white_peerlist_size"`
+	GreyPeerlistSize             uint64          `json:"grey_peerlist_size"`
+	DaemonNetworkState           NetworkState    `json:"daemon_network_state"`
+	SynchronizationStartHeight   uint64          `json:"synchronization_start_height"`
+	MaxNetSeenHeight             uint64          `json:"max_net_seen_height"`
+	NetworkHashrate50            uint64          `json:"current_network_hashrate_50"`
+	NetworkHashrate350           uint64          `json:"current_network_hashrate_350"`
+	PowDifficulty                uint64          `json:"pow_difficulty"`
+	PosDifficulty                json.RawMessage `json:"pos_difficulty"` // Too large for uint64, sent as a string
+	LastBlockTimestamp           int64           `json:"last_block_timestamp"`
+	LastBlockHash                string          `json:"last_block_hash"`
+	NetTimeDeltaMedian           int64           `json:"net_time_delta_median"`
+	Maintainers                  MaintainersInfo `json:"mi"`
+}
+
+// Synchronized reports whether the daemon considers itself caught up
+func (i *Info) Synchronized() bool {
+	return i.DaemonNetworkState == StateOnline
+}
+
+// Validate checks for the fields only a Zano daemon reports. Monero-style
+// daemons also answer getinfo but have no PoS difficulty or last_block_hash.
+func (i *Info) Validate() error {
+	if i.Height == 0 || len(i.PosDifficulty) == 0 || i.LastBlockTimestamp == 0 {
+		return ErrNotZano
+	}
+	if id, err := hex.DecodeString(i.LastBlockHash); err != nil || len(id) != 32 {
+		return ErrNotZano
+	}
+	if i.DaemonNetworkState < StateConnecting || i.DaemonNetworkState > StateDownloadingDatabase {
+		return ErrNotZano
+	}
+	return nil
+}
+
+// LastBlockTime returns the timestamp of the top block
+func (i *Info) LastBlockTime() time.Time {
+	return time.Unix(i.LastBlockTimestamp, 0)
+}
+
+// GetInfo returns the daemon's general status
+func (c *Client) GetInfo(ctx context.Context) (*Info, error) {
+	var info Info
+	// flags 0 skips the expensive statistics the daemon can compute on request
+	if err := c.Call(ctx, "getinfo", map[string]interface{}{"flags": 0}, &info); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(info.Status); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
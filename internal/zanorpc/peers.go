@@ -0,0 +1,154 @@
+package zanorpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Connection is one entry of the daemon's live connection table
+type Connection struct {
+	Incoming bool   `json:"incoming"`
+	IP       Host   `json:"ip"`
+	Host     Host   `json:"host"`
+	Port     Port   `json:"port"`
+	PeerID   PeerID `json:"peer_id"`
+	Height   uint64 `json:"height"`
+	State    string `json:"state"`
+	LiveTime uint64 `json:"live_time"` // Seconds since the connection was opened
+	Address  string `json:"address"`
+}
+
+// Endpoint returns the connection's remote host:port
+func (c *Connection) Endpoint() string {
+	host := string(c.IP)
+	if host == "" {
+		host = string(c.Host)
+	}
+	if host == "" {
+		if h, _, err := net.SplitHostPort(c.Address); err == nil {
+			host = h
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(c.Port)))
+}
+
+// ConnectionsResponse is the result of get_connections
+type ConnectionsResponse struct {
+	Status      string       `json:"status"`
+	Connections []Connection `json:"connections"`
+}
+
+// PeerEntry is one entry of the daemon's white or gray peer list
+type PeerEntry struct {
+	ID       uint64 `json:"id"`
+	Host     Host   `json:"host"`
+	IP       Host   `json:"ip"`
+	Port     Port   `json:"port"`
+	LastSeen int64  `json:"last_seen"`
+}
+
+// Address returns the entry's host, preferring the textual form
+func (p *PeerEntry) Address() string {
+	if p.Host != "" {
+		return string(p.Host)
+	}
+	return string(p.IP)
+}
+
+// PeerListResponse is the result of get_peer_list
+type PeerListResponse struct {
+	Status    string      `json:"status"`
+	WhiteList []PeerEntry `json:"white_list"`
+	GrayList  []PeerEntry `json:"gray_list"`
+}
+
+// GetConnections returns the daemon's current P2P connections
+func (c *Client) GetConnections(ctx context.Context) (*ConnectionsResponse, error) {
+	var resp ConnectionsResponse
+	if err := c.Call(ctx, "get_connections", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetPeerList returns the daemon's white and gray peer lists
+func (c *Client) GetPeerList(ctx context.Context) (*PeerListResponse, error) {
+	var resp PeerListResponse
+	if err := c.CallPath(ctx, "/get_peer_list", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Host is an IPv4 address that daemons report either as a dotted string or
+// as the packed uint32 used on the wire
+type Host string
+
+// UnmarshalJSON accepts both representations
+func (h *Host) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*h = Host(s)
+		return nil
+	}
+	var n uint32
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	// Packed in network byte order, read as little endian
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, n)
+	*h = Host(ip.String())
+	return nil
+}
+
+// Port is a port number that daemons report either as a number or a string
+type Port uint16
+
+// UnmarshalJSON accepts both representations
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var n uint16
+	if err := json.Unmarshal(data, &n); err == nil {
+		*p = Port(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return err
+	}
+	*p = Port(v)
+	return nil
+}
+
+// PeerID is a node's P2P peer id in hex, as the crawler stores it. Daemons
+// report it either as a hex string or as a number.
+type PeerID string
+
+// UnmarshalJSON accepts both representations
+func (id *PeerID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = PeerID(s)
+		return nil
+	}
+	var n uint64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = PeerID(fmt.Sprintf("%016x", n))
+	return nil
+}
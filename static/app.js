@@ -27,7 +27,11 @@ function initializeWebSocket() {
     ws.onmessage = (event) => {
         try {
             const data = JSON.parse(event.data);
-            if (Array.isArray(data)) {
+            if (data.type === 'local_node') {
+                updateLocalNode(data);
+            } else if (data.type === 'fork_alert') {
+                showForkAlert(data.alert);
+            } else if (Array.isArray(data)) {
                 // Initial node list
                 data.forEach(node => updateNode(node, true));
                 initialLoad = false; // Mark initial load as complete
@@ -103,10 +107,10 @@ function updateNode(node, isInitialLoad) {
     console.log('Updating node:', node);
     
     // Check if this is a new node (not during initial load)
-    const isNewNode = !isInitialLoad && !nodes.has(node.ip);
+    const isNewNode = !isInitialLoad && !nodes.has(node.endpoint);
     
-    // Store node data
-    nodes.set(node.ip, node);
+    // Store node data, keyed by endpoint since one IP can run several nodes
+    nodes.set(node.endpoint, node);
     
     // Update stats
     updateStats();
@@ -127,7 +131,7 @@ function updateNode(node, isInitialLoad) {
             `${node.city}, ${node.country}` : 
             'Unknown location';
         
-        showToast(`New node found: ${node.ip}<br>${location}`, 'success');
+        showToast(`New node found: ${escapeHtml(node.endpoint)}<br>${escapeHtml(location)}`, 'success');
     }
 }
 
@@ -170,7 +174,7 @@ function updateTable() {
 function createNodeTableRow(node) {
     const row = document.createElement('tr');
     row.className = 'node-row';
-    row.dataset.ip = node.ip;
+    row.dataset.endpoint = node.endpoint;
     
     // Status cell
     const statusCell = document.createElement('td');
@@ -186,7 +190,7 @@ function createNodeTableRow(node) {
     ipInfo.className = 'ip-info';
     const ipAddress = document.createElement('span');
     ipAddress.className = 'ip-address';
-    ipAddress.textContent = node.ip;
+    ipAddress.textContent = node.endpoint;
     ipInfo.appendChild(ipAddress);
     ipCell.appendChild(ipInfo);
     row.appendChild(ipCell);
@@ -196,10 +200,10 @@ function createNodeTableRow(node) {
     locationCell.innerHTML = `
         <div class="location-info">
             <div class="location-main">
-                <i class="fas fa-globe"></i> ${node.country || 'Unknown'}
+                <i class="fas fa-globe"></i> ${escapeHtml(node.country || 'Unknown')}
             </div>
             <div class="location-secondary">
-                <i class="fas fa-city"></i> ${node.city || 'Unknown'}, ${node.regionName || 'Unknown'}
+                <i class="fas fa-city"></i> ${escapeHtml(node.city || 'Unknown')}, ${escapeHtml(node.regionName || 'Unknown')}
             </div>
         </div>
     `;
@@ -209,9 +213,9 @@ function createNodeTableRow(node) {
     const networkCell = document.createElement('td');
     networkCell.innerHTML = `
         <div class="network-info">
-            <span><i class="fas fa-network-wired"></i> ${node.isp || 'Unknown ISP'}</span>
-            <span><i class="fas fa-server"></i> ${node.as || 'Unknown AS'}</span>
-            <span><i class="fas fa-building"></i> ${node.org || 'Unknown Org'}</span>
+            <span><i class="fas fa-network-wired"></i> ${escapeHtml(node.isp || 'Unknown ISP')}</span>
+            <span><i class="fas fa-server"></i> ${escapeHtml(node.as || 'Unknown AS')}</span>
+            <span><i class="fas fa-building"></i> ${escapeHtml(node.org || 'Unknown Org')}</span>
         </div>
     `;
     row.appendChild(networkCell);
@@ -230,6 +234,15 @@ function createNodeTableRow(node) {
         tagsContainer.appendChild(seedTag);
     }
 
+    // Add public RPC tag if applicable
+    if (node.publicRpc) {
+        const rpcTag = document.createElement('span');
+        rpcTag.className = 'tag rpc-tag';
+        rpcTag.innerHTML = '<i class="fas fa-plug"></i> Public RPC';
+        rpcTag.title = node.rpcSynchronized ? 'Synchronized' : 'Not synchronized';
+        tagsContainer.appendChild(rpcTag);
+    }
+
     // Add hosting tag if applicable
     if (node.hosting) {
         const hostingTag = document.createElement('span');
@@ -254,6 +267,15 @@ function createNodeTableRow(node) {
         tagsContainer.appendChild(mobileTag);
     }
 
+    // Add address class tag for allowed non-public addresses
+    if (node.addressClass) {
+        const classTag = document.createElement('span');
+        classTag.className = 'tag address-class-tag';
+        classTag.innerHTML = '<i class="fas fa-network-wired"></i> ' + escapeHtml(formatAddressClass(node.addressClass));
+        classTag.title = 'Non-public address, not geolocated';
+        tagsContainer.appendChild(classTag);
+    }
+
     tagsCell.appendChild(tagsContainer);
     row.appendChild(tagsCell);
 
@@ -270,7 +292,7 @@ function createNodeTableRow(node) {
     const actionsCell = document.createElement('td');
     actionsCell.innerHTML = `
         <div class="action-buttons">
-            <button class="action-button info-button" onclick="showNodeDetails('${node.ip}')" title="View Details">
+            <button class="action-button info-button" onclick="showNodeDetails('${node.endpoint}')" title="View Details">
                 <i class="fas fa-info-circle"></i>
             </button>
         </div>
@@ -282,7 +304,7 @@ function createNodeTableRow(node) {
 
 // Function to check if a node should be displayed
 function shouldDisplayNode(node, searchTerm, statusFilter) {
-    const matchesSearch = node.ip.toLowerCase().includes(searchTerm) ||
+    const matchesSearch = node.endpoint.toLowerCase().includes(searchTerm) ||
         (node.country && node.country.toLowerCase().includes(searchTerm)) ||
         (node.city && node.city.toLowerCase().includes(searchTerm));
     
@@ -323,14 +345,14 @@ function updateMap() {
     // Add new markers
     nodes.forEach(node => {
         if (node.lat && node.lon) {
-            console.log(`Creating marker for node: ${node.ip} at coordinates:`, node.lat, node.lon);
+            console.log(`Creating marker for node: ${node.endpoint} at coordinates:`, node.lat, node.lon);
             const marker = createMarker(node);
             if (marker) {
-                markers[node.ip] = marker;
+                markers[node.endpoint] = marker;
                 marker.addTo(map);
             }
         } else {
-            console.warn(`Missing coordinates for node ${node.ip}`);
+            console.warn(`Missing coordinates for node ${node.endpoint}`);
         }
     });
 }
@@ -361,13 +383,13 @@ function createMarker(node) {
 function createPopupContent(node) {
     return `
         <div class="popup-content">
-            <h3>${node.ip}</h3>
+            <h3>${escapeHtml(node.endpoint)}</h3>
             <p><strong>Status:</strong> ${node.isOnline ? 'Online' : 'Offline'}</p>
-            <p><strong>Location:</strong> ${node.city || 'Unknown'}, ${node.country || 'Unknown'}</p>
-            <p><strong>ISP:</strong> ${node.isp || 'Unknown'}</p>
+            <p><strong>Location:</strong> ${escapeHtml(node.city || 'Unknown')}, ${escapeHtml(node.country || 'Unknown')}</p>
+            <p><strong>ISP:</strong> ${escapeHtml(node.isp || 'Unknown')}</p>
             <p><strong>Last Seen:</strong> ${formatDate(node.lastSeen)}</p>
             <div class="popup-actions">
-                <button onclick="showNodeDetails('${node.ip}')" class="popup-button">
+                <button onclick="showNodeDetails('${node.endpoint}')" class="popup-button">
                     <i class="fas fa-info-circle"></i> Details
                 </button>
             </div>
@@ -375,6 +397,27 @@ function createPopupContent(node) {
     `;
 }
 
+// Helper function to escape text reported by peers or the geolocation
+// service before it is placed in HTML
+function escapeHtml(value) {
+    return String(value)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// Helper function to bracket IPv6 addresses for use before a port
+function formatHost(ip) {
+    return ip.includes(':') ? `[${ip}]` : ip;
+}
+
+// Helper function to name an address class, e.g. "link-local" as "Link-local"
+function formatAddressClass(cls) {
+    return cls === 'cgnat' ? 'CGNAT' : cls.charAt(0).toUpperCase() + cls.slice(1);
+}
+
 // Helper function to format dates
 function formatDate(date) {
     if (!date) return 'Unknown';
@@ -417,6 +460,84 @@ function formatTime(timestamp) {
     return date.toLocaleString();
 }
 
+// Format blocks behind the network median
+function formatSyncLag(lag) {
+    if (!lag) return 'In sync';
+    if (lag < 0) return `Ahead by ${-lag} blocks`;
+    return `Behind by ${lag} blocks`;
+}
+
+// Titles for fork alert kinds
+const forkAlertTitles = {
+    minority_chain: 'Minority chain detected',
+    orphaned_tip: 'Nodes stuck on orphaned block',
+    hardfork_divergence: 'Hard fork divergence'
+};
+
+const logEventLabels = {
+    outbound_connect: 'Outbound connection',
+    inbound_connect: 'Inbound connection',
+    handshake_failed: 'Handshake failed',
+    disconnect: 'Disconnected',
+    peer_banned: 'Banned',
+    sync_progress: 'Syncing',
+    peer_mentioned: 'Mentioned'
+};
+
+// Function to describe the last peer event parsed from zanod's log
+function formatLogEvent(node) {
+    if (!node.logEvent) return 'None';
+    return `${logEventLabels[node.logEvent] || node.logEvent} (${formatDate(node.logEventAt)})`;
+}
+
+// Function to show a fork alert pushed by the server
+function showForkAlert(alert) {
+    const title = forkAlertTitles[alert.kind] || 'Chain split detected';
+    const nodes = (alert.nodes || []).slice(0, 5).map(escapeHtml).join(', ');
+    const more = alert.nodes && alert.nodes.length > 5 ? ` and ${alert.nodes.length - 5} more` : '';
+    showNotification(title, `${escapeHtml(alert.detail)}<br>${nodes}${more}`, 'warning');
+}
+
+// Format a hashrate in H/s with a unit prefix
+function formatHashrate(hashrate) {
+    const units = ['H/s', 'KH/s', 'MH/s', 'GH/s', 'TH/s', 'PH/s'];
+    let value = hashrate || 0;
+    let unit = 0;
+    while (value >= 1000 && unit < units.length - 1) {
+        value /= 1000;
+        unit++;
+    }
+    return `${value.toFixed(unit ? 2 : 0)} ${units[unit]}`;
+}
+
+// Function to update the local node panel
+function updateLocalNode(status) {
+    const indicator = document.getElementById('localNodeIndicator');
+    if (!indicator) return;
+
+    indicator.className = `status-indicator ${status.reachable && status.synchronized ? 'status-online' : 'status-offline'}`;
+
+    const state = document.getElementById('localNodeState');
+    state.textContent = status.reachable ? status.state : `Unreachable (${status.rpc})`;
+    state.title = status.error || '';
+
+    const set = (id, text) => { document.getElementById(id).textContent = text; };
+    if (!status.reachable) {
+        ['localNodeVersion', 'localNodeHeight', 'localNodeConnections',
+         'localNodePeerlists', 'localNodeHashrate', 'localNodeLastBlock'].forEach(id => set(id, '-'));
+        return;
+    }
+
+    set('localNodeVersion', status.version || 'Unknown');
+    set('localNodeHeight', status.maxNetSeenHeight > status.height
+        ? `${status.height} / ${status.maxNetSeenHeight}`
+        : `${status.height}`);
+    set('localNodeConnections', `${status.outgoingConnections} / ${status.incomingConnections}`);
+    set('localNodePeerlists', `${status.whitePeerlistSize} / ${status.greyPeerlistSize}`);
+    set('localNodeHashrate', formatHashrate(status.networkHashrate));
+    set('localNodeLastBlock', formatTime(status.lastBlockTime));
+}
+
 // Format uptime duration
 function formatUptime(seconds) {
     const days = Math.floor(seconds / 86400);
@@ -473,8 +594,8 @@ function showNotification(title, message, type = 'info') {
     }, 5000);
 }
 
-function showNodeDetails(ip) {
-    const node = nodes.get(ip);
+function showNodeDetails(endpoint) {
+    const node = nodes.get(endpoint);
     if (!node) return;
 
     const modal = document.createElement('div');
@@ -489,51 +610,131 @@ function showNodeDetails(ip) {
                 <div class="details-section">
                     <h4>Status & Network</h4>
                     <div class="details-grid">
+                        <div class="detail-item">
+                            <span class="detail-label">Endpoint</span>
+                            <span class="detail-value">${escapeHtml(node.endpoint)}</span>
+                        </div>
                         <div class="detail-item">
                             <span class="detail-label">Status</span>
                             <span class="detail-value">${node.isOnline ? 'Online' : 'Offline'}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">ISP</span>
-                            <span class="detail-value">${node.isp || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.isp || 'Unknown')}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">AS</span>
-                            <span class="detail-value">${node.as || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.as || 'Unknown')}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">Last Seen</span>
                             <span class="detail-value">${formatDate(node.lastSeen)}</span>
                         </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Last Log Event</span>
+                            <span class="detail-value">${formatLogEvent(node)}</span>
+                        </div>
                     </div>
                 </div>
+                ${node.peerId ? `
+                <div class="details-section">
+                    <h4>Protocol</h4>
+                    <div class="details-grid">
+                        <div class="detail-item">
+                            <span class="detail-label">Version</span>
+                            <span class="detail-value">${escapeHtml(node.clientVersion || 'Unknown')}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Height</span>
+                            <span class="detail-value">${escapeHtml(node.topHeight || 0)}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Sync Status</span>
+                            <span class="detail-value">${formatSyncLag(node.syncLag)}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Top Block</span>
+                            <span class="detail-value" title="${escapeHtml(node.topBlockId || '')}">${escapeHtml((node.topBlockId || '').slice(0, 16))}…</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Peer ID</span>
+                            <span class="detail-value">${escapeHtml(node.peerId)}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">P2P Port</span>
+                            <span class="detail-value">${escapeHtml(node.myPort || 'Not listening')}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Clock Offset</span>
+                            <span class="detail-value">${node.localTime ? Math.round(node.localTime - new Date(node.lastHandshake).getTime() / 1000) + 's' : 'Unknown'}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Last Handshake</span>
+                            <span class="detail-value">${formatDate(node.lastHandshake)}</span>
+                        </div>
+                    </div>
+                </div>` : ''}
                 <div class="details-section">
                     <h4>Location</h4>
                     <div class="details-grid">
                         <div class="detail-item">
                             <span class="detail-label">Country</span>
-                            <span class="detail-value">${node.country || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.country || 'Unknown')}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">City</span>
-                            <span class="detail-value">${node.city || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.city || 'Unknown')}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">Region</span>
-                            <span class="detail-value">${node.regionName || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.regionName || 'Unknown')}</span>
                         </div>
                         <div class="detail-item">
                             <span class="detail-label">Timezone</span>
-                            <span class="detail-value">${node.timezone || 'Unknown'}</span>
+                            <span class="detail-value">${escapeHtml(node.timezone || 'Unknown')}</span>
                         </div>
                     </div>
                 </div>
+                ${node.publicRpc ? `
+                <div class="details-section">
+                    <h4>Public RPC</h4>
+                    <div class="details-grid">
+                        <div class="detail-item">
+                            <span class="detail-label">Endpoint</span>
+                            <span class="detail-value">http://${escapeHtml(formatHost(node.ip))}:${escapeHtml(node.rpcPort)}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Height</span>
+                            <span class="detail-value">${escapeHtml(node.rpcHeight || 0)}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Synchronized</span>
+                            <span class="detail-value">${node.rpcSynchronized ? 'Yes' : 'No'}</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Response Time</span>
+                            <span class="detail-value">${escapeHtml(node.rpcLatency || 0)}ms</span>
+                        </div>
+                        <div class="detail-item">
+                            <span class="detail-label">Last Checked</span>
+                            <span class="detail-value">${formatDate(node.lastRpcCheck)}</span>
+                        </div>
+                    </div>
+                </div>` : ''}
                 <div class="details-section">
                     <h4>Node Tags</h4>
                     <div class="tags">
+                        ${node.publicRpc ? '<span class="tag rpc-tag">Public RPC</span>' : ''}
                         ${node.mobile ? '<span class="tag mobile-tag">Mobile</span>' : ''}
                         ${node.proxy ? '<span class="tag proxy-tag">Proxy</span>' : ''}
                         ${node.hosting ? '<span class="tag hosting-tag">Hosting</span>' : ''}
+                        ${node.addressClass ? `<span class="tag address-class-tag">${escapeHtml(formatAddressClass(node.addressClass))}</span>` : ''}
+                    </div>
+                </div>
+                <div class="details-section">
+                    <h4>Discovered By</h4>
+                    <div class="details-grid node-sources">
+                        <span class="detail-value">Loading…</span>
                     </div>
                 </div>
             </div>
@@ -542,6 +743,7 @@ function showNodeDetails(ip) {
 
     document.body.appendChild(modal);
     setTimeout(() => modal.classList.add('show'), 10);
+    loadNodeSources(node.ip, node.port, modal.querySelector('.node-sources'));
 
     // Close modal handlers
     const closeButton = modal.querySelector('.close-button');
@@ -559,13 +761,37 @@ function showNodeDetails(ip) {
     });
 }
 
+// Fill a node's details with the discovery sources that reported its endpoint
+function loadNodeSources(ip, port, container) {
+    fetch(`/api/sources?ip=${encodeURIComponent(ip)}&port=${encodeURIComponent(port)}`)
+        .then(response => response.json())
+        .then(sources => {
+            if (!sources || sources.length === 0) {
+                container.innerHTML = '<span class="detail-value">No sources recorded</span>';
+                return;
+            }
+            container.innerHTML = sources.map(source => `
+                <div class="detail-item">
+                    <span class="detail-label">${escapeHtml(source.source)}</span>
+                    <span class="detail-value" title="Last reported ${escapeHtml(formatDate(source.lastSeen))}">
+                        ${escapeHtml(formatDate(source.firstSeen))} (${escapeHtml(source.sightings)}×)
+                    </span>
+                </div>
+            `).join('');
+        })
+        .catch(error => {
+            console.error('Error loading node sources:', error);
+            container.innerHTML = '<span class="detail-value">Unavailable</span>';
+        });
+}
+
 function closeModal(modal) {
     modal.classList.remove('show');
     setTimeout(() => modal.remove(), 300);
 }
 
-function showOnMap(ip) {
-    const node = nodes.get(ip);
+function showOnMap(endpoint) {
+    const node = nodes.get(endpoint);
     if (!node || !node.lat || !node.lon) return;
 
     const lat = parseFloat(node.lat);
@@ -577,14 +803,14 @@ function showOnMap(ip) {
     map.setView([lat, lon], 8);
 
     // Find and highlight the marker
-    if (markers[ip]) {
-        markers[ip].openPopup();
-        const icon = markers[ip].getIcon();
+    if (markers[endpoint]) {
+        markers[endpoint].openPopup();
+        const icon = markers[endpoint].getIcon();
         icon.options.className += ' highlight';
-        markers[ip].setIcon(icon);
+        markers[endpoint].setIcon(icon);
         setTimeout(() => {
             icon.options.className = icon.options.className.replace(' highlight', '');
-            markers[ip].setIcon(icon);
+            markers[endpoint].setIcon(icon);
         }, 2000);
     }
 }
@@ -680,24 +906,26 @@ function exportNodes() {
 
     // Add node information
     filteredNodes.forEach(node => {
-        content += `# ${node.ip}\n`;
+        content += `# ${node.endpoint}\n`;
         content += `# Status: ${node.isOnline ? 'Online' : 'Offline'}\n`;
-        content += `# Location: ${node.city || 'Unknown'}, ${node.country || 'Unknown'}\n`;
-        content += `# ISP: ${node.isp || 'Unknown'}\n`;
+        content += `# Location: ${escapeHtml(node.city || 'Unknown')}, ${escapeHtml(node.country || 'Unknown')}\n`;
+        content += `# ISP: ${escapeHtml(node.isp || 'Unknown')}\n`;
         content += `# Last Seen: ${formatDate(node.lastSeen)}\n`;
         
         // Add tags
         const tags = [];
         if (isSeedNode(node.ip)) tags.push('Seed Node');
+        if (node.publicRpc) tags.push('Public RPC');
         if (node.hosting) tags.push('Hosting');
         if (node.proxy) tags.push('Proxy');
         if (node.mobile) tags.push('Mobile');
+        if (node.addressClass) tags.push(formatAddressClass(node.addressClass));
         if (tags.length > 0) {
             content += `# Tags: ${tags.join(', ')}\n`;
         }
         
-        // Add the IP address for easy copying
-        content += `${node.ip}\n\n`;
+        // Add the endpoint for easy copying, e.g. into a -seed-file
+        content += `${node.endpoint}\n\n`;
     });
 
     // Create and download the file